@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"github.com/cardiacsociety/web-services/internal/generic"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
 	"github.com/cardiacsociety/web-services/internal/resource"
 	"log"
 	"strings"
@@ -26,7 +27,7 @@ type ResourceDoc struct {
 
 func syncResources() {
 
-	xi, err := generic.GetIDs(ds, "ol_resource", "WHERE active = 1")
+	xi, err := generic.GetIDs(ds, "ol_resource", datastore.NewFilter().Equal("active", 1))
 	if err != nil {
 		log.Fatalln("mysql err", err)
 	}
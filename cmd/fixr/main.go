@@ -210,9 +210,8 @@ func checkShortLinks() error {
 // updated_at value to ensure this record will be picked up for sync later on (by mongr)
 func setShortURL(id int, shortURL string) error {
 
-	query := `UPDATE ol_resource SET short_url = "%v", updated_at = NOW() WHERE id = %v LIMIT 1`
-	query = fmt.Sprintf(query, shortURL, id)
-	_, err := DS.MySQL.Session.Exec(query)
+	query := `UPDATE ol_resource SET short_url = ?, updated_at = NOW() WHERE id = ? LIMIT 1`
+	_, err := DS.MySQL.Session.Exec(query, shortURL, id)
 
 	return errors.Wrap(err, "sql updated failed")
 }
@@ -655,15 +654,14 @@ func updateResource(r resourceData) error {
 
 	query := `UPDATE ol_resource SET
               updated_at = NOW(),
-              presented_on = '%s',
-              presented_year = '%s',
-              presented_month = '%s',
-              presented_date = '%s',
-			  attributes = '%s'
-			  WHERE id = %v LIMIT 1`
-	query = fmt.Sprintf(query, r.PubDate, r.PubYear, r.PubMonth, r.PubDay, attributes, r.ID)
-
-	_, err = DS.MySQL.Session.Exec(query)
+              presented_on = ?,
+              presented_year = ?,
+              presented_month = ?,
+              presented_date = ?,
+			  attributes = ?
+			  WHERE id = ? LIMIT 1`
+
+	_, err = DS.MySQL.Session.Exec(query, r.PubDate, r.PubYear, r.PubMonth, r.PubDay, string(attributes), r.ID)
 
 	return err
 }
@@ -27,7 +27,7 @@ const pubMedFetch = "https://eutils.ncbi.nlm.nih.gov/entrez/eutils/efetch.fcgi?d
 // The id of the resource type (ol_resource_type table) for journal articles
 const resourceTypeID = 80
 
-var api, apiAuth, apiResource string
+var api, apiAuth, apiRefresh, apiResource string
 
 type PubMedSearch struct {
 	Header map[string]string  `json:"header"`
@@ -126,13 +126,15 @@ type AuthRequest struct {
 	Data    AuthData
 }
 type AuthData struct {
-	Token     string
-	IssuedAt  time.Time
-	ExpiresAt time.Time
+	Token        string
+	IssuedAt     time.Time
+	ExpiresAt    time.Time
+	RefreshToken string
 }
 
-// Universal token for accessing API
-var token string
+// Universal token for accessing API, and the refresh token used to renew it as access tokens are short-lived
+var token, refreshToken string
+var tokenExpiresAt time.Time
 
 // Batch size - ie how many to process at a time
 var batchSize int
@@ -157,6 +159,7 @@ func init() {
 	// set api strings
 	api = os.Getenv("MAPPCPD_API_URL")
 	apiAuth = api + "/v1/auth/admin"
+	apiRefresh = api + "/v1/auth/refresh"
 	apiResource = api + "/v1/a/batch/resources"
 
 }
@@ -296,7 +299,7 @@ func authAPI() {
 	}
 	defer res.Body.Close()
 	json.NewDecoder(res.Body).Decode(&a)
-	token = a.Data.Token
+	token, refreshToken, tokenExpiresAt = a.Data.Token, a.Data.RefreshToken, a.Data.ExpiresAt
 	if token == "" {
 		fmt.Println("Failed to authenticate witht the API")
 		os.Exit(1)
@@ -305,6 +308,30 @@ func authAPI() {
 	fmt.Println("ok")
 }
 
+// refreshAPI renews the access token with the refresh token, if the access token expires within the next minute
+func refreshAPI() {
+	if time.Now().Add(time.Minute).Before(tokenExpiresAt) {
+		return
+	}
+
+	fmt.Print("Refresh token... ")
+	a := AuthRequest{}
+	b := `{"refreshToken": "` + refreshToken + `"}`
+	res, err := httpClient.Post(apiRefresh, "application/json", strings.NewReader(b))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer res.Body.Close()
+	json.NewDecoder(res.Body).Decode(&a)
+	if a.Data.Token == "" {
+		fmt.Println("Failed to refresh the token with the API")
+		os.Exit(1)
+	}
+	token, refreshToken, tokenExpiresAt = a.Data.Token, a.Data.RefreshToken, a.Data.ExpiresAt
+
+	fmt.Println("ok")
+}
+
 // pubmedCount runs the pubmed query with rettype=count to get the number or articles
 func pubmedCount(searchTerm string, relDate, startAt int) int {
 
@@ -640,6 +667,8 @@ func (pa *PubMedArticleSet) inspect() {
 // j is fully formatted JSON string {"data": [{...}, {...}]}
 func addResources(j string) {
 
+	refreshAPI()
+
 	fmt.Println("POST batch of resources to api...")
 	req, err := http.NewRequest("POST", apiResource, strings.NewReader(j))
 	if err != nil {
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/34South/envr"
+	"github.com/cardiacsociety/web-services/internal/cpd"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// Member id, 0 for all members
+var memberID int
+
+// Report due occurrences without recording them
+var dryRun bool
+
+// Datastore
+var store datastore.Datastore
+
+func init() {
+
+	envr.New("recordrEnv", []string{
+		"MAPPCPD_MONGO_DBNAME",
+		"MAPPCPD_MONGO_DESC",
+		"MAPPCPD_MONGO_URL",
+		"MAPPCPD_MYSQL_DESC",
+		"MAPPCPD_MYSQL_URL",
+	}).Auto()
+
+	flag.IntVar(&memberID, "m", 0, "Specify a member id to record for a single member, default is all members")
+	flag.BoolVar(&dryRun, "d", false, "Dry run - list due occurrences without recording them")
+
+	var err error
+	store, err = datastore.FromEnv()
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func main() {
+
+	flag.Parse()
+	log.Printf("Running recordr for member id: %d (0 = all), dry run: %v", memberID, dryRun)
+
+	xr, err := cpd.AutoRecurring(store)
+	if err != nil {
+		log.Fatalf("cpd.AutoRecurring() err = %s", err)
+	}
+
+	now := time.Now()
+	var recorded, duplicates, failed int
+
+	for _, r := range xr {
+		if memberID > 0 && r.MemberID != memberID {
+			continue
+		}
+
+		if dryRun {
+			logDue(r, now)
+			continue
+		}
+
+		for _, res := range r.AutoRecord(store, now) {
+			log.Println(res)
+			switch {
+			case res.Error != nil:
+				failed++
+			case res.DuplicateOf > 0:
+				duplicates++
+			default:
+				recorded++
+			}
+		}
+	}
+
+	log.Printf("Recorded %d, already recorded %d, errors %d", recorded, duplicates, failed)
+}
+
+// logDue logs the due occurrences of the auto-record activities in r
+func logDue(r cpd.Recurring, now time.Time) {
+	for _, a := range r.Activities {
+		if !a.AutoRecord {
+			continue
+		}
+		due, err := a.Due(now)
+		if err != nil {
+			log.Printf("Member id %d, recurring activity %s - %s", r.MemberID, a.ID.Hex(), err)
+			continue
+		}
+		for _, d := range due {
+			log.Printf("Member id %d, recurring activity %s is due on %s", r.MemberID, a.ID.Hex(), d.Format("2006-01-02"))
+		}
+	}
+}
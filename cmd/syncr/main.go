@@ -44,8 +44,8 @@ var backdays int
 // Collection to sync
 var collection string
 
-// sql clause
-var clause string
+// filter for records updated within backdays
+var filter *datastore.Filter
 
 // Datastore
 var store datastore.Datastore
@@ -78,7 +78,7 @@ func main() {
 	}
 	log.Printf("Running syncr with backdays: %d on collection: %s", backdays, collection)
 
-	clause = sqlClause()
+	filter = updatedFilter()
 
 	err = sync()
 	if err != nil {
@@ -97,13 +97,13 @@ func flagCheck() error {
 	return nil
 }
 
-// sqlClause returns an sql clause for selection of records with an updated_at
+// updatedFilter returns a filter for selection of records with an updated_at
 // date >= current date - backdays.
-func sqlClause() string {
+func updatedFilter() *datastore.Filter {
 	// MySQL timestamp
 	t := time.Now().AddDate(0, 0, -backdays).Format("2006-01-02 15:04:05")
 
-	return fmt.Sprintf("WHERE updated_at >= '%s'", t)
+	return datastore.NewFilter().GreaterEq("updated_at", t)
 }
 
 func sync() error {
@@ -175,7 +175,7 @@ func updateMemberIDs() ([]int, error) {
 	ids := []int{}
 
 	// check member table for updates
-	xi, err := generic.GetIDs(store, memberTable, clause)
+	xi, err := generic.GetIDs(store, memberTable, filter)
 	if err != nil {
 		return ids, err
 	}
@@ -183,7 +183,7 @@ func updateMemberIDs() ([]int, error) {
 
 	// check member-related tables for updates
 	for _, t := range memberRelatedTables {
-		xi, err = generic.GetIntCol(store, t, memberFKColName, clause)
+		xi, err = generic.GetIntCol(store, t, memberFKColName, filter)
 		if err != nil {
 			return ids, err
 		}
@@ -197,7 +197,7 @@ func syncModules() error {
 
 	var count int
 
-	ids, err := generic.GetIDs(store, moduleTable, clause)
+	ids, err := generic.GetIDs(store, moduleTable, filter)
 	if err != nil {
 		return fmt.Errorf("syncModules() - GetIDs() err = %s", err)
 	}
@@ -224,7 +224,7 @@ func syncResources() error {
 
 	var count int
 
-	ids, err := generic.GetIDs(store, resourceTable, clause)
+	ids, err := generic.GetIDs(store, resourceTable, filter)
 	if err != nil {
 		return fmt.Errorf("syncResources() err = %s", err)
 	}
@@ -2,10 +2,8 @@ package graphql
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/cardiacsociety/web-services/internal/cpd"
-	"github.com/cardiacsociety/web-services/internal/platform/jwt"
 	"github.com/graphql-go/graphql"
 	"github.com/pkg/errors"
 )
@@ -26,7 +24,7 @@ var activitySave = &graphql.Field{
 
 		// Always extract the member id from the token, available thus:
 		token := p.Info.VariableValues["token"]
-		at, err := jwt.Decode(token.(string), os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+		at, err := memberToken(token.(string))
 		if err != nil {
 			return nil, err
 		}
@@ -129,7 +127,7 @@ var activityDelete = &graphql.Field{
 
 		// Always extract the member id from the token, available thus:
 		token := p.Info.VariableValues["token"]
-		at, err := jwt.Decode(token.(string), os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+		at, err := memberToken(token.(string))
 		if err != nil {
 			return nil, err
 		}
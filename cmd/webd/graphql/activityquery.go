@@ -1,11 +1,8 @@
 package graphql
 
 import (
-	"os"
-
 	"github.com/cardiacsociety/web-services/internal/attachments"
 	"github.com/cardiacsociety/web-services/internal/date"
-	"github.com/cardiacsociety/web-services/internal/platform/jwt"
 	"github.com/graphql-go/graphql"
 )
 
@@ -23,7 +20,7 @@ var activityQuery = &graphql.Field{
 
 		// Always extract the member id from the token, available thus:
 		token := p.Info.VariableValues["token"]
-		at, err := jwt.Decode(token.(string), os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+		at, err := memberToken(token.(string))
 		if err != nil {
 			return nil, err
 		}
@@ -60,7 +57,7 @@ var activitiesQuery = &graphql.Field{
 
 		// Extract member id from the token, available thus:
 		token := p.Info.VariableValues["token"]
-		at, err := jwt.Decode(token.(string), os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+		at, err := memberToken(token.(string))
 		if err != nil {
 			return nil, err
 		}
@@ -13,6 +13,11 @@ type evaluationData struct {
 	CreditRequired float64 `json:"creditRequired"`
 	CreditObtained float64 `json:"creditObtained"`
 	Closed         bool    `json:"closed"`
+
+	// Compliance verdict and projection for the end of the period
+	ComplianceStatus   string  `json:"complianceStatus"`
+	ProjectedCredit    float64 `json:"projectedCredit"`
+	ProjectedShortfall float64 `json:"projectedShortfall"`
 }
 
 // evaluations fetches all evaluations member and maps to local evaluationData values.
@@ -55,6 +60,9 @@ func mapEvaluationData(ar cpd.MemberActivityReport) evaluationData {
 	ed.CreditRequired = float64(ar.CreditRequired)
 	ed.CreditObtained = float64(ar.CreditObtained)
 	ed.Closed = ar.Closed
+	ed.ComplianceStatus = ar.Compliance.Status
+	ed.ProjectedCredit = ar.Compliance.ProjectedCredit
+	ed.ProjectedShortfall = ar.Compliance.ProjectedShortfall
 
 	return ed
 }
@@ -1,9 +1,6 @@
 package graphql
 
 import (
-	"os"
-
-	"github.com/cardiacsociety/web-services/internal/platform/jwt"
 	"github.com/graphql-go/graphql"
 )
 
@@ -15,7 +12,7 @@ var currentEvaluationQuery = &graphql.Field{
 
 		// Extract member id from the token, available thus:
 		token := p.Info.VariableValues["token"]
-		at, err := jwt.Decode(token.(string), os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+		at, err := memberToken(token.(string))
 		if err != nil {
 			return nil, err
 		}
@@ -33,7 +30,7 @@ var evaluationsQuery = &graphql.Field{
 
 		// Extract member id from the token, available thus:
 		token := p.Info.VariableValues["token"]
-		at, err := jwt.Decode(token.(string), os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+		at, err := memberToken(token.(string))
 		if err != nil {
 			return nil, err
 		}
@@ -76,5 +73,17 @@ var evaluationType = graphql.NewObject(graphql.ObjectConfig{
 			Type:        graphql.Boolean,
 			Description: "Indicated if the evaluation period is closed.",
 		},
+		"complianceStatus": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Compliance verdict - compliant, on-track, at-risk or non-compliant.",
+		},
+		"projectedCredit": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Credit projected at the end of the period, based on the rate of activity recorded so far.",
+		},
+		"projectedShortfall": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Credit projected to be short of the requirement at the end of the period.",
+		},
 	},
 })
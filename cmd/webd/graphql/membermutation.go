@@ -1,9 +1,6 @@
 package graphql
 
 import (
-	"os"
-
-	"github.com/cardiacsociety/web-services/internal/platform/jwt"
 	"github.com/graphql-go/graphql"
 )
 
@@ -21,7 +18,7 @@ var Mutation = &graphql.Field{
 		token, ok := p.Args["token"].(string)
 		if ok {
 
-			at, err := jwt.Decode(token, os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+			at, err := memberToken(token)
 			if err != nil {
 				return nil, err
 			}
@@ -32,10 +29,7 @@ var Mutation = &graphql.Field{
 				return nil, err
 			}
 
-			m.Token, err = freshToken(token)
-			if err != nil {
-				return m, err
-			}
+			m.Token = token
 
 			return m, nil
 		}
@@ -59,5 +53,10 @@ var memberInputType = graphql.NewObject(graphql.ObjectConfig{
 		},
 		"saveActivity":   activitySave,
 		"deleteActivity": activityDelete,
+
+		"addRecurringActivity":    recurringActivityAdd,
+		"removeRecurringActivity": recurringActivityRemove,
+		"recordRecurringActivity": recurringActivityRecord,
+		"skipRecurringActivity":   recurringActivitySkip,
 	},
 })
@@ -0,0 +1,197 @@
+package graphql
+
+import (
+	"time"
+
+	"github.com/cardiacsociety/web-services/internal/cpd"
+	"github.com/cardiacsociety/web-services/internal/date"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// recurringActivityData is a leaner representation of cpd.RecurringActivity
+type recurringActivityData struct {
+	ID          string  `json:"id"`
+	ActivityID  int     `json:"activityId"`
+	TypeID      int     `json:"typeId"`
+	Quantity    float64 `json:"quantity"`
+	Description string  `json:"description"`
+	Type        string  `json:"type"`
+	Rule        string  `json:"rule"`
+	Start       string  `json:"start"`
+	Next        string  `json:"next"`
+	Done        bool    `json:"done"`
+	AutoRecord  bool    `json:"autoRecord"`
+}
+
+// recurringActivityInputData represents an object for adding a recurring activity
+type recurringActivityInputData struct {
+	TypeID      int     `json:"typeId"`
+	ActivityID  int     `json:"activityId"`
+	Quantity    float64 `json:"quantity"`
+	Description string  `json:"description"`
+	Rule        string  `json:"rule"`
+	Start       string  `json:"start"`
+	Next        string  `json:"next"`
+	AutoRecord  bool    `json:"autoRecord"`
+}
+
+// unpack an object into a value of type recurringActivityInputData
+func (rai *recurringActivityInputData) unpack(obj map[string]interface{}) error {
+	if val, ok := obj["typeId"].(int); ok {
+		rai.TypeID = val
+	}
+	if val, ok := obj["quantity"].(float64); ok {
+		rai.Quantity = val
+	}
+	if val, ok := obj["description"].(string); ok {
+		rai.Description = val
+	}
+	if val, ok := obj["rule"].(string); ok {
+		rai.Rule = val
+	}
+	if val, ok := obj["start"].(string); ok {
+		rai.Start = val
+	}
+	if val, ok := obj["next"].(string); ok {
+		rai.Next = val
+	}
+	if val, ok := obj["autoRecord"].(bool); ok {
+		rai.AutoRecord = val
+	}
+
+	return nil
+}
+
+// mapRecurringActivityData maps a cpd.RecurringActivity to the local recurringActivityData type
+func mapRecurringActivityData(a cpd.RecurringActivity) recurringActivityData {
+
+	ra := recurringActivityData{
+		ID:          a.ID.Hex(),
+		ActivityID:  a.ActivityID,
+		TypeID:      a.TypeID,
+		Quantity:    a.Quantity,
+		Description: a.Description,
+		Type:        a.Type,
+		Rule:        a.Rule,
+		Next:        a.Next.Format("2006-01-02"),
+		Done:        a.Done,
+		AutoRecord:  a.AutoRecord,
+	}
+	if !a.Start.IsZero() {
+		ra.Start = a.Start.Format("2006-01-02")
+	}
+
+	return ra
+}
+
+// recurringActivities fetches the recurring activities for a member and maps to local recurringActivityData type.
+func recurringActivities(memberID int) ([]recurringActivityData, error) {
+
+	var xra []recurringActivityData
+
+	r, err := cpd.MemberRecurring(DS, memberID)
+	if err != nil {
+		return xra, err
+	}
+	for _, a := range r.Activities {
+		xra = append(xra, mapRecurringActivityData(a))
+	}
+
+	return xra, nil
+}
+
+// addRecurringActivity validates and adds a recurring activity to the member's Recurring doc
+func addRecurringActivity(memberID int, input recurringActivityInputData) (recurringActivityData, error) {
+
+	var ra recurringActivityData
+
+	r, err := cpd.MemberRecurring(DS, memberID)
+	if err != nil {
+		return ra, err
+	}
+
+	next, err := date.StringToTime(input.Next)
+	if err != nil {
+		return ra, errors.Wrap(err, "next")
+	}
+	start := next
+	if input.Start != "" {
+		start, err = date.StringToTime(input.Start)
+		if err != nil {
+			return ra, errors.Wrap(err, "start")
+		}
+	}
+
+	a := cpd.RecurringActivity{
+		ActivityID:  input.ActivityID,
+		TypeID:      input.TypeID,
+		Quantity:    input.Quantity,
+		Description: input.Description,
+		Rule:        input.Rule,
+		Start:       start,
+		Next:        next,
+		AutoRecord:  input.AutoRecord,
+	}
+	err = a.Validate()
+	if err != nil {
+		return ra, err
+	}
+	a.ID = bson.NewObjectId()
+	a.CreatedAt = time.Now()
+	a.UpdatedAt = time.Now()
+
+	r.Activities = append(r.Activities, a)
+	r.UpdatedAt = time.Now()
+	err = r.Save(DS)
+	if err != nil {
+		return ra, err
+	}
+
+	return mapRecurringActivityData(a), nil
+}
+
+// removeRecurringActivity removes a recurring activity that belongs to the member
+func removeRecurringActivity(memberID int, oid string) error {
+
+	r, err := cpd.MemberRecurring(DS, memberID)
+	if err != nil {
+		return err
+	}
+
+	// verify owner match before removing
+	_, err = r.GetActivity(oid)
+	if err != nil {
+		return err
+	}
+
+	return r.RemoveActivity(DS, oid)
+}
+
+// recordRecurringActivity records the next occurrence of a recurring activity, or skips it, and returns the
+// recurring activity with the updated schedule.
+func recordRecurringActivity(memberID int, oid string, skip bool) (recurringActivityData, error) {
+
+	var ra recurringActivityData
+
+	r, err := cpd.MemberRecurring(DS, memberID)
+	if err != nil {
+		return ra, err
+	}
+
+	if skip {
+		err = r.Skip(DS, oid)
+	} else {
+		err = r.Record(DS, oid)
+	}
+	if err != nil {
+		return ra, err
+	}
+
+	a, err := r.GetActivity(oid)
+	if err != nil {
+		return ra, err
+	}
+
+	return mapRecurringActivityData(a), nil
+}
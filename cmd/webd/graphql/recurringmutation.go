@@ -0,0 +1,164 @@
+package graphql
+
+import (
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+	"github.com/pkg/errors"
+)
+
+// recurringActivityAdd handles mutation (add) of a member recurring activity
+var recurringActivityAdd = &graphql.Field{
+	Description: "Add a recurring activity for the member identified by the token.",
+	Type:        recurringActivityType,
+	Args: graphql.FieldConfigArgument{
+		"obj": &graphql.ArgumentConfig{
+			Type:        recurringActivityInputType,
+			Description: "An object containing the necessary fields to add a recurring activity",
+		},
+	},
+	Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+
+		// Always extract the member id from the token, available thus:
+		token := p.Info.VariableValues["token"]
+		at, err := memberToken(token.(string))
+		if err != nil {
+			return nil, err
+		}
+		memberID := at.Claims.ID
+
+		raObj, ok := p.Args["obj"].(map[string]interface{})
+		if ok {
+
+			ra := recurringActivityInputData{}
+			err := ra.unpack(raObj)
+			if err != nil {
+				return nil, err
+			}
+
+			// set activity id from the activity type id
+			ra.ActivityID, err = activityIDByTypeID(ra.TypeID)
+			if err != nil {
+				msg := fmt.Sprintf("Error fetching activity with activity type id = %v", ra.TypeID)
+				return nil, errors.Wrap(err, msg)
+			}
+
+			return addRecurringActivity(memberID, ra)
+		}
+
+		return nil, nil
+	},
+}
+
+// recurringActivityInputType defines fields for adding a member recurring activity
+var recurringActivityInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "recurringActivityAddInput",
+	Description: "An input object type used as an argument for adding a member recurring activity",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"typeId": &graphql.InputObjectFieldConfig{
+			Type:        &graphql.NonNull{OfType: graphql.Int},
+			Description: "ID of the activity type",
+		},
+		"quantity": &graphql.InputObjectFieldConfig{
+			Type:        &graphql.NonNull{OfType: graphql.Float},
+			Description: "The number of units recorded for each occurrence, generally the number of hours",
+		},
+		"description": &graphql.InputObjectFieldConfig{
+			Type:        &graphql.NonNull{OfType: graphql.String},
+			Description: "The specifics of the activity described by the member",
+		},
+		"rule": &graphql.InputObjectFieldConfig{
+			Type:        &graphql.NonNull{OfType: graphql.String},
+			Description: "Recurrence rule (RRULE), eg 'FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;UNTIL=20181231'",
+		},
+		"next": &graphql.InputObjectFieldConfig{
+			Type:        &graphql.NonNull{OfType: graphql.String},
+			Description: "The date of the first occurrence to be recorded, format 'YYYY-MM-DD'",
+		},
+		"start": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Optional date on which the series begins, format 'YYYY-MM-DD', defaults to next",
+		},
+		"autoRecord": &graphql.InputObjectFieldConfig{
+			Type:         graphql.Boolean,
+			Description:  "A flag to have due occurrences recorded automatically",
+			DefaultValue: false,
+		},
+	},
+})
+
+// recurringActivityRemove handles mutation (remove) of a member recurring activity
+var recurringActivityRemove = &graphql.Field{
+	Description: "Remove a recurring activity that belongs to the member identified by the token",
+	Type:        graphql.String,
+	Args: graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{
+			Type:        &graphql.NonNull{OfType: graphql.String},
+			Description: "The id of the recurring activity to be removed",
+		},
+	},
+	Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+
+		// Always extract the member id from the token, available thus:
+		token := p.Info.VariableValues["token"]
+		at, err := memberToken(token.(string))
+		if err != nil {
+			return nil, err
+		}
+		memberID := at.Claims.ID
+
+		oid, ok := p.Args["id"].(string)
+		if ok {
+			return "Recurring activity removed", removeRecurringActivity(memberID, oid)
+		}
+		return nil, nil
+	},
+}
+
+// recurringActivityRecord handles mutation (record) of the next occurrence of a member recurring activity
+var recurringActivityRecord = &graphql.Field{
+	Description: "Record the next occurrence of a recurring activity as a member activity, and advance the schedule",
+	Type:        recurringActivityType,
+	Args: graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{
+			Type:        &graphql.NonNull{OfType: graphql.String},
+			Description: "The id of the recurring activity",
+		},
+	},
+	Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return resolveRecurringActivityNext(p, false)
+	},
+}
+
+// recurringActivitySkip handles mutation (skip) of the next occurrence of a member recurring activity
+var recurringActivitySkip = &graphql.Field{
+	Description: "Skip the next occurrence of a recurring activity, advancing the schedule without recording",
+	Type:        recurringActivityType,
+	Args: graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{
+			Type:        &graphql.NonNull{OfType: graphql.String},
+			Description: "The id of the recurring activity",
+		},
+	},
+	Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return resolveRecurringActivityNext(p, true)
+	},
+}
+
+// resolveRecurringActivityNext records, or skips, the next occurrence of a recurring activity
+func resolveRecurringActivityNext(p graphql.ResolveParams, skip bool) (interface{}, error) {
+
+	// Always extract the member id from the token, available thus:
+	token := p.Info.VariableValues["token"]
+	at, err := memberToken(token.(string))
+	if err != nil {
+		return nil, err
+	}
+	memberID := at.Claims.ID
+
+	oid, ok := p.Args["id"].(string)
+	if ok {
+		return recordRecurringActivity(memberID, oid, skip)
+	}
+	return nil, nil
+}
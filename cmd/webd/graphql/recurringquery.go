@@ -0,0 +1,75 @@
+package graphql
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+// recurringActivitiesQuery resolves a query for member recurring activities
+var recurringActivitiesQuery = &graphql.Field{
+	Description: "Fetches the list of recurring activities set up by the member",
+	Type:        graphql.NewList(recurringActivityType),
+	Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+
+		// Extract member id from the token, available thus:
+		token := p.Info.VariableValues["token"]
+		at, err := memberToken(token.(string))
+		if err != nil {
+			return nil, err
+		}
+		memberID := at.Claims.ID
+
+		return recurringActivities(memberID)
+	},
+}
+
+// recurringActivityType defines fields for a member recurring activity
+var recurringActivityType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "recurringActivityData",
+	Description: "An activity that the member undertakes on a regular schedule, from which activity records are created.",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:        graphql.String,
+			Description: "ID of the recurring activity.",
+		},
+		"activityId": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The id of the activity.",
+		},
+		"typeId": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "Activity type ID.",
+		},
+		"quantity": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Quantity, generally number of hours, recorded for each occurrence",
+		},
+		"description": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Descriptive details about the activity, supplied by the Member.",
+		},
+		"type": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Original schedule of daily, weekly or monthly - superseded by rule.",
+		},
+		"rule": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Recurrence rule (RRULE), eg 'FREQ=WEEKLY;INTERVAL=2;BYDAY=TU'.",
+		},
+		"start": &graphql.Field{
+			Type:        graphql.String,
+			Description: "The date of the first occurrence, format 'YYYY-MM-DD'.",
+		},
+		"next": &graphql.Field{
+			Type:        graphql.String,
+			Description: "The date of the next occurrence to be recorded or skipped, format 'YYYY-MM-DD'.",
+		},
+		"done": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "A flag that indicates there are no more occurrences.",
+		},
+		"autoRecord": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "A flag that indicates due occurrences are recorded automatically.",
+		},
+	},
+})
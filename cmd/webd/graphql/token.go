@@ -1,45 +1,22 @@
 package graphql
 
 import (
-	"os"
-	"strconv"
+	"errors"
 
 	"github.com/cardiacsociety/web-services/internal/platform/jwt"
-	"github.com/pkg/errors"
 )
 
-// freshToken will validate a JWT, and return a fresh token if all ok
-func freshToken(currentToken string) (string, error) {
+// memberToken decodes an access token, checks that it has not been revoked, and that it belongs to a member. The
+// GraphQL queries and mutations act on the member identified by the token, so other roles are rejected.
+func memberToken(token string) (jwt.Token, error) {
 
-	iss := os.Getenv("MAPPCPD_API_URL")
-	key := os.Getenv("MAPPCPD_JWT_SIGNING_KEY")
-	ttl, err := strconv.Atoi(os.Getenv("MAPPCPD_JWT_TTL_HOURS"))
+	at, err := memberToken(token)
 	if err != nil {
-		return "", errors.Wrap(err, "Could not convert hours string to int")
+		return at, err
 	}
-
-	// Validate current token
-	ct, err := jwt.Decode(currentToken, key)
-	if err != nil {
-		return "", errors.New("Cannot refresh token as current token is invalid: - " + err.Error())
-	}
-
-	// Make sure the current token has "member" role
-	if ct.Claims.Role != "member" {
-		return "", errors.New("Cannot refresh non-member token")
-	}
-
-	// custom claims
-	c := map[string]interface{}{
-		"id":   ct.Claims.ID,
-		"name": ct.Claims.Name,
-		"role": ct.Claims.Role,
-	}
-
-	t, err := jwt.New(iss, key, ttl).CustomClaims(c).Encode()
-	if err != nil {
-		return "", errors.New("Error creating new token -  " + err.Error())
+	if at.Claims.Role != "member" {
+		return at, errors.New("Token does not belong to a member")
 	}
 
-	return t.Encoded, nil
+	return at, nil
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/cardiacsociety/web-services/internal/platform/s3"
 	"github.com/gorilla/mux"
 	"github.com/imdario/mergo"
+	"github.com/pkg/errors"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -22,7 +23,7 @@ import (
 // Activities fetches list of activity types
 func Activities(w http.ResponseWriter, _ *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	al, err := activity.All(DS)
 	if err != nil {
@@ -44,7 +45,7 @@ func Activities(w http.ResponseWriter, _ *http.Request) {
 // ActivitiesID fetches a single activity type by ID
 func ActivitiesID(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Request - convert id from string to int type
 	v := mux.Vars(r)
@@ -72,7 +73,7 @@ func ActivitiesID(w http.ResponseWriter, r *http.Request) {
 // MembersActivitiesID fetches a single activity record by id
 func MembersActivitiesID(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Request - convert id from string to int type
 	v := mux.Vars(r)
@@ -95,7 +96,7 @@ func MembersActivitiesID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorization - need  owner of the record
-	if UserAuthToken.Claims.ID != a.MemberID {
+	if authToken(r).Claims.ID != a.MemberID {
 		p.Message = Message{http.StatusUnauthorized, "failed", "Encoded does not belong to the owner of resource"}
 		p.Send(w)
 		return
@@ -110,11 +111,11 @@ func MembersActivitiesID(w http.ResponseWriter, r *http.Request) {
 // MembersActivitiesAdd adds a new activity for the logged in member
 func MembersActivitiesAdd(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Decode JSON body into ActivityAttachment value
 	a := cpd.Input{}
-	a.MemberID = UserAuthToken.Claims.ID
+	a.MemberID = authToken(r).Claims.ID
 	err := json.NewDecoder(r.Body).Decode(&a)
 	if err != nil {
 		msg := "Error decoding JSON: " + err.Error() + ". Decode the format of request body."
@@ -139,19 +140,72 @@ func MembersActivitiesAdd(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg := fmt.Sprintf("Added a new activity (id: %v) for member (id: %v)", aid, UserAuthToken.Claims.ID)
+	msg := fmt.Sprintf("Added a new activity (id: %v) for member (id: %v)", aid, authToken(r).Claims.ID)
 	p.Message = Message{http.StatusCreated, "success", msg}
 	p.Data = ar
 	p.Send(w)
 }
 
+// MembersActivitiesImport imports activity for the logged in member from a CSV or XLSX file in the
+// request body. Use ?format=xlsx for excel files, and ?dryrun=true to validate without saving.
+func MembersActivitiesImport(w http.ResponseWriter, r *http.Request) {
+	id := authToken(r).Claims.ID
+	importActivities(w, r, id, cpd.MemberEditor(id))
+}
+
+// AdminActivitiesImport imports activity for many members from a CSV or XLSX file in the request body,
+// which must include a memberId column. Accepts the same query parameters as MembersActivitiesImport.
+func AdminActivitiesImport(w http.ResponseWriter, r *http.Request) {
+	importActivities(w, r, 0, cpd.AdminEditor(authToken(r).Claims.ID))
+}
+
+// importActivities parses and imports the rows, for memberID if > 0
+func importActivities(w http.ResponseWriter, r *http.Request, memberID int, e cpd.Editor) {
+
+	p := NewResponder()
+
+	var rows []cpd.ImportRow
+	var err error
+	switch r.URL.Query().Get("format") {
+	case "", "csv":
+		rows, err = cpd.ParseCSV(r.Body)
+	case "xlsx":
+		rows, err = cpd.ParseXLSX(r.Body)
+	default:
+		err = fmt.Errorf("format should be csv or xlsx")
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Could not read import file - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dryrun") == "true"
+	rows = cpd.Import(DS, rows, memberID, e, dryRun)
+
+	// count rows by status
+	m := make(map[string]interface{})
+	m["count"] = len(rows)
+	m["dryRun"] = dryRun
+	for _, row := range rows {
+		n, _ := m[row.Status].(int)
+		m[row.Status] = n + 1
+	}
+
+	p.Meta = m
+	p.Message = Message{http.StatusOK, "success", "Check data field for the outcome of each row"}
+	p.Data = rows
+	p.Send(w)
+}
+
 // MembersActivitiesUpdate updates an existing activity for the logged in member.
 // First we fetch the existing record into an Activity, and then replace the update fields with
 // new values - this will be validated in the same way as a new activity and can also
 // update one to many fields.
 func MembersActivitiesUpdate(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Get activity id from path... and make it an int
 	v := mux.Vars(r)
@@ -174,7 +228,7 @@ func MembersActivitiesUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorization - need  owner of the record
-	if UserAuthToken.Claims.ID != a.MemberID {
+	if authToken(r).Claims.ID != a.MemberID {
 		p.Message = Message{http.StatusUnauthorized, "failed", "Encoded does not belong to the owner of resource"}
 		p.Send(w)
 		return
@@ -216,6 +270,11 @@ func MembersActivitiesUpdate(w http.ResponseWriter, r *http.Request) {
 
 	// Update the activity record
 	err = cpd.Update(DS, na)
+	if errors.Cause(err) == cpd.ErrActivityNotFound {
+		p.Message = Message{http.StatusNotFound, "failure", err.Error()}
+		p.Send(w)
+		return
+	}
 	if err != nil {
 		p.Message = Message{http.StatusInternalServerError, "failure", err.Error()}
 		p.Send(w)
@@ -231,18 +290,100 @@ func MembersActivitiesUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg := fmt.Sprintf("Updated activity (id: %v) for member (id: %v)", id, UserAuthToken.Claims.ID)
+	msg := fmt.Sprintf("Updated activity (id: %v) for member (id: %v)", id, authToken(r).Claims.ID)
 	p.Message = Message{http.StatusOK, "success", msg}
 	p.Data = ur
 	p.Send(w)
 }
 
+// MembersActivitiesHistory fetches the change history of an activity record owned by the logged in member,
+// including records that have been deleted
+func MembersActivitiesHistory(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	v := mux.Vars(r)
+	id, err := strconv.Atoi(v["id"])
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	xc, err := cpd.History(DS, id)
+	if err != nil {
+		p.Message = Message{http.StatusInternalServerError, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+	if len(xc) == 0 {
+		msg := fmt.Sprintf("No history found for activity id %d", id)
+		p.Message = Message{http.StatusNotFound, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	// Authorization - need owner of the record
+	if authToken(r).Claims.ID != xc[0].MemberID {
+		p.Message = Message{http.StatusUnauthorized, "failed", "Encoded does not belong to the owner of resource"}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Data retrieved from ???"}
+	p.Data = xc
+	m := make(map[string]interface{})
+	m["count"] = len(xc)
+	p.Meta = m
+	p.Send(w)
+}
+
+// AdminActivitiesRestore restores a deleted activity record
+func AdminActivitiesRestore(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	v := mux.Vars(r)
+	id, err := strconv.Atoi(v["id"])
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	err = cpd.Restore(DS, id, cpd.AdminEditor(authToken(r).Claims.ID))
+	if errors.Cause(err) == cpd.ErrActivityNotFound {
+		msg := fmt.Sprintf("No deleted activity found with id %d", id)
+		p.Message = Message{http.StatusNotFound, "failed", msg}
+		p.Send(w)
+		return
+	}
+	if err != nil {
+		p.Message = Message{http.StatusInternalServerError, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	a, err := cpd.ByID(DS, id)
+	if err != nil {
+		msg := "Could not fetch the restored record"
+		p.Message = Message{http.StatusInternalServerError, "failed", msg + " " + err.Error()}
+		p.Send(w)
+		return
+	}
+
+	msg := fmt.Sprintf("Restored activity (id: %v) for member (id: %v)", id, a.MemberID)
+	p.Message = Message{http.StatusOK, "success", msg}
+	p.Data = a
+	p.Send(w)
+}
+
 // MembersActivitiesRecurring fetches the member's recurring activities (if any) stored in MongoDB
-func MembersActivitiesRecurring(w http.ResponseWriter, _ *http.Request) {
+func MembersActivitiesRecurring(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
-	ra, err := cpd.MemberRecurring(DS, UserAuthToken.Claims.ID)
+	ra, err := cpd.MemberRecurring(DS, authToken(r).Claims.ID)
 	if err != nil {
 		p.Message = Message{http.StatusInternalServerError, "failed", "Failed to initialise a value of type MemberRecurring -" + err.Error()}
 		p.Send(w)
@@ -256,13 +397,14 @@ func MembersActivitiesRecurring(w http.ResponseWriter, _ *http.Request) {
 }
 
 // MembersActivitiesRecurringAdd adds a new recurring activity to the array in the Recurring doc that belongs to the member.
-// Note that this function reads and writes only to MongoDB
+// Note that this function reads and writes only to MongoDB. The recurrence is an RRULE in the rule field, eg
+// "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;UNTIL=20181231", or a type of daily, weekly or monthly.
 func MembersActivitiesRecurringAdd(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Get user id from token
-	id := UserAuthToken.Claims.ID
+	id := authToken(r).Claims.ID
 
 	// Fetch the recurring activity doc for this user first
 	ra, err := cpd.MemberRecurring(DS, id)
@@ -285,6 +427,16 @@ func MembersActivitiesRecurringAdd(w http.ResponseWriter, r *http.Request) {
 		p.Send(w)
 		return
 	}
+	if b.Start.IsZero() {
+		b.Start = b.Next
+	}
+	err = b.Validate()
+	if err != nil {
+		msg := "MembersActivitiesRecurringAdd() invalid recurring activity - " + err.Error()
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
 	b.ID = bson.NewObjectId()
 	b.CreatedAt = time.Now()
 	b.UpdatedAt = time.Now()
@@ -310,10 +462,10 @@ func MembersActivitiesRecurringAdd(w http.ResponseWriter, r *http.Request) {
 // doc in the collection, only one element from the array of recurring activities in the doc that belongs to the member
 func MembersActivitiesRecurringRemove(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Get user id from token
-	id := UserAuthToken.Claims.ID
+	id := authToken(r).Claims.ID
 
 	// Fetch the recurring activity doc for this user first
 	ra, err := cpd.MemberRecurring(DS, id)
@@ -355,7 +507,7 @@ func MembersActivitiesRecurringRecorder(w http.ResponseWriter, r *http.Request)
 	// Get the member's recurring activities. Strictly speaking we don't need the member id to do this
 	// as we can select the document based on the recurring activity id. However, this ensures that the recurring
 	// activity belongs to the member - however slim the chances of guessing an ObjectID!
-	id := UserAuthToken.Claims.ID
+	id := authToken(r).Claims.ID
 	ra, err := cpd.MemberRecurring(DS, id)
 	if err != nil {
 		msg := "MembersActivitiesRecurringAdd() Failed to initialise a value of type Recurring -" + err.Error()
@@ -391,10 +543,155 @@ func MembersActivitiesRecurringRecorder(w http.ResponseWriter, r *http.Request)
 	p.Send(w)
 }
 
+// MembersActivitiesRecurringMissed lists the missed occurrences of a recurring activity, from next up to today,
+// so the member can choose which to record or skip
+func MembersActivitiesRecurringMissed(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	ra, err := cpd.MemberRecurring(DS, authToken(r).Claims.ID)
+	if err != nil {
+		msg := "MembersActivitiesRecurringMissed() Failed to initialise a value of type Recurring -" + err.Error()
+		p.Message = Message{http.StatusInternalServerError, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	_id := mux.Vars(r)["_id"]
+	_, err = ra.GetActivity(_id)
+	if err != nil {
+		p.Message = Message{http.StatusNotFound, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	xo, err := ra.Missed(DS, _id, time.Now())
+	if err != nil {
+		p.Message = Message{recurringErrorStatus(err), "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Data retrieved from ???"}
+	p.Meta = map[string]int{"count": len(xo)}
+	p.Data = xo
+	p.Send(w)
+}
+
+// MembersActivitiesRecurringCatchUp records and skips missed occurrences of a recurring activity in one request,
+// with a body like {"record": ["2018-01-02", "2018-01-09"], "skip": ["2018-01-16"]}
+func MembersActivitiesRecurringCatchUp(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	ra, err := cpd.MemberRecurring(DS, authToken(r).Claims.ID)
+	if err != nil {
+		msg := "MembersActivitiesRecurringCatchUp() Failed to initialise a value of type Recurring -" + err.Error()
+		p.Message = Message{http.StatusInternalServerError, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	var body struct {
+		Record []string `json:"record"`
+		Skip   []string `json:"skip"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := "MembersActivitiesRecurringCatchUp() failed to decode body -" + err.Error()
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	_id := mux.Vars(r)["_id"]
+	_, err = ra.GetActivity(_id)
+	if err != nil {
+		p.Message = Message{http.StatusNotFound, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	xr, err := ra.CatchUp(DS, _id, body.Record, body.Skip, time.Now())
+	if err != nil {
+		p.Message = Message{recurringErrorStatus(err), "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	// collect the outcome for each occurrence as a message
+	messages := []string{}
+	for _, res := range xr {
+		messages = append(messages, res.String())
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Check meta for the outcome of each occurrence"}
+	p.Meta = map[string]interface{}{"count": len(xr), "messages": messages}
+	p.Data = ra
+	p.Send(w)
+}
+
+// recurringErrorStatus returns the response status for an error from Missed or CatchUp - a bad request for an
+// occurrence that is not valid, otherwise a server error
+func recurringErrorStatus(err error) int {
+	if _, ok := err.(cpd.OccurrenceError); ok {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// MembersActivitiesRecurringAutoRecord switches auto-record mode on or off for a recurring activity, with a body
+// like {"autoRecord": true}. In auto-record mode due occurrences are recorded by the scheduler (recordr).
+func MembersActivitiesRecurringAutoRecord(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	ra, err := cpd.MemberRecurring(DS, authToken(r).Claims.ID)
+	if err != nil {
+		msg := "MembersActivitiesRecurringAutoRecord() Failed to initialise a value of type Recurring -" + err.Error()
+		p.Message = Message{http.StatusInternalServerError, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	var body struct {
+		AutoRecord bool `json:"autoRecord"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := "MembersActivitiesRecurringAutoRecord() failed to decode body -" + err.Error()
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	_id := mux.Vars(r)["_id"]
+	a, err := ra.GetActivity(_id)
+	if err != nil {
+		p.Message = Message{http.StatusNotFound, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+	a.AutoRecord = body.AutoRecord
+	a.UpdatedAt = time.Now()
+	err = ra.UpdateActivity(DS, a)
+	if err != nil {
+		msg := "MembersActivitiesRecurringAutoRecord() failed to save the recurring activity -" + err.Error()
+		p.Message = Message{http.StatusInternalServerError, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Data retrieved from ???"}
+	p.Meta = map[string]int{"count": len(ra.Activities)}
+	p.Data = ra
+	p.Send(w)
+}
+
 // MembersActivitiesAttachmentRequest handles request for a signed URL to upload an attachment for a CPD activity
 func MembersActivitiesAttachmentRequest(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	upload := struct {
 		SignedRequest  string `json:"signedRequest"`
@@ -437,7 +734,7 @@ func MembersActivitiesAttachmentRequest(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Authorization - need  owner of the record
-	if UserAuthToken.Claims.ID != a.MemberID {
+	if authToken(r).Claims.ID != a.MemberID {
 		p.Message = Message{http.StatusUnauthorized, "failed", "Encoded does not belong to the owner of resource"}
 		p.Send(w)
 		return
@@ -476,11 +773,11 @@ func MembersActivitiesAttachmentRequest(w http.ResponseWriter, r *http.Request)
 // MembersActivitiesAttachmentRegister registers an uploaded file in the database.
 func MembersActivitiesAttachmentRegister(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	a := attachments.New()
 	// not required for this type of attachment but stick it on for good measure :)
-	a.UserID = UserAuthToken.Claims.ID
+	a.UserID = authToken(r).Claims.ID
 
 	// Get the entity ID from URL path... This is admin so validate record exists but not ownership
 	v := mux.Vars(r)
@@ -508,7 +805,7 @@ func MembersActivitiesAttachmentRegister(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	// CHECK OWNER!!
-	if UserAuthToken.Claims.ID != activity.MemberID {
+	if authToken(r).Claims.ID != activity.MemberID {
 		p.Message = Message{http.StatusUnauthorized, "failed", "Encoded does not belong to the owner of this resource"}
 		p.Data = a
 		p.Send(w)
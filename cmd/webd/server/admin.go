@@ -4,11 +4,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	uuid "github.com/hashicorp/go-uuid"
@@ -16,6 +18,7 @@ import (
 
 	"github.com/cardiacsociety/web-services/internal/application"
 	"github.com/cardiacsociety/web-services/internal/attachments"
+	"github.com/cardiacsociety/web-services/internal/cpd"
 	"github.com/cardiacsociety/web-services/internal/fileset"
 	"github.com/cardiacsociety/web-services/internal/generic"
 	"github.com/cardiacsociety/web-services/internal/invoice"
@@ -23,6 +26,7 @@ import (
 	"github.com/cardiacsociety/web-services/internal/note"
 	"github.com/cardiacsociety/web-services/internal/notification"
 	"github.com/cardiacsociety/web-services/internal/payment"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
 	"github.com/cardiacsociety/web-services/internal/platform/s3"
 	"github.com/cardiacsociety/web-services/internal/position"
 	"github.com/cardiacsociety/web-services/internal/resource"
@@ -31,7 +35,7 @@ import (
 // AdminTest is a test endpoint
 func AdminTest(w http.ResponseWriter, _ *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 	p.Message = Message{http.StatusOK, "success", "Hi Admin!"}
 	p.Send(w)
 }
@@ -44,7 +48,7 @@ func AdminTest(w http.ResponseWriter, _ *http.Request) {
 // API is for DB access at this stage.
 func AdminMembersSearch(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	var err error
 	var query map[string]interface{}
@@ -92,7 +96,7 @@ func AdminMembersSearchPost(w http.ResponseWriter, r *http.Request) {
 		Query map[string]interface{} `json:"query"`
 	}
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Pull the JSON body out of the request
 	decoder := json.NewDecoder(r.Body)
@@ -124,7 +128,7 @@ func AdminMembersSearchPost(w http.ResponseWriter, r *http.Request) {
 // AdminMembersNotes fetches all Notes belonging to a Member
 func AdminMembersNotes(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Request - convert id from string to int type
 	v := mux.Vars(r)
@@ -151,7 +155,7 @@ func AdminMembersNotes(w http.ResponseWriter, r *http.Request) {
 // AdminNotes fetches a single Note record by Note ID
 func AdminNotes(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Request - convert id from string to int type
 	v := mux.Vars(r)
@@ -178,7 +182,7 @@ func AdminNotes(w http.ResponseWriter, r *http.Request) {
 // AdminMembersID fetches a member record from the MySQLConnection DB, by id
 func AdminMembersID(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Request - convert id from string to int type
 	v := mux.Vars(r)
@@ -207,24 +211,54 @@ func AdminMembersID(w http.ResponseWriter, r *http.Request) {
 	p.Send(w)
 }
 
-// AdminIDList fetches a list of all member ids from MySQL
+// AdminIDList fetches a list of all ids from a MySQL table. The table is specified with ?t=[table_name], and
+// the ids can be filtered with &active=[0|1] and &updatedSince=[yyyy-mm-dd].
 func AdminIDList(w http.ResponseWriter, req *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Request - requires at least the 't' query to specify the table name
-	// and can have the option 'f' as raw HTML filter
 	t := req.FormValue("t")
 	if t == "" {
-		p.Message = Message{http.StatusBadRequest, "failed", "Requires ?t=[table_name], optional &f=[sql_filter]"}
+		p.Message = Message{http.StatusBadRequest, "failed", "Requires ?t=[table_name], optional &active=[0|1], &updatedSince=[yyyy-mm-dd]"}
 		p.Send(w)
 		return
 	}
 
-	// Optional filter
-	f := req.FormValue("f")
+	if err := datastore.CheckIdentifier(t); err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
 
-	// Get the Member record
+	// raw sql filters are no longer accepted
+	if req.FormValue("f") != "" {
+		p.Message = Message{http.StatusBadRequest, "failed", "The f parameter is not supported, use &active=[0|1] or &updatedSince=[yyyy-mm-dd]"}
+		p.Send(w)
+		return
+	}
+
+	// Optional filters
+	f := datastore.NewFilter()
+	if a := req.FormValue("active"); a != "" {
+		active, err := strconv.ParseBool(a)
+		if err != nil {
+			p.Message = Message{http.StatusBadRequest, "failed", "active must be 0 or 1"}
+			p.Send(w)
+			return
+		}
+		f.Equal("active", active)
+	}
+	if u := req.FormValue("updatedSince"); u != "" {
+		if _, err := time.Parse("2006-01-02", u); err != nil {
+			p.Message = Message{http.StatusBadRequest, "failed", "updatedSince must be a date, yyyy-mm-dd"}
+			p.Send(w)
+			return
+		}
+		f.GreaterEq("updated_at", u)
+	}
+
+	// Get the ids
 	ii, err := generic.GetIDs(DS, t, f)
 	// Response
 	switch {
@@ -252,7 +286,7 @@ func AdminBatchResourcesPost(w http.ResponseWriter, r *http.Request) {
 	}
 	b := batch{}
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Pull the JSON body out of the request
 	decoder := json.NewDecoder(r.Body)
@@ -304,7 +338,7 @@ func AdminBatchResourcesPost(w http.ResponseWriter, r *http.Request) {
 // AdminNotesAttachmentRequest handles a request for a signed url to upload a notes attachment
 func AdminNotesAttachmentRequest(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	upload := struct {
 		SignedRequest  string `json:"signedRequest"`
@@ -379,10 +413,10 @@ func AdminNotesAttachmentRequest(w http.ResponseWriter, r *http.Request) {
 // AdminNotesAttachmentRegister registers a file attachment for a note.
 func AdminNotesAttachmentRegister(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	a := attachments.New()
-	a.UserID = UserAuthToken.Claims.ID
+	a.UserID = authToken(r).Claims.ID
 
 	// Get the entity ID from URL path... This is admin so validate record exists but not ownership
 	v := mux.Vars(r)
@@ -440,7 +474,7 @@ func AdminNotesAttachmentRegister(w http.ResponseWriter, r *http.Request) {
 // AdminResourcesAttachmentRequest handles a request for a signed url to upload a resource attachment
 func AdminResourcesAttachmentRequest(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	upload := struct {
 		SignedRequest  string `json:"signedRequest"`
@@ -516,10 +550,10 @@ func AdminResourcesAttachmentRequest(w http.ResponseWriter, r *http.Request) {
 // url then the resource file is designated as a thumbnail by setting thumbnail flag to 1 in db.
 func AdminResourcesAttachmentRegister(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	a := attachments.New()
-	a.UserID = UserAuthToken.Claims.ID
+	a.UserID = authToken(r).Claims.ID
 
 	// Get the entity ID from URL path... This is admin so validate record exists but not ownership
 	v := mux.Vars(r)
@@ -583,7 +617,7 @@ func AdminResourcesAttachmentRegister(w http.ResponseWriter, r *http.Request) {
 // AdminReportApplicationExcel responds with an excel application report
 func AdminReportApplicationExcel(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// A list of application ids should be posted in
 	var applicationIDs []int
@@ -622,7 +656,7 @@ func AdminReportApplicationExcel(w http.ResponseWriter, r *http.Request) {
 // AdminReportMemberExcel responds with an excel member report
 func AdminReportMemberExcel(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// A list of member ids should be posted in
 	var memberIDs []int
@@ -677,7 +711,7 @@ func AdminReportMemberExcel(w http.ResponseWriter, r *http.Request) {
 // It is used as a report for journal recipients.
 func AdminReportMemberJournalExcel(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	var memberIDs []int
 	err := json.NewDecoder(r.Body).Decode(&memberIDs)
@@ -716,7 +750,7 @@ func AdminReportMemberJournalExcel(w http.ResponseWriter, r *http.Request) {
 // AdminReportPaymentExcel responds with an excel payment report
 func AdminReportPaymentExcel(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// A list of payments ids should be posted in
 	var paymentIDs []int
@@ -755,7 +789,7 @@ func AdminReportPaymentExcel(w http.ResponseWriter, r *http.Request) {
 // AdminReportInvoiceExcel responds with an excel invoice report
 func AdminReportInvoiceExcel(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// A list of invoice ids should be posted in
 	var invoiceIDs []int
@@ -794,7 +828,7 @@ func AdminReportInvoiceExcel(w http.ResponseWriter, r *http.Request) {
 // AdminReportPositionExcel responds with an excel position report
 func AdminReportPositionExcel(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// A list of member position ids should be posted in
 	var positionIDs []int
@@ -830,9 +864,53 @@ func AdminReportPositionExcel(w http.ResponseWriter, r *http.Request) {
 	}()
 }
 
+// AdminReportCPDCohortExcel responds with an excel, and a JSON, report of the current evaluation period for
+// all active members, optionally filtered by membership title and speciality
+func AdminReportCPDCohortExcel(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	// An optional filter can be posted in, eg {"titleIds": [1, 2], "specialityIds": [3]}
+	var filter cpd.CohortFilter
+	err := json.NewDecoder(r.Body).Decode(&filter)
+	if err != nil && err != io.EOF {
+		msg := fmt.Sprintf("Could not decode filter in body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	// send 202 now, before the heavy lifting starts
+	cacheID, _ := uuid.GenerateUUID()
+	jsonCacheID, _ := uuid.GenerateUUID()
+	msg := fmt.Sprintf("Report has been queued, pickup urls below")
+	p.Message = Message{http.StatusAccepted, "accepted", msg}
+	p.Data = map[string]string{
+		"url":     os.Getenv("MAPPCPD_API_URL") + "/v1/r/excel/" + cacheID,
+		"jsonUrl": os.Getenv("MAPPCPD_API_URL") + "/v1/a/reports/json/" + jsonCacheID,
+	}
+	p.Send(w)
+
+	// generate the report
+	go func() {
+		xr, err := cpd.CohortReport(DS, filter)
+		if err != nil {
+			log.Printf(fmt.Sprintf("cpd.CohortReport() err = %s\n", err))
+		}
+
+		excelFile, err := cpd.CohortExcelReport(xr)
+		if err != nil {
+			log.Printf(fmt.Sprintf("cpd.CohortExcelReport() err = %s\n", err))
+		}
+
+		DS.Cache.SetDefault(jsonCacheID, xr)
+		DS.Cache.SetDefault(cacheID, excelFile)
+	}()
+}
+
 // AdminNewMembershipApplication processes a request to create a new membership application
 func AdminNewMembershipApplication(w http.ResponseWriter, r *http.Request) {
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	xb, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -843,6 +921,13 @@ func AdminNewMembershipApplication(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data, err := member.InsertRowFromJSON(DS, string(xb))
+	if ve, ok := err.(member.ValidationError); ok {
+		msg := fmt.Sprintf("Application section '%s' failed validation - %s", ve.Section, ve.Message)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Data = ve
+		p.Send(w)
+		return
+	}
 	if err != nil {
 		msg := fmt.Sprintf("Could not create records from request body - %s", err)
 		p.Message = Message{http.StatusInternalServerError, "failed", msg}
@@ -855,13 +940,17 @@ func AdminNewMembershipApplication(w http.ResponseWriter, r *http.Request) {
 	p.Send(w)
 }
 
-// AdminLapseMembers processes a request to lapse members
-func AdminLapseMembers(w http.ResponseWriter, r *http.Request) {
-	p := NewResponder(UserAuthToken.Encoded)
+// AdminMembersStatus changes the membership status of one or more members, with a body like
+// {"memberIds": [1, 2], "status": "lapsed", "effective": "2019-01-31", "reason": "Unpaid subscription"}.
+// Each change is checked against the allowed status transitions for the member's current status.
+func AdminMembersStatus(w http.ResponseWriter, r *http.Request) {
+	p := NewResponder()
 
-	// body should be a JSON array of member ids
-	memberIDs := []int{}
-	err := json.NewDecoder(r.Body).Decode(&memberIDs)
+	var body struct {
+		MemberIDs []int `json:"memberIds"`
+		member.StatusChange
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		msg := fmt.Sprintf("Could not read request body - %s", err)
 		p.Message = Message{http.StatusBadRequest, "failed", msg}
@@ -869,23 +958,66 @@ func AdminLapseMembers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = body.StatusChange.Validate(time.Now())
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
 	// collect any errors as a message
 	messages := []string{}
-	// lapse each of the ids
-	for _, id := range memberIDs {
+	for _, id := range body.MemberIDs {
 		m, err := member.ByID(DS, id)
 		if err != nil {
 			messages = append(messages, fmt.Sprintf("Could not get member id %v", id))
 			continue
 		}
-		if err := m.Lapse(DS); err != nil {
-			messages = append(messages, fmt.Sprintf("Error lapsing member id %v - %s", id, err))
+		if err := m.ChangeStatus(DS, body.StatusChange); err != nil {
+			messages = append(messages, fmt.Sprintf("Error changing status of member id %v - %s", id, err))
 			continue
 		}
-		messages = append(messages, fmt.Sprintf("Successfully lapsed member id %v", id))
+		messages = append(messages, fmt.Sprintf("Successfully changed status of member id %v to %s", id, body.Status))
+	}
+
+	p.Meta = map[string]int{"count": len(body.MemberIDs)}
+	p.Message = Message{http.StatusOK, "success", "Check data field for any errors"}
+	p.Data = messages
+	p.Send(w)
+}
+
+// AdminEvaluationRollover closes all open member evaluation periods ending before a date, and opens
+// the successor period for each member
+func AdminEvaluationRollover(w http.ResponseWriter, r *http.Request) {
+	p := NewResponder()
+
+	// body should be a JSON object with the cut-off date, eg {"endBefore": "2019-01-01"}
+	var body struct {
+		EndBefore string `json:"endBefore"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	results, err := cpd.RolloverPeriods(DS, body.EndBefore)
+	if err != nil {
+		msg := fmt.Sprintf("Could not roll over evaluation periods - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	// collect the outcome for each member as a message
+	messages := []string{}
+	for _, res := range results {
+		messages = append(messages, res.String())
 	}
 
-	p.Meta = map[string]int{"count": len(memberIDs)}
+	p.Meta = map[string]int{"count": len(results)}
 	p.Message = Message{http.StatusOK, "success", "Check data field for any errors"}
 	p.Data = messages
 	p.Send(w)
@@ -893,7 +1025,7 @@ func AdminLapseMembers(w http.ResponseWriter, r *http.Request) {
 
 // AdminSendNotifications sends email notifications
 func AdminSendNotifications(w http.ResponseWriter, r *http.Request) {
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	type recipient struct {
 		Name  string `json:"name"`
@@ -934,16 +1066,20 @@ func AdminSendNotifications(w http.ResponseWriter, r *http.Request) {
 
 		em.ToName = to.Name
 		em.ToEmail = to.Email
-
-		go func(e notification.Email) {
-			err := e.Send()
-			if err != nil {
-				log.Printf("notification.Send() err = %s, sending to %s", err, e.ToEmail)
-			}
-		}(em)
+		sendNotification(em)
 	}
 
 	p.Meta = map[string]int{"recipients": len(body.Recipients)}
 	p.Message = Message{http.StatusAccepted, "success", "Notifications accepted for delivery"}
 	p.Send(w)
 }
+
+// sendNotification sends the email in the background, logging any error
+func sendNotification(em notification.Email) {
+	go func(e notification.Email) {
+		err := e.Send()
+		if err != nil {
+			log.Printf("notification.Send() err = %s, sending to %s", err, e.ToEmail)
+		}
+	}(em)
+}
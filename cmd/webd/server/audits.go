@@ -0,0 +1,236 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/hashicorp/go-uuid"
+
+	"github.com/cardiacsociety/web-services/internal/audit"
+)
+
+// MembersAudits fetches the audits of the logged in member's evaluation periods
+func MembersAudits(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	xa, err := audit.ByMemberID(DS, authToken(r).Claims.ID)
+	if err != nil {
+		p.Message = Message{http.StatusInternalServerError, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Data retrieved from ???"}
+	p.Data = xa
+	m := make(map[string]interface{})
+	m["count"] = len(xa)
+	p.Meta = m
+	p.Send(w)
+}
+
+// AdminAuditsSelect randomly selects member evaluation periods for audit. If a sender is included in the
+// body each selected member is notified by email.
+func AdminAuditsSelect(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	var body struct {
+		audit.Selection
+		audit.Sender
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	xa, err := audit.Select(DS, body.Selection)
+	if err != nil {
+		p.Message = Message{http.StatusInternalServerError, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	if body.Sender.Email != "" {
+		for _, a := range xa {
+			sendNotification(a.SelectedEmail(body.Sender))
+		}
+	}
+
+	msg := fmt.Sprintf("Selected %d evaluation periods for audit", len(xa))
+	p.Message = Message{http.StatusCreated, "success", msg}
+	p.Data = xa
+	m := make(map[string]interface{})
+	m["count"] = len(xa)
+	m["notified"] = body.Sender.Email != ""
+	p.Meta = m
+	p.Send(w)
+}
+
+// AdminAuditsID fetches an audit by id
+func AdminAuditsID(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	a, err := audit.ByID(DS, id)
+	switch {
+	case err == sql.ErrNoRows:
+		p.Message = Message{http.StatusNotFound, "failed", err.Error()}
+		p.Send(w)
+		return
+	case err != nil:
+		p.Message = Message{http.StatusInternalServerError, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Data retrieved from ???"}
+	p.Data = a
+	p.Send(w)
+}
+
+// AdminAuditsActivityVerify records the verification outcome for an audit activity, with a body like
+// {"status": "rejected", "reason": "No certificate attached"}
+func AdminAuditsActivityVerify(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	var body struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	v, err := audit.VerificationValue(body.Status)
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	err = audit.Verify(DS, id, v, body.Reason)
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	msg := fmt.Sprintf("Audit activity (id: %v) is %s", id, body.Status)
+	p.Message = Message{http.StatusOK, "success", msg}
+	p.Send(w)
+}
+
+// AdminAuditsComplete finalises an audit once every activity has been verified. If a sender is included in
+// the body the member is notified of the outcome by email.
+func AdminAuditsComplete(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	var body struct {
+		Comment string `json:"comment"`
+		audit.Sender
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil && err != io.EOF {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	a, err := audit.Complete(DS, id, body.Comment)
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	if body.Sender.Email != "" {
+		sendNotification(a.OutcomeEmail(body.Sender))
+	}
+
+	msg := fmt.Sprintf("Audit (id: %v) completed with result %s", id, a.Status)
+	p.Message = Message{http.StatusOK, "success", msg}
+	p.Data = a
+	p.Send(w)
+}
+
+// AdminReportAuditExcel generates an excel report of the audits of evaluation periods ending on or between
+// the dates in the body, eg {"from": "2018-01-01", "to": "2018-12-31"}
+func AdminReportAuditExcel(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	var body struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	// send 202 now, before the heavy lifting starts
+	cacheID, _ := uuid.GenerateUUID()
+	msg := fmt.Sprintf("Report has been queued, pickup url below")
+	p.Message = Message{http.StatusAccepted, "accepted", msg}
+	p.Data = map[string]string{
+		"url": os.Getenv("MAPPCPD_API_URL") + "/v1/r/excel/" + cacheID,
+	}
+	p.Send(w)
+
+	// generate the report
+	go func() {
+		xa, err := audit.ByPeriod(DS, body.From, body.To)
+		if err != nil {
+			log.Printf(fmt.Sprintf("audit.ByPeriod() err = %s\n", err))
+		}
+
+		excelFile, err := audit.ExcelReport(xa)
+		if err != nil {
+			log.Printf(fmt.Sprintf("audit.ExcelReport() err = %s\n", err))
+		}
+
+		DS.Cache.SetDefault(cacheID, excelFile)
+	}()
+}
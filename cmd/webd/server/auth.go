@@ -47,7 +47,7 @@ func AuthMemberLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	at, err := freshToken(id, name, "member")
+	at, err := issueTokens(id, name, "member")
 	if err != nil {
 		p.Message = Message{http.StatusInternalServerError, "failure", err.Error()}
 		p.Send(w)
@@ -75,7 +75,7 @@ func AuthMemberCheckHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jt, err := jwt.Decode(t, os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+	jt, err := auth.DecodeToken(DS, t)
 	if err != nil {
 		p.Message = Message{http.StatusUnauthorized, "failure", "Authorization failed: " + err.Error()}
 		p.Send(w)
@@ -87,55 +87,6 @@ func AuthMemberCheckHandler(w http.ResponseWriter, r *http.Request) {
 	p.Send(w)
 }
 
-// MembersToken handles a GET request which validates the current token
-// and issue a fresh one, so the consumer can update it at their end
-func MembersToken(w http.ResponseWriter, r *http.Request) {
-
-	p := NewResponder(UserAuthToken.Encoded)
-
-	// Get the token from the auth header, 'Bearer' seems useless but this is an OAuth2 standard
-	// Authorization: Bearer [jwt]
-	a := r.Header.Get("Authorization")
-	t, err := jwt.FromHeader(a)
-	if err != nil {
-		p.Message = Message{http.StatusBadRequest, "failure", err.Error()}
-		p.Send(w)
-		return
-	}
-
-	// Decode current token first
-	at, err := jwt.Decode(t, os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
-	if err != nil {
-		p.Message = Message{http.StatusUnauthorized, "failure", "Cannot refresh token as current token is invalid: " + err.Error()}
-		p.Send(w)
-		return
-	}
-
-	// Make sure the current token has "member" scope to prevent switch from admin token
-	if at.Claims.Role != "member" {
-		p.Message = Message{http.StatusUnauthorized, "failure", "Cannot refresh non-member token"}
-		p.Send(w)
-		return
-	}
-
-	nt, err := freshToken(at.Claims.ID, at.Claims.Name, at.Claims.Role)
-	if err != nil {
-		p.Message = Message{http.StatusInternalServerError, "failure", err.Error()}
-		p.Send(w)
-		return
-	}
-
-	// All clear
-	p.Message = Message{http.StatusOK, "success", "Current token is valid, fresh token supplied in data.new.token"}
-
-	// Data payload will contain the current and a fresh token
-	data := make(map[string]jwt.Token)
-	data["current"] = at
-	data["new"] = nt
-	p.Data = data
-	p.Send(w)
-}
-
 // AuthAdminLogin handles a authenticates an admin user by login and password, against
 // the db. Requires an explicit 'scope' property requesting admin access.
 func AuthAdminLogin(w http.ResponseWriter, r *http.Request) {
@@ -173,7 +124,7 @@ func AuthAdminLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	at, err := freshToken(id, name, "admin")
+	at, err := issueTokens(id, name, "admin")
 	if err != nil {
 		p.Message = Message{http.StatusInternalServerError, "failure", err.Error()}
 		p.Send(w)
@@ -186,52 +137,89 @@ func AuthAdminLogin(w http.ResponseWriter, r *http.Request) {
 	p.Send(w)
 }
 
-// AuthAdminRefreshHandler handles a GET request which validates the current token
-// and issues a fresh one so the consumer can extend validity to the maximum time.
-// The only difference between this func and GetAuthRefresh is the function call to set scope claims.
-func AuthAdminRefreshHandler(w http.ResponseWriter, r *http.Request) {
+// AuthRefresh exchanges a refresh token for a new access token and refresh token, body {"refreshToken": "..."}.
+// The refresh token can only be used once.
+func AuthRefresh(w http.ResponseWriter, r *http.Request) {
 
 	p := Payload{}
 
-	// Get the token from the auth header, 'Bearer' seems useless but this is an OAuth2 standard
-	// Authorization: Bearer [jwt]
-	a := r.Header.Get("Authorization")
-	t, err := jwt.FromHeader(a)
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		p.Message = Message{http.StatusBadRequest, "failure", err.Error()}
 		p.Send(w)
 		return
 	}
 
-	// Decode current token first
-	at, err := jwt.Decode(t, os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
-	if err != nil {
-		p.Message = Message{http.StatusUnauthorized, "failure", "Cannot refresh token as current token is invalid: " + err.Error()}
+	rf, rt, err := auth.RotateRefresh(DS, body.RefreshToken)
+	if err == auth.ErrInvalidRefresh {
+		p.Message = Message{http.StatusUnauthorized, "failure", err.Error()}
 		p.Send(w)
 		return
 	}
-
-	// Make sure the current token has admin scope to prevent a normal user token upgrading to admin!
-	if at.Claims.Role != "admin" {
-		p.Message = Message{http.StatusUnauthorized, "failure", "Cannot refresh non-admin token"}
+	if err != nil {
+		p.Message = Message{http.StatusInternalServerError, "failure", err.Error()}
 		p.Send(w)
 		return
 	}
 
-	nt, err := freshToken(at.Claims.ID, at.Claims.Name, "admin")
+	at, err := freshToken(rf.ID, rf.Name, rf.Role)
 	if err != nil {
 		p.Message = Message{http.StatusInternalServerError, "failure", err.Error()}
 		p.Send(w)
 		return
 	}
 
-	// All clear
-	p.Message = Message{http.StatusOK, "success", "Current token is valid, fresh token supplied in data.new.token"}
+	p.Message = Message{http.StatusOK, "success", "Fresh tokens issued"}
+	p.Data = tokens{at, rt, rf.ExpiresAt}
+	p.Send(w)
+}
+
+// AuthLogout revokes the access token in the Authorization header, if any, and the refresh token in the body,
+// {"refreshToken": "..."}, along with the other refresh tokens issued since the login.
+func AuthLogout(w http.ResponseWriter, r *http.Request) {
+
+	p := Payload{}
+
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			p.Message = Message{http.StatusBadRequest, "failure", err.Error()}
+			p.Send(w)
+			return
+		}
+	}
+
+	if a := r.Header.Get("Authorization"); a != "" {
+		t, err := jwt.FromHeader(a)
+		if err != nil {
+			p.Message = Message{http.StatusBadRequest, "failure", err.Error()}
+			p.Send(w)
+			return
+		}
+		// an invalid or expired token does not need to be revoked
+		at, err := jwt.Decode(t, os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+		if err == nil && at.Claims.Id != "" {
+			if err := auth.RevokeToken(DS, at.Claims.Id, at.ExpiresAt); err != nil {
+				p.Message = Message{http.StatusInternalServerError, "failure", err.Error()}
+				p.Send(w)
+				return
+			}
+		}
+	}
+
+	if body.RefreshToken != "" {
+		if err := auth.RevokeRefresh(DS, body.RefreshToken); err != nil {
+			p.Message = Message{http.StatusInternalServerError, "failure", err.Error()}
+			p.Send(w)
+			return
+		}
+	}
 
-	// Data payload will contain the current and a fresh token
-	data := make(map[string]jwt.Token)
-	data["current"] = at
-	data["new"] = nt
-	p.Data = data
+	p.Message = Message{http.StatusOK, "success", "Logged out"}
 	p.Send(w)
 }
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/cardiacsociety/web-services/internal/member"
+)
+
+// review is the request body for approving or rejecting a change set
+type review struct {
+	Comment string `json:"comment"`
+}
+
+// MembersChanges fetches the profile change sets submitted by the member
+func MembersChanges(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	xcs, err := member.ChangeSets(DS, bson.M{"memberId": authToken(r).Claims.ID})
+	if err != nil {
+		p.Message = Message{http.StatusInternalServerError, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Data retrieved from MongoDB"}
+	p.Meta = map[string]int{"count": len(xcs)}
+	p.Data = xcs
+	p.Send(w)
+}
+
+// MembersChangesAdd submits profile changes for the member, which are applied once approved by an admin
+func MembersChangesAdd(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	var c member.Changes
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	cs, err := member.SubmitChanges(DS, authToken(r).Claims.ID, c)
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Changes submitted for approval"}
+	p.Data = cs
+	p.Send(w)
+}
+
+// AdminChanges fetches member profile change sets with a status, ?status=pending (default), approved or rejected
+func AdminChanges(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	status := r.FormValue("status")
+	if status == "" {
+		status = member.ChangesPending
+	}
+
+	xcs, err := member.ChangeSets(DS, bson.M{"status": status})
+	if err != nil {
+		p.Message = Message{http.StatusInternalServerError, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Data retrieved from MongoDB"}
+	p.Meta = map[string]int{"count": len(xcs)}
+	p.Data = xcs
+	p.Send(w)
+}
+
+// AdminChangesID fetches a member profile change set
+func AdminChangesID(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	cs, err := member.ChangeSetByID(DS, mux.Vars(r)["_id"])
+	switch {
+	case err == mgo.ErrNotFound:
+		p.Message = Message{http.StatusNotFound, "failed", err.Error()}
+	case err != nil:
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+	default:
+		p.Message = Message{http.StatusOK, "success", "Data retrieved from MongoDB"}
+		p.Data = cs
+	}
+
+	p.Send(w)
+}
+
+// AdminChangesApprove applies a pending change set to the member record, with an optional body {"comment": "..."}
+func AdminChangesApprove(w http.ResponseWriter, r *http.Request) {
+	adminChangesReview(w, r, true)
+}
+
+// AdminChangesReject rejects a pending change set, with an optional body {"comment": "..."}
+func AdminChangesReject(w http.ResponseWriter, r *http.Request) {
+	adminChangesReview(w, r, false)
+}
+
+// adminChangesReview approves or rejects a change set
+func adminChangesReview(w http.ResponseWriter, r *http.Request, approve bool) {
+
+	p := NewResponder()
+
+	cs, err := member.ChangeSetByID(DS, mux.Vars(r)["_id"])
+	if err == mgo.ErrNotFound {
+		p.Message = Message{http.StatusNotFound, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	// body is optional
+	var b review
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			msg := fmt.Sprintf("Could not read request body - %s", err)
+			p.Message = Message{http.StatusBadRequest, "failed", msg}
+			p.Send(w)
+			return
+		}
+	}
+
+	if approve {
+		err = cs.Approve(DS, authToken(r).Claims.ID, b.Comment)
+	} else {
+		err = cs.Reject(DS, authToken(r).Claims.ID, b.Comment)
+	}
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	msg := fmt.Sprintf("Changes for member id %d %s", cs.MemberID, cs.Status)
+	p.Message = Message{http.StatusOK, "success", msg}
+	p.Data = cs
+	p.Send(w)
+}
+
+// AdminMembersUpdate applies profile changes to a member record straight away. The changes are recorded as a
+// change set approved by the admin making the request, once they have been applied.
+func AdminMembersUpdate(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	var c member.Changes
+	err = json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	cs, err := member.ApplyChanges(DS, id, c, authToken(r).Claims.ID, "Updated by admin")
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	msg := fmt.Sprintf("Member id %d updated", id)
+	p.Message = Message{http.StatusOK, "success", msg}
+	p.Data = cs
+	p.Send(w)
+}
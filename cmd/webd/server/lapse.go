@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/hashicorp/go-uuid"
+
+	"github.com/cardiacsociety/web-services/internal/lapse"
+)
+
+// AdminLapseCandidates lists the members with invoices overdue past a grace period, eg ?graceDays=30&asAt=2019-03-01
+func AdminLapseCandidates(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	c := lapse.Criteria{AsAt: r.FormValue("asAt")}
+	if v := r.FormValue("graceDays"); v != "" {
+		var err error
+		c.GraceDays, err = strconv.Atoi(v)
+		if err != nil {
+			p.Message = Message{http.StatusBadRequest, "failed", "graceDays should be a number of days"}
+			p.Send(w)
+			return
+		}
+	}
+
+	xc, err := lapse.Candidates(DS, c)
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Data retrieved from ???"}
+	p.Data = xc
+	m := make(map[string]interface{})
+	m["count"] = len(xc)
+	p.Meta = m
+	p.Send(w)
+}
+
+// AdminLapseConfirm lapses the reviewed lapse candidates, with a body like
+// {"graceDays": 30, "memberIds": [1, 2], "senderName": "Membership", "senderEmail": "members@test.com"}.
+// Members that are no longer candidates are not lapsed. If a sender is included each lapsed member is sent a notice.
+func AdminLapseConfirm(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	var body struct {
+		lapse.Criteria
+		lapse.Sender
+		MemberIDs []int `json:"memberIds"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	xr, err := lapse.Confirm(DS, body.Criteria, body.MemberIDs)
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	var lapsed int
+	for _, res := range xr {
+		if !res.Lapsed {
+			continue
+		}
+		lapsed++
+		if body.Sender.Email != "" {
+			sendNotification(res.NoticeEmail(body.Sender))
+		}
+	}
+
+	msg := fmt.Sprintf("Lapsed %d of %d members, check data field for any errors", lapsed, len(body.MemberIDs))
+	p.Message = Message{http.StatusOK, "success", msg}
+	p.Data = xr
+	m := make(map[string]interface{})
+	m["count"] = lapsed
+	m["notified"] = body.Sender.Email != ""
+	p.Meta = m
+	p.Send(w)
+}
+
+// AdminMembersReinstate reinstates a lapsed or resigned member, with a body like
+// {"subscriptionId": 1, "invoice": true, "dueDays": 14, "reason": "Paid in full"}. The data field reports what
+// was changed.
+func AdminMembersReinstate(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	var body lapse.Reinstatement
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+	body.MemberID = id
+
+	rd, err := lapse.Reinstate(DS, body)
+	p.Data = rd
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	msg := fmt.Sprintf("Member id %d reinstated", id)
+	p.Message = Message{http.StatusOK, "success", msg}
+	p.Send(w)
+}
+
+// AdminReportLapseExcel generates an excel report for reviewing lapse candidates, with a body like
+// {"graceDays": 30, "asAt": "2019-03-01"}
+func AdminReportLapseExcel(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	var c lapse.Criteria
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	// send 202 now, before the heavy lifting starts
+	cacheID, _ := uuid.GenerateUUID()
+	msg := fmt.Sprintf("Report has been queued, pickup url below")
+	p.Message = Message{http.StatusAccepted, "accepted", msg}
+	p.Data = map[string]string{
+		"url": os.Getenv("MAPPCPD_API_URL") + "/v1/r/excel/" + cacheID,
+	}
+	p.Send(w)
+
+	// generate the report
+	go func() {
+		xc, err := lapse.Candidates(DS, c)
+		if err != nil {
+			log.Printf(fmt.Sprintf("lapse.Candidates() err = %s\n", err))
+		}
+
+		excelFile, err := lapse.ExcelReport(xc)
+		if err != nil {
+			log.Printf(fmt.Sprintf("lapse.ExcelReport() err = %s\n", err))
+		}
+
+		DS.Cache.SetDefault(cacheID, excelFile)
+	}()
+}
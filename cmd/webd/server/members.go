@@ -16,12 +16,12 @@ import (
 )
 
 // MembersProfile fetches a member record by id
-func MembersProfile(w http.ResponseWriter, _ *http.Request) {
+func MembersProfile(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Get user id from token
-	id := UserAuthToken.Claims.ID
+	id := authToken(r).Claims.ID
 
 	// Get the Member record
 	m, err := member.ByID(DS, id)
@@ -44,11 +44,11 @@ func MembersProfile(w http.ResponseWriter, _ *http.Request) {
 }
 
 // MembersActivities fetches activity records for a member
-func MembersActivities(w http.ResponseWriter, _ *http.Request) {
+func MembersActivities(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
-	a, err := cpd.ByMemberID(DS, UserAuthToken.Claims.ID)
+	a, err := cpd.ByMemberID(DS, authToken(r).Claims.ID)
 
 	// Response
 	switch {
@@ -71,12 +71,12 @@ func MembersActivities(w http.ResponseWriter, _ *http.Request) {
 
 // MembersEvaluation created reports for each evaluation period
 // by gathering the CPD activities within the dates, adding them up, applying caps etc
-func MembersEvaluation(w http.ResponseWriter, _ *http.Request) {
+func MembersEvaluation(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// Collect the evaluation periods
-	es, err := cpd.MemberActivityReports(DS, UserAuthToken.Claims.ID)
+	es, err := cpd.MemberActivityReports(DS, authToken(r).Claims.ID)
 	// Response
 	switch {
 	case err == sql.ErrNoRows:
@@ -97,10 +97,10 @@ func MembersEvaluation(w http.ResponseWriter, _ *http.Request) {
 }
 
 // CurrentActivityReport
-func CurrentActivityReport(w http.ResponseWriter, _ *http.Request) {
+func CurrentActivityReport(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
-	reportData, err := cpd.CurrentEvaluationPeriodReport(DS, UserAuthToken.Claims.ID)
+	p := NewResponder()
+	reportData, err := cpd.CurrentEvaluationPeriodReport(DS, authToken(r).Claims.ID)
 	if err != nil {
 		p.Message = Message{http.StatusInternalServerError, "failed", err.Error()}
 		p.Send(w)
@@ -114,10 +114,10 @@ func CurrentActivityReport(w http.ResponseWriter, _ *http.Request) {
 }
 
 // EmailCurrentActivityReport
-func EmailCurrentActivityReport(w http.ResponseWriter, _ *http.Request) {
+func EmailCurrentActivityReport(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
-	reportData, err := cpd.CurrentEvaluationPeriodReport(DS, UserAuthToken.Claims.ID)
+	p := NewResponder()
+	reportData, err := cpd.CurrentEvaluationPeriodReport(DS, authToken(r).Claims.ID)
 	if err != nil {
 		p.Message = Message{http.StatusInternalServerError, "failed", err.Error()}
 		p.Send(w)
@@ -167,12 +167,12 @@ func EmailCurrentActivityReport(w http.ResponseWriter, _ *http.Request) {
 
 // MemberSendNotification sends an email to the member identified in the token
 func MemberSendNotification(w http.ResponseWriter, r *http.Request) {
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	// member record id in token
-	mem, err := member.ByID(DS, UserAuthToken.Claims.ID)
+	mem, err := member.ByID(DS, authToken(r).Claims.ID)
 	if err != nil {
-		msg := fmt.Sprintf("Could not find member record with id %v", UserAuthToken.Claims.ID)
+		msg := fmt.Sprintf("Could not find member record with id %v", authToken(r).Claims.ID)
 		p.Message = Message{http.StatusBadRequest, "failed", msg}
 		p.Send(w)
 		return
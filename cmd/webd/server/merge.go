@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cardiacsociety/web-services/internal/member"
+)
+
+// AdminMembersDuplicates fetches pairs of member records that appear to be duplicates, with an optional
+// ?memberId=n to only return the pairs that include a member
+func AdminMembersDuplicates(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	var id int
+	if v := r.FormValue("memberId"); v != "" {
+		var err error
+		id, err = strconv.Atoi(v)
+		if err != nil {
+			p.Message = Message{http.StatusBadRequest, "failed", "memberId should be an integer"}
+			p.Send(w)
+			return
+		}
+	}
+
+	xd, err := member.Duplicates(DS, id)
+	if err != nil {
+		p.Message = Message{http.StatusInternalServerError, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Data retrieved from MySQL"}
+	p.Meta = map[string]int{"count": len(xd)}
+	p.Data = xd
+	p.Send(w)
+}
+
+// AdminMembersMerge merges a duplicate member record into the member identified by id, with a body like
+// {"duplicateId": 123}
+func AdminMembersMerge(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	var body struct {
+		DuplicateID int `json:"duplicateId"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	mr, err := member.Merge(DS, id, body.DuplicateID)
+	p.Data = mr
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	msg := fmt.Sprintf("Member id %d merged into member id %d", body.DuplicateID, id)
+	p.Message = Message{http.StatusOK, "success", msg}
+	p.Send(w)
+}
@@ -1,22 +1,33 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 
+	"github.com/cardiacsociety/web-services/internal/auth"
 	"github.com/cardiacsociety/web-services/internal/platform/jwt"
 )
 
-// UserAuthToken is a global Encoded that is set up by the middleware for convenience
-var UserAuthToken jwt.Token
+// contextKey is the type of the keys for values that the middleware adds to the request context
+type contextKey string
 
-// ValidateToken validate the JSON web token passed in the Authorization header. For now
-// a POST request to /auth simply returns, without checking the token, as this is
-// a request to authenticate and get a new token.
+// tokenKey is the context key for the access token decoded by ValidateToken
+const tokenKey contextKey = "token"
+
+// authToken returns the access token that ValidateToken decoded for the request. It is the zero value if the
+// request did not pass through ValidateToken.
+func authToken(r *http.Request) jwt.Token {
+	at, _ := r.Context().Value(tokenKey).(jwt.Token)
+	return at
+}
+
+// ValidateToken validate the JSON web token passed in the Authorization header, checks
+// that it has not been revoked, and adds it to the request context for authToken. For now a POST request to /auth simply returns, without
+// checking the token, as this is a request to authenticate and get a new token.
 func ValidateToken(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 
 	// pass through when request is preflight http OPTIONS
@@ -38,15 +49,15 @@ func ValidateToken(w http.ResponseWriter, r *http.Request, next http.HandlerFunc
 		return
 	}
 
-	// Set the global Encoded
-	UserAuthToken, err = jwt.Decode(t, os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+	at, err := auth.DecodeToken(DS, t)
 	if err != nil {
 		p.Message = Message{http.StatusUnauthorized, "failure", "Authorization failed: " + err.Error()}
 		p.Send(w)
 		return
 	}
 
-	next(w, r)
+	// the token is carried in the request context, so each request only sees its own token
+	next(w, r.WithContext(context.WithValue(r.Context(), tokenKey, at)))
 }
 
 // AdminScope checks that the auth token belongs to an admin
@@ -54,7 +65,7 @@ func AdminScope(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 
 	p := Payload{}
 
-	if UserAuthToken.Claims.Role != "admin" {
+	if authToken(r).Claims.Role != "admin" {
 		p.Message = Message{http.StatusUnauthorized, "failed", "Admin Scope Required: token does not belong to an admin user"}
 		p.Send(w)
 		return
@@ -75,7 +86,7 @@ func MemberScope(w http.ResponseWriter, r *http.Request, next http.HandlerFunc)
 
 	p := Payload{}
 
-	if UserAuthToken.Claims.Role != "member" {
+	if authToken(r).Claims.Role != "member" {
 		p.Message = Message{http.StatusUnauthorized, "failed", "Member Scope Required: token does not belong to a member user"}
 		p.Send(w)
 		return
@@ -101,7 +112,7 @@ func MemberScope(w http.ResponseWriter, r *http.Request, next http.HandlerFunc)
 					p.Send(w)
 					return
 				}
-				if UserAuthToken.Claims.ID != int(mid) {
+				if authToken(r).Claims.ID != int(mid) {
 					p.Message = Message{http.StatusUnauthorized, "failed", "Member id in path does not match token"}
 					p.Send(w)
 					return
@@ -0,0 +1,164 @@
+package server_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cardiacsociety/web-services/cmd/webd/server"
+	"github.com/cardiacsociety/web-services/internal/auth"
+	"github.com/cardiacsociety/web-services/internal/platform/jwt"
+	"github.com/cardiacsociety/web-services/testdata"
+)
+
+const signingKey = "testTokenSigningKey"
+
+func TestMiddleware(t *testing.T) {
+
+	teardown := setup()
+	defer teardown()
+
+	t.Run("middleware", func(t *testing.T) {
+		t.Run("testMemberScopeConcurrent", testMemberScopeConcurrent)
+		t.Run("testAdminScopeConcurrent", testAdminScopeConcurrent)
+		t.Run("testRevokedToken", testRevokedToken)
+	})
+}
+
+func setup() func() {
+	os.Setenv("MAPPCPD_JWT_SIGNING_KEY", signingKey)
+	var db = testdata.NewDataStore()
+	err := db.SetupMongoDB()
+	if err != nil {
+		log.Fatalf("SetupMongoDB() err = %s", err)
+	}
+	server.DS = db.Store
+	return func() {
+		err := db.TearDownMongoDB()
+		if err != nil {
+			log.Fatalf("TearDownMongoDB() err = %s", err)
+		}
+	}
+}
+
+// token returns an encoded access token for a user
+func token(t *testing.T, id int, role string) jwt.Token {
+	c := map[string]interface{}{
+		"id":   id,
+		"name": fmt.Sprintf("User %d", id),
+		"role": role,
+	}
+	tk, err := jwt.New("test", signingKey, 1).CustomClaims(c).Encode()
+	if err != nil {
+		t.Fatalf("jwt.Encode() err = %s", err)
+	}
+	return tk
+}
+
+// chain runs ValidateToken, the scope middleware, then a handler that checks the member id in the query string
+// ?id= matches the token. The pause after ValidateToken gives other requests the chance to run their own
+// ValidateToken in the meantime, which would overwrite a token shared between requests.
+func chain(scope func(http.ResponseWriter, *http.Request, http.HandlerFunc)) http.HandlerFunc {
+	owner := func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		if !server.AuthorizeID(r, id) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		server.ValidateToken(w, r, func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond)
+			scope(w, r, owner)
+		})
+	}
+}
+
+// serve sends concurrent requests, and returns the status codes of the responses in the same order
+func serve(h http.HandlerFunc, paths []string, tokens []jwt.Token) []int {
+	codes := make([]int, len(paths))
+	var wg sync.WaitGroup
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", paths[i], nil)
+			r.Header.Set("Authorization", "Bearer "+tokens[i].Encoded)
+			w := httptest.NewRecorder()
+			h(w, r)
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+	return codes
+}
+
+// testMemberScopeConcurrent sends concurrent requests from members, each for their own member id, and from admins,
+// and checks that each request is checked against its own token
+func testMemberScopeConcurrent(t *testing.T) {
+	var paths []string
+	var tokens []jwt.Token
+	var want []int
+	for i := 0; i < 100; i++ {
+		id := i%10 + 1
+		paths = append(paths, fmt.Sprintf("/v1/m/activities?id=%d", id))
+		if i%3 == 0 {
+			tokens = append(tokens, token(t, id, "admin"))
+			want = append(want, http.StatusUnauthorized)
+		} else {
+			tokens = append(tokens, token(t, id, "member"))
+			want = append(want, http.StatusOK)
+		}
+	}
+
+	for i, code := range serve(chain(server.MemberScope), paths, tokens) {
+		if code != want[i] {
+			t.Errorf("request %d with %s token for id %d status = %d, want %d", i, tokens[i].Claims.Role,
+				tokens[i].Claims.ID, code, want[i])
+		}
+	}
+}
+
+// testAdminScopeConcurrent sends concurrent requests from admins and members, and checks that only the admin
+// requests are allowed
+func testAdminScopeConcurrent(t *testing.T) {
+	var paths []string
+	var tokens []jwt.Token
+	var want []int
+	for i := 0; i < 100; i++ {
+		paths = append(paths, fmt.Sprintf("/v1/a/members?id=%d", i))
+		if i%2 == 0 {
+			tokens = append(tokens, token(t, i, "admin"))
+			want = append(want, http.StatusOK)
+		} else {
+			tokens = append(tokens, token(t, i, "member"))
+			want = append(want, http.StatusUnauthorized)
+		}
+	}
+
+	for i, code := range serve(chain(server.AdminScope), paths, tokens) {
+		if code != want[i] {
+			t.Errorf("request %d with %s token status = %d, want %d", i, tokens[i].Claims.Role, code, want[i])
+		}
+	}
+}
+
+func testRevokedToken(t *testing.T) {
+	tk := token(t, 1, "admin")
+	err := auth.RevokeToken(server.DS, tk.Claims.Id, tk.ExpiresAt)
+	if err != nil {
+		t.Fatalf("auth.RevokeToken() err = %s", err)
+	}
+
+	codes := serve(chain(server.AdminScope), []string{"/v1/a/members?id=1"}, []jwt.Token{tk})
+	if codes[0] != http.StatusUnauthorized {
+		t.Errorf("request with revoked token status = %d, want %d", codes[0], http.StatusUnauthorized)
+	}
+}
@@ -15,7 +15,7 @@ import (
 // ReportsTest handles a request to test the reports route
 func ReportsTest(w http.ResponseWriter, _ *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 	p.Message = Message{http.StatusOK, "success", "Request to reports test handler successful!"}
 	p.Send(w)
 }
@@ -23,7 +23,7 @@ func ReportsTest(w http.ResponseWriter, _ *http.Request) {
 // ReportsModulesByDate fetches data on modules by year-month
 func ReportsModulesByDate(w http.ResponseWriter, _ *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	report, err := reports.ReportModulesByDate(DS)
 	if err != nil {
@@ -47,7 +47,7 @@ func ReportsModulesByDate(w http.ResponseWriter, _ *http.Request) {
 // dates are reported by ReportsPointsByActivityDate
 func ReportsPointsByRecordDate(w http.ResponseWriter, _ *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	report, err := reports.ReportPointsByRecordDate(DS)
 	if err != nil {
@@ -70,7 +70,7 @@ func ReportsPointsByRecordDate(w http.ResponseWriter, _ *http.Request) {
 // according to the date of the activity itself - that is CPD Activity as opposed to system activity (above)
 func ReportsPointsByActivityDate(w http.ResponseWriter, _ *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	report, err := reports.ReportPointsByActivityDate(DS)
 	if err != nil {
@@ -92,7 +92,7 @@ func ReportsPointsByActivityDate(w http.ResponseWriter, _ *http.Request) {
 // ReportsExcel handles requests for cached excel reports
 func ReportsExcel(w http.ResponseWriter, r *http.Request) {
 
-	p := NewResponder(UserAuthToken.Encoded)
+	p := NewResponder()
 
 	v := mux.Vars(r)
 	cacheID := v["id"]
@@ -116,3 +116,24 @@ func ReportsExcel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// ReportsJSON handles requests for cached JSON reports. It is an admin route as the reports contain member data.
+func ReportsJSON(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	v := mux.Vars(r)
+	cacheID := v["id"]
+
+	data, found := DS.Cache.Get(cacheID)
+	if !found {
+		msg := fmt.Sprintf("Could not find cache item id %s,", cacheID)
+		p.Message = Message{http.StatusNotFound, "failed", msg}
+		p.Send(w)
+		return
+	}
+
+	p.Message = Message{http.StatusOK, "success", "Data retrieved from cache"}
+	p.Data = data
+	p.Send(w)
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cardiacsociety/web-services/internal/auth"
+	"github.com/cardiacsociety/web-services/internal/notification"
+)
+
+// resetRequestMessage is the response to a reset request, whether or not the email address is registered, so that
+// the endpoint cannot be used to find out who is a member
+const resetRequestMessage = "If the email address is registered a password reset link has been sent"
+
+// AuthResetRequest sends a password reset link to a member, body {"email": "..."}
+func AuthResetRequest(w http.ResponseWriter, r *http.Request) {
+
+	p := Payload{}
+
+	var body struct {
+		Email string `json:"email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failure", msg}
+		p.Send(w)
+		return
+	}
+	if body.Email == "" {
+		p.Message = Message{http.StatusBadRequest, "failure", "email is required"}
+		p.Send(w)
+		return
+	}
+
+	rs, token, err := auth.RequestReset(DS, body.Email)
+	switch {
+	case err == sql.ErrNoRows:
+		p.Message = Message{http.StatusAccepted, "success", resetRequestMessage}
+	case err == auth.ErrTooManyResets:
+		p.Message = Message{http.StatusTooManyRequests, "failure", err.Error()}
+	case err != nil:
+		p.Message = Message{http.StatusInternalServerError, "failure", err.Error()}
+	default:
+		sendNotification(resetEmail(rs, token))
+		p.Message = Message{http.StatusAccepted, "success", resetRequestMessage}
+	}
+
+	p.Send(w)
+}
+
+// AuthResetComplete sets a member's password with a reset token, body {"token": "...", "password": "..."}
+func AuthResetComplete(w http.ResponseWriter, r *http.Request) {
+
+	p := Payload{}
+
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body - %s", err)
+		p.Message = Message{http.StatusBadRequest, "failure", msg}
+		p.Send(w)
+		return
+	}
+
+	_, err = auth.CompleteReset(DS, body.Token, body.Password)
+	switch {
+	case err == auth.ErrPasswordTooShort:
+		p.Message = Message{http.StatusBadRequest, "failure", err.Error()}
+	case err == auth.ErrInvalidToken:
+		p.Message = Message{http.StatusUnauthorized, "failure", err.Error()}
+	case err != nil:
+		p.Message = Message{http.StatusInternalServerError, "failure", err.Error()}
+	default:
+		p.Message = Message{http.StatusOK, "success", "Password has been set, please log in"}
+	}
+
+	p.Send(w)
+}
+
+// AdminMembersInvite sends an invitation to a member to set their password
+func AdminMembersInvite(w http.ResponseWriter, r *http.Request) {
+
+	p := NewResponder()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	rs, token, err := auth.Invite(DS, id)
+	if err == sql.ErrNoRows {
+		msg := fmt.Sprintf("No active member with id %d", id)
+		p.Message = Message{http.StatusNotFound, "failed", msg}
+		p.Send(w)
+		return
+	}
+	if err != nil {
+		p.Message = Message{http.StatusBadRequest, "failed", err.Error()}
+		p.Send(w)
+		return
+	}
+
+	sendNotification(resetEmail(rs, token))
+
+	msg := fmt.Sprintf("Invitation sent to '%s'", rs.Email)
+	p.Message = Message{http.StatusAccepted, "success", msg}
+	p.Data = rs
+	p.Send(w)
+}
+
+// resetEmail creates the email with the link to set a password. The link is MAPPCPD_RESET_URL with the token
+// added as ?token=, and the email is sent from MAPPCPD_MX_FROM_NAME and MAPPCPD_MX_FROM_EMAIL.
+func resetEmail(rs auth.Reset, token string) notification.Email {
+
+	link := os.Getenv("MAPPCPD_RESET_URL") + "?token=" + url.QueryEscape(token)
+	if os.Getenv("MAPPCPD_RESET_URL") == "" {
+		log.Println("resetEmail() env var MAPPCPD_RESET_URL is not set")
+	}
+
+	subject := "Reset your password"
+	intro := "A password reset was requested for your account. If you did not request it you can ignore this email."
+	expires := "The link can be used once and expires at " + rs.ExpiresAt.Format("3:04pm, 2 January 2006") + "."
+	if rs.Invite {
+		subject = "Set up your account"
+		intro = "An account has been set up for you. Please follow the link below to set your password."
+		expires = "The link can be used once and expires on " + rs.ExpiresAt.Format("2 January 2006") + "."
+	}
+
+	return notification.Email{
+		FromName:     os.Getenv("MAPPCPD_MX_FROM_NAME"),
+		FromEmail:    os.Getenv("MAPPCPD_MX_FROM_EMAIL"),
+		ToName:       rs.Name,
+		ToEmail:      rs.Email,
+		Subject:      subject,
+		PlainContent: fmt.Sprintf("Hi %s,\n\n%s\n\n%s\n\n%s\n", rs.Name, intro, link, expires),
+		HTMLContent: fmt.Sprintf("<p>Hi %s,</p><p>%s</p><p><a href=\"%s\">%s</a></p><p>%s</p>",
+			html.EscapeString(rs.Name), intro, html.EscapeString(link), html.EscapeString(link), expires),
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/cardiacsociety/web-services/internal/auth"
 	"github.com/cardiacsociety/web-services/internal/platform/jwt"
 	"github.com/pkg/errors"
 )
@@ -45,26 +47,10 @@ type MongoMeta struct {
 	Query interface{} `json:"query" bson:"query"`
 }
 
-// New returns a pointer to a new Payload value. It received a token string which it will
-// check for validity and if ok will set a refresh token as part of the payload.
-func NewResponder(ts string) *Payload {
-
-	p := Payload{}
-
-	// if universal UserAuthToken value is present, use this to set fresh token
-	t, err := jwt.Decode(ts, os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
-	if err != nil {
-		// No panic here, we'll just not do a fresh token
-		return &p
-	}
-
-	ft, err := freshToken(t.Claims.ID, t.Claims.Name, t.Claims.Role)
-	if err != nil {
-		return &p
-	}
-	p.Data = ft
-
-	return &p
+// NewResponder returns a pointer to a new Payload value. A fresh token is no longer issued with each response, as
+// that allowed a token to be extended forever - the client uses its refresh token at /auth/refresh instead.
+func NewResponder() *Payload {
+	return &Payload{}
 }
 
 // Send will; send the payload back to the requester
@@ -86,16 +72,58 @@ func (p Payload) Send(w http.ResponseWriter) error {
 	return nil
 }
 
-// freshToken issues a new token and adds custom claims id (member id) and name (member name) and well as custom scope
+// tokens are issued at login and refresh. The access token is embedded so the response data is the same as a
+// plain access token, with the refresh token added.
+type tokens struct {
+	jwt.Token
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// defaultAccessTTLMinutes is used if MAPPCPD_JWT_TTL_MINUTES is not set
+const defaultAccessTTLMinutes = 15
+
+// issueTokens issues an access token and starts a new family of refresh tokens, after a login. The refresh tokens
+// expire after MAPPCPD_JWT_TTL_HOURS, which is the longest a login can last.
+func issueTokens(id int, name string, role string) (tokens, error) {
+
+	var ts tokens
+
+	ttl, err := strconv.Atoi(os.Getenv("MAPPCPD_JWT_TTL_HOURS"))
+	if err != nil {
+		return ts, errors.Wrap(err, "Could not convert hours string to int")
+	}
+
+	ts.Token, err = freshToken(id, name, role)
+	if err != nil {
+		return ts, err
+	}
+
+	rf, rt, err := auth.NewRefresh(DS, id, name, role, time.Duration(ttl)*time.Hour)
+	if err != nil {
+		return ts, err
+	}
+	ts.RefreshToken = rt
+	ts.RefreshExpiresAt = rf.ExpiresAt
+
+	return ts, nil
+}
+
+// freshToken issues a new access token and adds custom claims id (member id) and name (member name) and well as
+// custom scope. Access tokens are short-lived, they expire after MAPPCPD_JWT_TTL_MINUTES (default 15).
 func freshToken(id int, name string, role string) (jwt.Token, error) {
 
 	var t jwt.Token
 
 	iss := os.Getenv("MAPPCPD_API_URL")
 	key := os.Getenv("MAPPCPD_JWT_SIGNING_KEY")
-	ttl, err := strconv.Atoi(os.Getenv("MAPPCPD_JWT_TTL_HOURS"))
-	if err != nil {
-		return t, errors.Wrap(err, "Could not convert hours string to int")
+	ttl := defaultAccessTTLMinutes
+	if m := os.Getenv("MAPPCPD_JWT_TTL_MINUTES"); m != "" {
+		var err error
+		ttl, err = strconv.Atoi(m)
+		if err != nil {
+			return t, errors.Wrap(err, "Could not convert minutes string to int")
+		}
 	}
 
 	c := map[string]interface{}{
@@ -104,5 +132,5 @@ func freshToken(id int, name string, role string) (jwt.Token, error) {
 		"role": role,
 	}
 
-	return jwt.New(iss, key, ttl).CustomClaims(c).Encode()
+	return jwt.NewTTL(iss, key, time.Duration(ttl)*time.Minute).CustomClaims(c).Encode()
 }
@@ -13,6 +13,14 @@ func AuthSubRouter(prefix string) *mux.Router {
 	auth.Methods("OPTIONS").Path("/").HandlerFunc(Preflight)
 	auth.Methods("POST").Path("/member").HandlerFunc(AuthMemberLogin)
 	auth.Methods("POST").Path("/admin").HandlerFunc(AuthAdminLogin)
+	auth.Methods("OPTIONS").Path("/refresh").HandlerFunc(Preflight)
+	auth.Methods("POST").Path("/refresh").HandlerFunc(AuthRefresh)
+	auth.Methods("OPTIONS").Path("/logout").HandlerFunc(Preflight)
+	auth.Methods("POST").Path("/logout").HandlerFunc(AuthLogout)
+	auth.Methods("OPTIONS").Path("/reset").HandlerFunc(Preflight)
+	auth.Methods("POST").Path("/reset").HandlerFunc(AuthResetRequest)
+	auth.Methods("OPTIONS").Path("/reset/complete").HandlerFunc(Preflight)
+	auth.Methods("POST").Path("/reset/complete").HandlerFunc(AuthResetComplete)
 
 	return auth
 }
@@ -28,7 +36,8 @@ func AdminSubRouter(prefix string) *mux.Router {
 	admin.Methods("GET").Path("/members").HandlerFunc(AdminMembersSearch)
 	admin.Methods("POST").Path("/members").HandlerFunc(AdminMembersSearchPost)
 	admin.Methods("GET").Path("/members/{id:[0-9]+}").HandlerFunc(AdminMembersID)
-	//admin.Methods("POST").Path("/members/{id:[0-9]+}").HandlerFunc(AdminMembersUpdate)
+	admin.Methods("POST").Path("/members/{id:[0-9]+}").HandlerFunc(AdminMembersUpdate)
+	admin.Methods("POST").Path("/members/{id:[0-9]+}/invite").HandlerFunc(AdminMembersInvite)
 	admin.Methods("GET").Path("/members/{id:[0-9]+}/notes").HandlerFunc(AdminMembersNotes)
 	admin.Methods("GET").Path("/notes/{id:[0-9]+}").HandlerFunc(AdminNotes)
 	admin.Methods("GET").Path("/organisations").HandlerFunc(AllOrganisations)
@@ -52,6 +61,16 @@ func AdminSubRouter(prefix string) *mux.Router {
 
 	// Batch routes for bulk uploading
 	admin.Methods("POST").Path("/batch/resources").HandlerFunc(AdminBatchResourcesPost)
+	admin.Methods("POST").Path("/batch/activities").HandlerFunc(AdminActivitiesImport)
+
+	// Member profile change sets
+	admin.Methods("GET").Path("/changes").HandlerFunc(AdminChanges)
+	admin.Methods("GET").Path("/changes/{_id}").HandlerFunc(AdminChangesID)
+	admin.Methods("PUT").Path("/changes/{_id}/approve").HandlerFunc(AdminChangesApprove)
+	admin.Methods("PUT").Path("/changes/{_id}/reject").HandlerFunc(AdminChangesReject)
+
+	// Activity routes
+	admin.Methods("PUT").Path("/activities/{id:[0-9]+}/restore").HandlerFunc(AdminActivitiesRestore)
 
 	// Report routes
 	admin.Methods("POST").Path("/reports/application").HandlerFunc(AdminReportApplicationExcel)
@@ -60,12 +79,32 @@ func AdminSubRouter(prefix string) *mux.Router {
 	admin.Methods("POST").Path("/reports/invoice").HandlerFunc(AdminReportInvoiceExcel)
 	admin.Methods("POST").Path("/reports/payment").HandlerFunc(AdminReportPaymentExcel)
 	admin.Methods("POST").Path("/reports/position").HandlerFunc(AdminReportPositionExcel)
+	admin.Methods("POST").Path("/reports/cpd").HandlerFunc(AdminReportCPDCohortExcel)
+	admin.Methods("POST").Path("/reports/audit").HandlerFunc(AdminReportAuditExcel)
+	admin.Methods("POST").Path("/reports/lapse").HandlerFunc(AdminReportLapseExcel)
+	admin.Methods("GET").Path("/reports/json/{id}").HandlerFunc(ReportsJSON)
+
+	// CPD audits
+	admin.Methods("POST").Path("/audits").HandlerFunc(AdminAuditsSelect)
+	admin.Methods("GET").Path("/audits/{id:[0-9]+}").HandlerFunc(AdminAuditsID)
+	admin.Methods("PUT").Path("/audits/{id:[0-9]+}/complete").HandlerFunc(AdminAuditsComplete)
+	admin.Methods("PUT").Path("/audits/activities/{id:[0-9]+}").HandlerFunc(AdminAuditsActivityVerify)
 
 	// Membership application
 	admin.Methods("POST").Path("/applications").HandlerFunc(AdminNewMembershipApplication)
 	
-	// Lapse members
-	admin.Methods("PUT").Path("/lapsedmembers").HandlerFunc(AdminLapseMembers)
+	// Membership status
+	admin.Methods("PUT").Path("/members/status").HandlerFunc(AdminMembersStatus)
+	admin.Methods("PUT").Path("/members/{id:[0-9]+}/reinstate").HandlerFunc(AdminMembersReinstate)
+	admin.Methods("GET").Path("/members/duplicates").HandlerFunc(AdminMembersDuplicates)
+	admin.Methods("PUT").Path("/members/{id:[0-9]+}/merge").HandlerFunc(AdminMembersMerge)
+
+	// Lapse unfinancial members
+	admin.Methods("GET").Path("/lapse/candidates").HandlerFunc(AdminLapseCandidates)
+	admin.Methods("PUT").Path("/lapse/confirm").HandlerFunc(AdminLapseConfirm)
+
+	// Evaluation periods
+	admin.Methods("PUT").Path("/evaluations/rollover").HandlerFunc(AdminEvaluationRollover)
 
 	// Notifications
 	admin.Methods("POST").Path("/notifications").HandlerFunc(AdminSendNotifications)
@@ -145,15 +184,18 @@ func MemberSubRouter(prefix string) *mux.Router {
 	// members routes
 	members := r.PathPrefix(prefix).Subrouter()
 	members.Methods("GET").Path("/").HandlerFunc(Index)
-	members.Methods("GET").Path("/token").HandlerFunc(MembersToken)
-	members.Methods("OPTIONS").Path("/token").HandlerFunc(Preflight)
 	members.Methods("GET").Path("/profile").HandlerFunc(MembersProfile)
 
 	members.Methods("GET").Path("/activities").HandlerFunc(MembersActivities)
 	members.Methods("POST").Path("/activities").HandlerFunc(MembersActivitiesAdd)
+	members.Methods("POST").Path("/activities/import").HandlerFunc(MembersActivitiesImport)
 
 	members.Methods("GET").Path("/activities/{id:[0-9]+}").HandlerFunc(MembersActivitiesID)
 	members.Methods("PUT").Path("/activities/{id:[0-9]+}").HandlerFunc(MembersActivitiesUpdate)
+	members.Methods("GET").Path("/activities/{id:[0-9]+}/history").HandlerFunc(MembersActivitiesHistory)
+
+	// Audits
+	members.Methods("GET").Path("/audits").HandlerFunc(MembersAudits)
 
 	// Attachments
 	members.Methods("OPTIONS").Path("/activities/{id:[0-9]+}/attachments/request").HandlerFunc(Preflight)
@@ -170,8 +212,19 @@ func MemberSubRouter(prefix string) *mux.Router {
 	members.Methods("OPTIONS").Path("/activities/recurring/{_id}/recorder").HandlerFunc(Preflight)
 	members.Methods("POST").Path("/activities/recurring/{_id}/recorder").HandlerFunc(MembersActivitiesRecurringRecorder)
 
+	members.Methods("OPTIONS").Path("/activities/recurring/{_id}/autorecord").HandlerFunc(Preflight)
+	members.Methods("PUT").Path("/activities/recurring/{_id}/autorecord").HandlerFunc(MembersActivitiesRecurringAutoRecord)
+
+	members.Methods("OPTIONS").Path("/activities/recurring/{_id}/catchup").HandlerFunc(Preflight)
+	members.Methods("GET").Path("/activities/recurring/{_id}/catchup").HandlerFunc(MembersActivitiesRecurringMissed)
+	members.Methods("POST").Path("/activities/recurring/{_id}/catchup").HandlerFunc(MembersActivitiesRecurringCatchUp)
+
 	members.Methods("GET").Path("/evaluations").HandlerFunc(MembersEvaluation)
 
+	members.Methods("OPTIONS").Path("/profile/changes").HandlerFunc(Preflight)
+	members.Methods("GET").Path("/profile/changes").HandlerFunc(MembersChanges)
+	members.Methods("POST").Path("/profile/changes").HandlerFunc(MembersChangesAdd)
+
 	members.Methods("POST").Path("/notifications").HandlerFunc(MemberSendNotification)
 
 	members.Methods("GET").Path("/reports/cpd/current").HandlerFunc(CurrentActivityReport)
@@ -134,8 +134,7 @@ func activityByTypeID(ds datastore.Datastore, id int) (Activity, error) {
 func activityTypes(ds datastore.Datastore, activityID int) ([]Type, error) {
 	var xat []Type
 
-	q := fmt.Sprintf(queries["select-activity-types"], activityID)
-	rows, err := ds.MySQL.Session.Query(q)
+	rows, err := ds.MySQL.Session.Query(queries["select-activity-types"], activityID)
 	if err != nil {
 		return xat, err
 	}
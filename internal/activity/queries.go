@@ -32,4 +32,4 @@ FROM
   ce_activity_type 
 WHERE 
   active = 1 AND 
-  ce_activity_id = %d`
+  ce_activity_id = ?`
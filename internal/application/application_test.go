@@ -166,15 +166,15 @@ func testByNonExistentMemberID(t *testing.T) {
 // test generic query function, specify clause and check expected result count
 func testQuery(t *testing.T) {
 	cases := []struct {
-		arg  string
+		arg  *datastore.Filter
 		want int
 	}{
-		{"", 6},
-		{"AND member_id = 488", 1},
-		{"AND member_id = 502", 2},
-		{"AND member_id = 101", 0},
-		{"AND applied_on > '2017-01-01'", 1},
-		{"AND ma.id IN (1,2,3)", 3},
+		{nil, 6},
+		{datastore.NewFilter().Equal("member_id", 488), 1},
+		{datastore.NewFilter().Equal("member_id", 502), 2},
+		{datastore.NewFilter().Equal("member_id", 101), 0},
+		{datastore.NewFilter().GreaterEq("applied_on", "2017-01-02"), 1},
+		{datastore.NewFilter().In("ma.id", []int{1, 2, 3}), 3},
 	}
 	for _, c := range cases {
 		xa, err := application.Query(ds, c.arg)
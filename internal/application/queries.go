@@ -34,6 +34,6 @@ WHERE 1 `
 
 const selectActiveApplications = selectApplications + ` AND ma.active = 1 `
 
-const selectApplicationByID = selectActiveApplications + ` AND ma.id = %v `
+const selectApplicationByID = selectActiveApplications + ` AND ma.id = ? `
 
-const selectApplicationsByMemberID = selectActiveApplications + ` AND ma.member_id = %v `
+const selectApplicationsByMemberID = selectActiveApplications + ` AND ma.member_id = ? `
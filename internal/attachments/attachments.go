@@ -116,19 +116,20 @@ func (a *Attachment) Register(ds datastore.Datastore, flags ...string) error {
 
 	// If we're here the attachment is NOT already registered, so register it
 	var query string
+	var args []interface{}
 
 	switch a.FileSet.Entity {
 	case "ce_m_activity_attachment":
 		query = `INSERT INTO ce_m_activity_attachment ` +
 			`(ce_m_activity_id, fs_set_id, active, created_at, updated_at, clean_filename, cloudy_filename) ` +
-			`VALUES (%d, %d, 1, NOW(), NOW(), "%s", "%s")`
-		query = fmt.Sprintf(query, a.EntityID, a.FileSet.ID, a.CleanFilename, a.CloudyFilename)
+			`VALUES (?, ?, 1, NOW(), NOW(), ?, ?)`
+		args = []interface{}{a.EntityID, a.FileSet.ID, a.CleanFilename, a.CloudyFilename}
 
 	case "wf_attachment":
 		query = `INSERT INTO wf_attachment ` +
 			`(wf_note_id, ad_user_id, fs_set_id, active, created_at, updated_at, clean_filename) ` +
-			`VALUES (%d, %d, %d, 1, NOW(), NOW(), "%s")`
-		query = fmt.Sprintf(query, a.EntityID, a.UserID, a.FileSet.ID, a.CleanFilename)
+			`VALUES (?, ?, ?, 1, NOW(), NOW(), ?)`
+		args = []interface{}{a.EntityID, a.UserID, a.FileSet.ID, a.CleanFilename}
 
 	case "ol_resource_file":
 		var thumbnail int
@@ -137,14 +138,14 @@ func (a *Attachment) Register(ds datastore.Datastore, flags ...string) error {
 		}
 		query = `INSERT INTO ol_resource_file ` +
 			`(ol_resource_id, ad_user_id, fs_set_id, active, thumbnail, created_at, updated_at, clean_filename, cloudy_filename) ` +
-			`VALUES (%d, %d, %d, 1, %d, NOW(), NOW(), "%s", "%s")`
-		query = fmt.Sprintf(query, a.EntityID, a.UserID, a.FileSet.ID, thumbnail, a.CleanFilename, a.CloudyFilename)
+			`VALUES (?, ?, ?, 1, ?, NOW(), NOW(), ?, ?)`
+		args = []interface{}{a.EntityID, a.UserID, a.FileSet.ID, thumbnail, a.CleanFilename, a.CloudyFilename}
 
 	default:
 		return errors.New("Error registering attachment - unknown entity name")
 	}
 
-	result, err := ds.MySQL.Session.Exec(query)
+	result, err := ds.MySQL.Session.Exec(query, args...)
 	if err != nil {
 		return errors.New("Database error - " + err.Error())
 	}
@@ -165,32 +166,33 @@ func (a *Attachment) Register(ds datastore.Datastore, flags ...string) error {
 func (a *Attachment) Exists(ds datastore.Datastore) error {
 
 	var query string
+	var args []interface{}
 	var id int
 
 	switch a.FileSet.Entity {
 	case "ce_m_activity_attachment":
 		query = `SELECT id FROM ce_m_activity_attachment WHERE active = 1 AND ` +
-			`ce_m_activity_id = %d AND fs_set_id = %d AND clean_filename = "%s" AND cloudy_filename = "%s" ` +
+			`ce_m_activity_id = ? AND fs_set_id = ? AND clean_filename = ? AND cloudy_filename = ? ` +
 			`LIMIT 1`
-		query = fmt.Sprintf(query, a.EntityID, a.FileSet.ID, a.CleanFilename, a.CloudyFilename)
+		args = []interface{}{a.EntityID, a.FileSet.ID, a.CleanFilename, a.CloudyFilename}
 
 	case "wf_attachment":
 		query = `SELECT id FROM wf_attachment WHERE active = 1 AND ` +
-			`wf_note_id = %d AND fs_set_id = %d AND clean_filename = "%s" ` +
+			`wf_note_id = ? AND fs_set_id = ? AND clean_filename = ? ` +
 			`LIMIT 1`
-		query = fmt.Sprintf(query, a.EntityID, a.FileSet.ID, a.CleanFilename)
+		args = []interface{}{a.EntityID, a.FileSet.ID, a.CleanFilename}
 
 	case "ol_resource_file":
 		query = `SELECT id FROM ol_resource_file WHERE active = 1 AND ` +
-			`ol_resource_id = %d AND fs_set_id = %d AND clean_filename = "%s" AND cloudy_filename = "%s" ` +
+			`ol_resource_id = ? AND fs_set_id = ? AND clean_filename = ? AND cloudy_filename = ? ` +
 			`LIMIT 1`
-		query = fmt.Sprintf(query, a.EntityID, a.FileSet.ID, a.CleanFilename, a.CloudyFilename)
+		args = []interface{}{a.EntityID, a.FileSet.ID, a.CleanFilename, a.CloudyFilename}
 
 	default:
 		return errors.New("Unknown entity: " + a.FileSet.Entity)
 	}
 
-	err := ds.MySQL.Session.QueryRow(query).Scan(&id)
+	err := ds.MySQL.Session.QueryRow(query, args...).Scan(&id)
 	// No rows is not an error here
 	if err == sql.ErrNoRows {
 		return nil
@@ -210,9 +212,8 @@ func (a *Attachment) setURL(ds datastore.Datastore) error {
 
 	var url string
 
-	query := "SELECT base_url FROM fs_url WHERE active = 1 AND fs_set_id = %d ORDER BY priority ASC LIMIT 1"
-	query = fmt.Sprintf(query, a.FileSet.ID)
-	err := ds.MySQL.Session.QueryRow(query).Scan(&url)
+	query := "SELECT base_url FROM fs_url WHERE active = 1 AND fs_set_id = ? ORDER BY priority ASC LIMIT 1"
+	err := ds.MySQL.Session.QueryRow(query, a.FileSet.ID).Scan(&url)
 	if err == sql.ErrNoRows {
 		msg := fmt.Sprintf("No fs_url record found for file_set.id = %d - %s", a.FileSet.ID, err.Error())
 		return errors.New(msg)
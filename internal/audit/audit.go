@@ -0,0 +1,381 @@
+// Package audit manages random audits of member CPD, in which the evidence for each activity claimed in an
+// evaluation period is verified by the committee.
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// Audit result values, as stored in ce_audit.result
+const (
+	ResultPending = 0
+	ResultPassed  = 1
+	ResultFailed  = 2
+)
+
+// Activity verification values, as stored in ce_audit_m_activity.verified
+const (
+	VerificationPending  = 0
+	VerificationAccepted = 1
+	VerificationRejected = 2
+)
+
+// Status names for results and verifications
+const (
+	StatusPending  = "pending"
+	StatusPassed   = "passed"
+	StatusFailed   = "failed"
+	StatusAccepted = "accepted"
+	StatusRejected = "rejected"
+)
+
+var resultStatus = map[int]string{
+	ResultPending: StatusPending,
+	ResultPassed:  StatusPassed,
+	ResultFailed:  StatusFailed,
+}
+
+var verificationStatus = map[int]string{
+	VerificationPending:  StatusPending,
+	VerificationAccepted: StatusAccepted,
+	VerificationRejected: StatusRejected,
+}
+
+// Audit is the audit of a member evaluation period
+type Audit struct {
+	ID           int        `json:"id"`
+	EvaluationID int        `json:"evaluationId"`
+	MemberID     int        `json:"memberId"`
+	Member       string     `json:"member"`
+	Email        string     `json:"email"`
+	StartDate    string     `json:"startDate"`
+	EndDate      string     `json:"endDate"`
+	CreatedAt    string     `json:"createdAt"`
+	CompletedOn  string     `json:"completedOn"`
+	Result       int        `json:"result"`
+	Status       string     `json:"status"`
+	AuditedBy    string     `json:"auditedBy"`
+	Comment      string     `json:"comment"`
+	Activities   []Activity `json:"activities"`
+}
+
+// Activity is a member activity record selected for verification in an audit
+type Activity struct {
+	ID          int     `json:"id"`
+	AuditID     int     `json:"auditId"`
+	ActivityID  int     `json:"memberActivityId"`
+	Date        string  `json:"date"`
+	Activity    string  `json:"activity"`
+	Description string  `json:"description"`
+	Credit      float64 `json:"credit"`
+	Evidence    bool    `json:"evidence"`
+	Attachments int     `json:"attachments"`
+	Verified    int     `json:"verified"`
+	Status      string  `json:"status"`
+	Reason      string  `json:"reason"`
+}
+
+// Selection specifies the evaluation periods from which to sample members for audit. Periods that end on
+// or between From and To (YYYY-MM-DD) are eligible, unless already audited. Size is the number of audits
+// to create.
+type Selection struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Size      int    `json:"size"`
+	AuditedBy string `json:"auditedBy"`
+}
+
+// Select randomly samples member evaluation periods as per the Selection, and creates an audit for each one.
+// Each audit includes all of the active member activity recorded within the evaluation period.
+func Select(ds datastore.Datastore, s Selection) ([]Audit, error) {
+	return sample(ds, s, rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+// Sample returns n values chosen at random from ids, in random order. If n >= len(ids) all ids are returned.
+func Sample(ids []int, n int, r *rand.Rand) []int {
+	xi := make([]int, len(ids))
+	copy(xi, ids)
+	r.Shuffle(len(xi), func(i, j int) { xi[i], xi[j] = xi[j], xi[i] })
+	if n < len(xi) {
+		xi = xi[:n]
+	}
+	return xi
+}
+
+// ByID fetches an audit, including the activities
+func ByID(ds datastore.Datastore, id int) (Audit, error) {
+	xa, err := query(ds, ` AND ca.id = ?`, id)
+	if err != nil {
+		return Audit{}, err
+	}
+	if len(xa) == 0 {
+		return Audit{}, sql.ErrNoRows
+	}
+	return xa[0], nil
+}
+
+// ByMemberID fetches the audits for a member
+func ByMemberID(ds datastore.Datastore, memberID int) ([]Audit, error) {
+	return query(ds, ` AND cme.member_id = ?`, memberID)
+}
+
+// ByPeriod fetches the audits of evaluation periods that end on or between from and to (YYYY-MM-DD)
+func ByPeriod(ds datastore.Datastore, from, to string) ([]Audit, error) {
+	return query(ds, ` AND cme.end_on >= ? AND cme.end_on <= ?`, from, to)
+}
+
+// Verify records the verification outcome for an audit activity. A reason is required for a rejection, and
+// activities cannot be changed once the audit is completed.
+func Verify(ds datastore.Datastore, auditActivityID, verified int, reason string) error {
+
+	if _, ok := verificationStatus[verified]; !ok {
+		return fmt.Errorf("verification value %d is not valid", verified)
+	}
+	if verified == VerificationRejected && reason == "" {
+		return fmt.Errorf("a reason is required to reject an activity")
+	}
+
+	var completedOn string
+	err := ds.MySQL.Session.QueryRow(queries["select-audit-activity-completed"], auditActivityID).Scan(&completedOn)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("audit activity id %d not found", auditActivityID)
+	}
+	if err != nil {
+		return errors.Wrap(err, "select-audit-activity-completed query error")
+	}
+	if completedOn != "" {
+		return fmt.Errorf("audit activity id %d cannot be changed as the audit was completed on %s", auditActivityID, completedOn)
+	}
+
+	// the query only updates activities of an audit that is not completed, in case it was completed meanwhile
+	res, err := ds.MySQL.Session.Exec(queries["update-audit-activity"], verified, reason, auditActivityID)
+	if err != nil {
+		return errors.Wrap(err, "update-audit-activity query error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("audit activity id %d was not updated, the audit may have been completed", auditActivityID)
+	}
+	return nil
+}
+
+// VerificationValue returns the verification value for a status name, ie pending, accepted or rejected
+func VerificationValue(status string) (int, error) {
+	for v, s := range verificationStatus {
+		if strings.EqualFold(s, status) {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("verification status %q is not valid", status)
+}
+
+// Complete finalises an audit. The audit passes if every activity was accepted, and fails if any activity
+// was rejected or if there are no activities, ie no CPD was recorded for the period. It returns an error if any
+// activity is still pending verification, or if the audit has already been completed.
+func Complete(ds datastore.Datastore, auditID int, comment string) (Audit, error) {
+
+	a, err := ByID(ds, auditID)
+	if err != nil {
+		return a, err
+	}
+	if a.CompletedOn != "" {
+		return a, fmt.Errorf("audit id %d was completed on %s", auditID, a.CompletedOn)
+	}
+
+	result, err := a.outcome()
+	if err != nil {
+		return a, err
+	}
+
+	// the query only updates an audit that is not completed, in case it was completed meanwhile
+	res, err := ds.MySQL.Session.Exec(queries["update-audit-complete"], result, comment, auditID)
+	if err != nil {
+		return a, errors.Wrap(err, "update-audit-complete query error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return a, fmt.Errorf("audit id %d has already been completed", auditID)
+	}
+
+	return ByID(ds, auditID)
+}
+
+// outcome returns the result of an audit based on the activity verifications. An audit with no activities fails,
+// as there is no recorded CPD to verify.
+func (a Audit) outcome() (int, error) {
+	if len(a.Activities) == 0 {
+		return ResultFailed, nil
+	}
+	result := ResultPassed
+	for _, act := range a.Activities {
+		switch act.Verified {
+		case VerificationPending:
+			return ResultPending, fmt.Errorf("activity id %d has not been verified", act.ActivityID)
+		case VerificationRejected:
+			result = ResultFailed
+		}
+	}
+	return result, nil
+}
+
+func sample(ds datastore.Datastore, s Selection, r *rand.Rand) ([]Audit, error) {
+
+	var xa []Audit
+
+	if s.Size < 1 {
+		return xa, fmt.Errorf("selection size should be at least 1")
+	}
+	if s.AuditedBy == "" {
+		return xa, fmt.Errorf("auditedBy is required")
+	}
+
+	var ids []int
+	rows, err := ds.MySQL.Session.Query(queries["select-unaudited-evaluations"], s.From, s.To)
+	if err != nil {
+		return xa, errors.Wrap(err, "select-unaudited-evaluations query error")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return xa, errors.Wrap(err, "scan error")
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return xa, err
+	}
+
+	for _, id := range Sample(ids, s.Size, r) {
+		auditID, err := create(ds, id, s.AuditedBy)
+		if err != nil {
+			return xa, err
+		}
+		a, err := ByID(ds, auditID)
+		if err != nil {
+			return xa, err
+		}
+		xa = append(xa, a)
+	}
+
+	return xa, nil
+}
+
+// create inserts an audit for the member evaluation period, and the activities to be verified
+func create(ds datastore.Datastore, evaluationID int, auditedBy string) (int, error) {
+
+	tx, err := ds.MySQL.Session.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(queries["insert-audit"], evaluationID, auditedBy)
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "insert-audit query error")
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec(queries["insert-audit-activities"], id, evaluationID)
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "insert-audit-activities query error")
+	}
+
+	return int(id), tx.Commit()
+}
+
+// query fetches audits with the clause added to the base query, and the activities for each one
+func query(ds datastore.Datastore, clause string, args ...interface{}) ([]Audit, error) {
+
+	var xa []Audit
+
+	rows, err := ds.MySQL.Session.Query(queries["select-audits"]+clause+` ORDER BY ca.id`, args...)
+	if err != nil {
+		return xa, errors.Wrap(err, "select-audits query error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a := Audit{}
+		err := rows.Scan(
+			&a.ID,
+			&a.EvaluationID,
+			&a.MemberID,
+			&a.Member,
+			&a.Email,
+			&a.StartDate,
+			&a.EndDate,
+			&a.CreatedAt,
+			&a.CompletedOn,
+			&a.Result,
+			&a.AuditedBy,
+			&a.Comment,
+		)
+		if err != nil {
+			return xa, errors.Wrap(err, "scan error")
+		}
+		a.Status = resultStatus[a.Result]
+		xa = append(xa, a)
+	}
+	if err := rows.Err(); err != nil {
+		return xa, err
+	}
+
+	for i := range xa {
+		xa[i].Activities, err = activities(ds, xa[i].ID)
+		if err != nil {
+			return xa, err
+		}
+	}
+
+	return xa, nil
+}
+
+func activities(ds datastore.Datastore, auditID int) ([]Activity, error) {
+
+	var xa []Activity
+
+	rows, err := ds.MySQL.Session.Query(queries["select-audit-activities"], auditID)
+	if err != nil {
+		return xa, errors.Wrap(err, "select-audit-activities query error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a := Activity{}
+		var evidence int
+		err := rows.Scan(
+			&a.ID,
+			&a.AuditID,
+			&a.ActivityID,
+			&a.Date,
+			&a.Activity,
+			&a.Description,
+			&a.Credit,
+			&evidence,
+			&a.Attachments,
+			&a.Verified,
+			&a.Reason,
+		)
+		if err != nil {
+			return xa, errors.Wrap(err, "scan error")
+		}
+		a.Evidence = evidence == 1
+		a.Status = verificationStatus[a.Verified]
+		xa = append(xa, a)
+	}
+
+	return xa, rows.Err()
+}
@@ -0,0 +1,192 @@
+package audit_test
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"github.com/cardiacsociety/web-services/internal/audit"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+	"github.com/cardiacsociety/web-services/testdata"
+)
+
+var ds datastore.Datastore
+
+func TestAudit(t *testing.T) {
+
+	var teardown func()
+	ds, teardown = setup()
+	defer teardown()
+
+	t.Run("audit", func(t *testing.T) {
+		t.Run("testPingDatabase", testPingDatabase)
+		t.Run("testSelect", testSelect)
+		t.Run("testSelectExcludesAudited", testSelectExcludesAudited)
+		t.Run("testVerify", testVerify)
+		t.Run("testComplete", testComplete)
+		t.Run("testExcelReport", testExcelReport)
+	})
+}
+
+func setup() (datastore.Datastore, func()) {
+	var db = testdata.NewDataStore()
+	err := db.SetupMySQL()
+	if err != nil {
+		log.Fatalf("db.SetupMySQL() err = %s", err)
+	}
+	return db.Store, func() {
+		err := db.TearDownMySQL()
+		if err != nil {
+			log.Fatalf("db.TearDownMySQL() err = %s", err)
+		}
+	}
+}
+
+func testPingDatabase(t *testing.T) {
+	err := ds.MySQL.Session.Ping()
+	if err != nil {
+		t.Fatalf("Ping() err = %s", err)
+	}
+}
+
+// member 1 has a single evaluation period ending 2020-12-31, with 3 activities recorded in 2018
+func testSelect(t *testing.T) {
+	is := is.New(t)
+	xa, err := audit.Select(ds, audit.Selection{From: "2020-01-01", To: "2020-12-31", Size: 5, AuditedBy: "Committee"})
+	is.NoErr(err)
+	is.Equal(len(xa), 1)        // audits created
+	is.Equal(xa[0].MemberID, 1) // member id
+	is.Equal(xa[0].Status, audit.StatusPending)
+	is.Equal(len(xa[0].Activities), 3) // activities to verify
+}
+
+func testSelectExcludesAudited(t *testing.T) {
+	is := is.New(t)
+	xa, err := audit.Select(ds, audit.Selection{From: "2020-01-01", To: "2020-12-31", Size: 5, AuditedBy: "Committee"})
+	is.NoErr(err)
+	is.Equal(len(xa), 0) // period already audited
+}
+
+func testVerify(t *testing.T) {
+	is := is.New(t)
+	a, err := audit.ByID(ds, 1)
+	is.NoErr(err)
+
+	err = audit.Verify(ds, a.Activities[0].ID, audit.VerificationRejected, "")
+	is.True(err != nil) // rejection without a reason
+
+	err = audit.Verify(ds, a.Activities[0].ID, audit.VerificationRejected, "No certificate")
+	is.NoErr(err)
+
+	a, err = audit.ByID(ds, 1)
+	is.NoErr(err)
+	is.Equal(a.Activities[0].Status, audit.StatusRejected)
+	is.Equal(a.Activities[0].Reason, "No certificate")
+}
+
+func testComplete(t *testing.T) {
+	is := is.New(t)
+	_, err := audit.Complete(ds, 1, "")
+	is.True(err != nil) // activities still pending
+
+	a, err := audit.ByID(ds, 1)
+	is.NoErr(err)
+	for _, act := range a.Activities[1:] {
+		err := audit.Verify(ds, act.ID, audit.VerificationAccepted, "")
+		is.NoErr(err)
+	}
+
+	a, err = audit.Complete(ds, 1, "Please attach certificates in future")
+	is.NoErr(err)
+	is.Equal(a.Status, audit.StatusFailed) // one activity was rejected
+	is.True(a.CompletedOn != "")
+
+	_, err = audit.Complete(ds, 1, "")
+	is.True(err != nil) // already completed
+	err = audit.Verify(ds, a.Activities[0].ID, audit.VerificationAccepted, "")
+	is.True(err != nil) // cannot change a completed audit
+	a, err = audit.ByID(ds, 1)
+	is.NoErr(err)
+	is.Equal(a.Activities[0].Status, audit.StatusRejected) // unchanged
+	is.Equal(a.Comment, "Please attach certificates in future")
+
+	xa, err := audit.ByMemberID(ds, 1)
+	is.NoErr(err)
+	is.Equal(len(xa), 1)
+}
+
+func testExcelReport(t *testing.T) {
+	is := is.New(t)
+	xa, err := audit.ByPeriod(ds, "2020-01-01", "2020-12-31")
+	is.NoErr(err)
+	f, err := audit.ExcelReport(xa)
+	is.NoErr(err)
+	rows := f.GetRows("Sheet1")
+	is.Equal(len(rows), 4) // heading and one row per activity
+}
+
+func TestSample(t *testing.T) {
+	is := is.New(t)
+	ids := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	r := rand.New(rand.NewSource(1))
+
+	xi := audit.Sample(ids, 4, r)
+	is.Equal(len(xi), 4)
+	seen := map[int]bool{}
+	for _, id := range xi {
+		is.True(!seen[id]) // no repeats
+		seen[id] = true
+	}
+
+	xi = audit.Sample(ids, 20, r)
+	sort.Ints(xi)
+	is.Equal(xi, ids)                                   // all ids when n > len(ids)
+	is.Equal(ids, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}) // ids not modified
+}
+
+func TestOutcomeEmail(t *testing.T) {
+	is := is.New(t)
+	a := audit.Audit{
+		Member:    "Michael Donnici",
+		Email:     "michael@test.com",
+		StartDate: "2018-01-01",
+		EndDate:   "2020-12-31",
+		Status:    audit.StatusFailed,
+		Activities: []audit.Activity{
+			{Date: "2018-02-03", Activity: "Reading", Verified: audit.VerificationAccepted},
+			{Date: "2018-02-05", Activity: "Teaching", Verified: audit.VerificationRejected, Reason: "No certificate"},
+		},
+	}
+	em := a.OutcomeEmail(audit.Sender{Name: "CPD Committee", Email: "cpd@test.com"})
+	is.Equal(em.ToEmail, "michael@test.com")
+	is.Equal(em.FromEmail, "cpd@test.com")
+	is.True(strings.Contains(em.PlainContent, "No certificate")) // rejection reason
+	is.True(!strings.Contains(em.PlainContent, "Reading"))       // accepted activity not listed
+}
+
+// TestOutcomeEmailEscape checks member data and admin comments are escaped in the HTML content
+func TestOutcomeEmailEscape(t *testing.T) {
+	is := is.New(t)
+	a := audit.Audit{
+		Member:  "Tom <b>Smith</b>",
+		Status:  audit.StatusFailed,
+		Comment: "See <a href='x'>here</a>",
+		Activities: []audit.Activity{
+			{Description: "<script>alert(1)</script>", Verified: audit.VerificationRejected, Reason: "No <i>certificate</i>"},
+		},
+	}
+	e := a.OutcomeEmail(audit.Sender{Name: "CPD Committee", Email: "cpd@test.com"})
+	for _, s := range []string{"<b>Smith", "<script>", "<a href", "<i>"} {
+		is.True(!strings.Contains(e.HTMLContent, s)) // member data is escaped
+	}
+	is.True(strings.Contains(e.HTMLContent, "&lt;script&gt;"))
+	is.True(strings.Contains(e.PlainContent, "<script>")) // plain text is not escaped
+
+	a.Activities = nil
+	e = a.OutcomeEmail(audit.Sender{})
+	is.True(strings.Contains(e.PlainContent, "No activities were recorded"))
+}
@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/cardiacsociety/web-services/internal/notification"
+)
+
+// Sender is the name and email address that audit notifications are sent from
+type Sender struct {
+	Name  string `json:"senderName"`
+	Email string `json:"senderEmail"`
+}
+
+// SelectedEmail returns the notification that tells a member their evaluation period has been selected for
+// audit, and lists the activities for which evidence is required
+func (a Audit) SelectedEmail(s Sender) notification.Email {
+
+	var plain, body strings.Builder
+	fmt.Fprintf(&plain, "Dear %s,\n\nYour CPD for the period %s to %s has been selected for audit. ", a.Member, a.StartDate, a.EndDate)
+	fmt.Fprintf(&plain, "Please make sure evidence is attached to each of the following activities:\n\n")
+	fmt.Fprintf(&body, "<p>Dear %s,</p><p>Your CPD for the period %s to %s has been selected for audit. ", html.EscapeString(a.Member), a.StartDate, a.EndDate)
+	fmt.Fprintf(&body, "Please make sure evidence is attached to each of the following activities:</p><ul>")
+	for _, act := range a.Activities {
+		fmt.Fprintf(&plain, "- %s %s: %s\n", act.Date, act.Activity, act.Description)
+		fmt.Fprintf(&body, "<li>%s %s: %s</li>", act.Date, html.EscapeString(act.Activity), html.EscapeString(act.Description))
+	}
+	body.WriteString("</ul>")
+
+	return a.email(s, "Your CPD has been selected for audit", plain.String(), body.String())
+}
+
+// OutcomeEmail returns the notification that tells a member the result of their audit, including the reason
+// for any rejected activities
+func (a Audit) OutcomeEmail(s Sender) notification.Email {
+
+	var plain, body strings.Builder
+	fmt.Fprintf(&plain, "Dear %s,\n\nThe audit of your CPD for the period %s to %s has been completed, with the result: %s.\n",
+		a.Member, a.StartDate, a.EndDate, a.Status)
+	fmt.Fprintf(&body, "<p>Dear %s,</p><p>The audit of your CPD for the period %s to %s has been completed, with the result: <b>%s</b>.</p>",
+		html.EscapeString(a.Member), a.StartDate, a.EndDate, a.Status)
+
+	var rejected []Activity
+	for _, act := range a.Activities {
+		if act.Verified == VerificationRejected {
+			rejected = append(rejected, act)
+		}
+	}
+	if len(a.Activities) == 0 {
+		plain.WriteString("\nNo activities were recorded for the period.\n")
+		body.WriteString("<p>No activities were recorded for the period.</p>")
+	}
+	if len(rejected) > 0 {
+		plain.WriteString("\nThe following activities were not accepted:\n\n")
+		body.WriteString("<p>The following activities were not accepted:</p><ul>")
+		for _, act := range rejected {
+			fmt.Fprintf(&plain, "- %s %s: %s (%s)\n", act.Date, act.Activity, act.Description, act.Reason)
+			fmt.Fprintf(&body, "<li>%s %s: %s (%s)</li>", act.Date, html.EscapeString(act.Activity),
+				html.EscapeString(act.Description), html.EscapeString(act.Reason))
+		}
+		body.WriteString("</ul>")
+	}
+	if a.Comment != "" {
+		fmt.Fprintf(&plain, "\n%s\n", a.Comment)
+		fmt.Fprintf(&body, "<p>%s</p>", html.EscapeString(a.Comment))
+	}
+
+	return a.email(s, "The result of your CPD audit", plain.String(), body.String())
+}
+
+func (a Audit) email(s Sender, subject, plain, body string) notification.Email {
+	return notification.Email{
+		FromName:     s.Name,
+		FromEmail:    s.Email,
+		ToName:       a.Member,
+		ToEmail:      a.Email,
+		Subject:      subject,
+		PlainContent: plain,
+		HTMLContent:  body,
+	}
+}
@@ -0,0 +1,112 @@
+package audit
+
+var queries = map[string]string{
+	"select-unaudited-evaluations":    selectUnauditedEvaluations,
+	"insert-audit":                    insertAudit,
+	"insert-audit-activities":         insertAuditActivities,
+	"select-audits":                   selectAudits,
+	"select-audit-activities":         selectAuditActivities,
+	"select-audit-activity-completed": selectAuditActivityCompleted,
+	"update-audit-activity":           updateAuditActivity,
+	"update-audit-complete":           updateAuditComplete,
+}
+
+const selectUnauditedEvaluations = `SELECT
+  cme.id
+FROM
+  ce_m_evaluation cme
+    LEFT JOIN
+  member m ON cme.member_id = m.id
+WHERE
+  cme.active = 1
+  AND m.active = 1
+  AND cme.end_on >= ?
+  AND cme.end_on <= ?
+  AND cme.id NOT IN (SELECT ce_m_evaluation_id FROM ce_audit WHERE active = 1)
+ORDER BY cme.id`
+
+const insertAudit = `INSERT INTO ce_audit
+  (ce_m_evaluation_id, active, created_at, updated_at, result, audited_by, comment)
+  VALUES (?, 1, NOW(), NOW(), 0, ?, '')`
+
+const insertAuditActivities = `INSERT INTO ce_audit_m_activity
+  (ce_audit_id, ce_m_activity_id, active, created_at, updated_at, verified, comment)
+SELECT
+  ?, cma.id, 1, NOW(), NOW(), 0, ''
+FROM
+  ce_m_activity cma
+    JOIN
+  ce_m_evaluation cme ON cma.member_id = cme.member_id
+WHERE
+  cme.id = ?
+  AND cma.active = 1
+  AND cma.activity_on >= cme.start_on
+  AND cma.activity_on <= cme.end_on`
+
+const selectAudits = `SELECT
+  ca.id,
+  ca.ce_m_evaluation_id,
+  cme.member_id,
+  CONCAT(COALESCE(m.first_name, ''), ' ', COALESCE(m.last_name, '')),
+  COALESCE(m.primary_email, ''),
+  cme.start_on,
+  cme.end_on,
+  ca.created_at,
+  COALESCE(ca.completed_on, ''),
+  ca.result,
+  ca.audited_by,
+  COALESCE(ca.comment, '')
+FROM
+  ce_audit ca
+    LEFT JOIN
+  ce_m_evaluation cme ON ca.ce_m_evaluation_id = cme.id
+    LEFT JOIN
+  member m ON cme.member_id = m.id
+WHERE
+  ca.active = 1`
+
+const selectAuditActivities = `SELECT
+  cama.id,
+  cama.ce_audit_id,
+  cma.id,
+  cma.activity_on,
+  COALESCE(ca.name, ''),
+  COALESCE(cma.description, ''),
+  (cma.quantity * cma.points_per_unit),
+  COALESCE(cma.evidence, 0),
+  (SELECT COUNT(*) FROM ce_m_activity_attachment WHERE active = 1 AND ce_m_activity_id = cma.id),
+  cama.verified,
+  COALESCE(cama.comment, '')
+FROM
+  ce_audit_m_activity cama
+    LEFT JOIN
+  ce_m_activity cma ON cama.ce_m_activity_id = cma.id
+    LEFT JOIN
+  ce_activity ca ON cma.ce_activity_id = ca.id
+WHERE
+  cama.active = 1
+  AND cama.ce_audit_id = ?
+ORDER BY cma.activity_on, cma.id`
+
+const selectAuditActivityCompleted = `SELECT
+  COALESCE(ca.completed_on, '')
+FROM
+  ce_audit_m_activity cama
+    JOIN
+  ce_audit ca ON cama.ce_audit_id = ca.id
+WHERE
+  cama.id = ?
+  AND cama.active = 1
+  AND ca.active = 1`
+
+const updateAuditActivity = `UPDATE ce_audit_m_activity cama
+    JOIN
+  ce_audit ca ON cama.ce_audit_id = ca.id
+SET cama.verified = ?, cama.comment = ?, cama.updated_at = NOW()
+WHERE
+  cama.id = ?
+  AND cama.active = 1
+  AND ca.completed_on IS NULL`
+
+const updateAuditComplete = `UPDATE ce_audit SET result = ?, comment = ?, completed_on = CURDATE(), updated_at = NOW()
+  WHERE id = ? AND active = 1 AND completed_on IS NULL LIMIT 1`
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+
+	"github.com/cardiacsociety/web-services/internal/platform/excel"
+)
+
+// ExcelReport returns an excel audit outcomes File, with one row per audited activity
+func ExcelReport(audits []Audit) (*excelize.File, error) {
+
+	f := excel.New([]string{
+		"Audit ID",
+		"Member",
+		"Start",
+		"End",
+		"Audited by",
+		"Completed",
+		"Result",
+		"Activity date",
+		"Activity",
+		"Description",
+		"Credit",
+		"Attachments",
+		"Verification",
+		"Reason",
+	})
+
+	for _, a := range audits {
+
+		startDate, endDate, completed := excelDate(a.StartDate), excelDate(a.EndDate), excelDate(a.CompletedOn)
+		member := a.Member + " [" + strconv.Itoa(a.MemberID) + "]"
+
+		// an audit without activity still gets a row
+		xa := a.Activities
+		if len(xa) == 0 {
+			xa = []Activity{{}}
+		}
+
+		for _, act := range xa {
+			data := []interface{}{
+				a.ID,
+				member,
+				startDate,
+				endDate,
+				a.AuditedBy,
+				completed,
+				a.Status,
+				excelDate(act.Date),
+				act.Activity,
+				act.Description,
+				act.Credit,
+				act.Attachments,
+				act.Status,
+				act.Reason,
+			}
+			err := f.AddRow(data)
+			if err != nil {
+				msg := fmt.Sprintf("AddRow() err = %s", err)
+				log.Printf(msg)
+				f.AddError(a.MemberID, msg)
+			}
+		}
+	}
+
+	// style
+	f.SetColWidthByHeading("Member", 30)
+	f.SetColStyleByHeading("Start", excel.DateStyle)
+	f.SetColWidthByHeading("Start", 14)
+	f.SetColStyleByHeading("End", excel.DateStyle)
+	f.SetColWidthByHeading("End", 14)
+	f.SetColWidthByHeading("Audited by", 20)
+	f.SetColStyleByHeading("Completed", excel.DateStyle)
+	f.SetColWidthByHeading("Completed", 14)
+	f.SetColStyleByHeading("Activity date", excel.DateStyle)
+	f.SetColWidthByHeading("Activity date", 14)
+	f.SetColWidthByHeading("Activity", 30)
+	f.SetColWidthByHeading("Description", 40)
+	f.SetColWidthByHeading("Reason", 40)
+
+	return f.XLSX, nil
+}
+
+// excelDate returns the date value for a cell, or an empty string if the date is bung
+func excelDate(s string) interface{} {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return ""
+	}
+	return d
+}
@@ -1,39 +1,90 @@
 package auth
 
 import (
+	"database/sql"
 	"fmt"
+	"log"
 
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
 )
 
-// AuthMember checks login & pass against db. Check for md5() or encrypted string.
-// Latter is a workaround to allow the old member app to get a token for file uploads.
+// AuthMember checks login & pass against the db, and returns the member id and name. A failed login returns
+// sql.ErrNoRows. A member with a legacy MD5 password has it replaced with a bcrypt hash on a successful login.
 func AuthMember(ds datastore.Datastore, u, p string) (int, string, error) {
 
-	query := `SELECT id, concat(first_name, ' ', last_name) as name
-		  FROM member WHERE primary_email = "%s" AND (password = MD5("%s") OR password = "%s")`
-	query = fmt.Sprintf(query, u, p, p)
-
 	var id int
-	var name string
-	err := ds.MySQL.Session.QueryRow(query).Scan(&id, &name)
-	// Note: err == sql.ErrorNoRows for a failed login
-	return id, name, err
+	var name, hash string
+	err := ds.MySQL.Session.QueryRow(queries["select-member-login"], u).Scan(&id, &name, &hash)
+	if err != nil {
+		return 0, "", err
+	}
+
+	ok, rehash := CheckPassword(hash, p)
+	if !ok {
+		return 0, "", sql.ErrNoRows
+	}
+	if rehash {
+		upgradePassword(ds, "member", "update-member-password", id, p)
+	}
+
+	return id, name, nil
 }
 
 // AdminAuth authenticates an admin user against the db. It received username and password
-// strings and returns the id and name of the authenticated admin
+// strings and returns the id and name of the authenticated admin. A failed login returns sql.ErrNoRows.
+// A legacy MD5 password is replaced with a bcrypt hash on a successful login.
 func AdminAuth(ds datastore.Datastore, u, p string) (int, string, error) {
 
-	query := `SELECT id, name, active, locked FROM ad_user WHERE
-	          username = "%s" AND (password = MD5("%s") OR password = "%s")`
-	query = fmt.Sprintf(query, u, p, p)
-
 	var id int
-	var name string
+	var name, hash string
 	var active int
 	var locked int
-	err := ds.MySQL.Session.QueryRow(query).Scan(&id, &name, &active, &locked)
+	err := ds.MySQL.Session.QueryRow(queries["select-admin-login"], u).Scan(&id, &name, &active, &locked, &hash)
+	if err != nil {
+		return 0, "", err
+	}
+
+	ok, rehash := CheckPassword(hash, p)
+	if !ok {
+		return 0, "", sql.ErrNoRows
+	}
+	if rehash {
+		upgradePassword(ds, "ad_user", "update-admin-password", id, p)
+	}
+
+	return id, name, nil
+}
+
+// upgradePassword stores a new hash of the password. A failure is logged rather than returned so that it does
+// not prevent the login, and the upgrade is tried again at the next login. The hash is not stored if the password
+// column of the table is too short to hold it, as a truncated hash would lock the user out - see the README.
+func upgradePassword(ds datastore.Datastore, table, query string, id int, p string) {
+
+	hash, err := HashPassword(p)
+	if err != nil {
+		log.Printf("upgradePassword() id %d hash err = %s", id, err)
+		return
+	}
+	err = checkPasswordColumn(ds, table, hash)
+	if err != nil {
+		log.Printf("upgradePassword() id %d err = %s", id, err)
+		return
+	}
+	_, err = ds.MySQL.Session.Exec(queries[query], hash, id)
+	if err != nil {
+		log.Printf("upgradePassword() id %d %s err = %s", id, query, err)
+	}
+}
 
-	return id, name, err
+// checkPasswordColumn returns an error if the password column of the table cannot hold the hash
+func checkPasswordColumn(ds datastore.Datastore, table, hash string) error {
+	var size int
+	err := ds.MySQL.Session.QueryRow(queries["select-password-column-size"], table).Scan(&size)
+	if err != nil {
+		return fmt.Errorf("select-password-column-size query error - %s", err)
+	}
+	if size < len(hash) {
+		return fmt.Errorf("%s.password holds %d characters, a hash is %d", table, size, len(hash))
+	}
+	return nil
 }
@@ -3,10 +3,15 @@ package auth_test
 import (
 	"database/sql"
 	"log"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cardiacsociety/web-services/internal/auth"
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+	"github.com/cardiacsociety/web-services/internal/platform/jwt"
 	"github.com/cardiacsociety/web-services/testdata"
 )
 
@@ -21,11 +26,25 @@ func TestAuth(t *testing.T) {
 	t.Run("auth", func(t *testing.T) {
 		t.Run("testPingDatabase", testPingDatabase)
 		t.Run("testAuthMemberClearPass", testAuthMemberClearPass)
-		t.Run("testAuthMemberMD5Pass", testAuthMemberMD5Pass)
+		t.Run("testAuthMemberRehash", testAuthMemberRehash)
 		t.Run("testAuthMemberFail", testAuthMemberFail)
 		t.Run("testAuthAdminClearPass", testAuthAdminClearPass)
-		t.Run("testAuthAdminMD5Pass", testAuthAdminMD5Pass)
+		t.Run("testAuthAdminRehash", testAuthAdminRehash)
 		t.Run("testAuthAdminFail", testAuthAdminFail)
+		t.Run("testAuthAdminNarrowColumn", testAuthAdminNarrowColumn)
+		t.Run("testResetComplete", testResetComplete)
+		t.Run("testResetRevokesTokens", testResetRevokesTokens)
+		t.Run("testResetUnknownEmail", testResetUnknownEmail)
+		t.Run("testResetLimit", testResetLimit)
+		t.Run("testResetLimitConcurrent", testResetLimitConcurrent)
+		t.Run("testResetShortPassword", testResetShortPassword)
+		t.Run("testInvite", testInvite)
+		t.Run("testRefreshRotate", testRefreshRotate)
+		t.Run("testRefreshReuse", testRefreshReuse)
+		t.Run("testRefreshExpired", testRefreshExpired)
+		t.Run("testRevokeRefresh", testRevokeRefresh)
+		t.Run("testRevokeToken", testRevokeToken)
+		t.Run("testRevokeUser", testRevokeUser)
 	})
 }
 
@@ -35,6 +54,10 @@ func setup() (datastore.Datastore, func()) {
 	if err != nil {
 		log.Fatalf("SetupMySQL() err = %s", err)
 	}
+	err = db.SetupMongoDB()
+	if err != nil {
+		log.Fatalf("SetupMongoDB() err = %s", err)
+	}
 	return db.Store, func() {
 		err := db.TearDownMySQL()
 		if err != nil {
@@ -65,18 +88,25 @@ func testAuthMemberClearPass(t *testing.T) {
 	}
 }
 
-func testAuthMemberMD5Pass(t *testing.T) {
-	gotId, gotName, err := auth.AuthMember(ds, "michael@mesa.net.au", "5f4dcc3b5aa765d61d8327deb882cf99")
+// testAuthMemberRehash checks that the legacy MD5 password was replaced with a bcrypt hash by the previous
+// login, that the new hash works, and that the old hash can no longer be used as the password
+func testAuthMemberRehash(t *testing.T) {
+	var hash string
+	err := ds.MySQL.Session.QueryRow("SELECT password FROM member WHERE id = 1").Scan(&hash)
 	if err != nil {
-		t.Fatalf("auth.AuthMember() err = %s", err)
+		t.Fatalf("select password err = %s", err)
 	}
-	wantId := 1
-	if gotId != wantId {
-		t.Errorf("Auth.AuthMember() id = %d, want %d", gotId, wantId)
+	if !strings.HasPrefix(hash, "$2") {
+		t.Errorf("member password = %q, want a bcrypt hash", hash)
 	}
-	wantName := "Michael Donnici"
-	if gotName != wantName {
-		t.Errorf("Auth.AuthMember() name = %q, want %q", gotName, wantName)
+
+	_, _, err = auth.AuthMember(ds, "michael@mesa.net.au", "password")
+	if err != nil {
+		t.Errorf("auth.AuthMember() after rehash err = %s", err)
+	}
+	_, _, err = auth.AuthMember(ds, "michael@mesa.net.au", "5f4dcc3b5aa765d61d8327deb882cf99")
+	if err != sql.ErrNoRows {
+		t.Errorf("auth.AuthMember() with old hash err = %v, want %v", err, sql.ErrNoRows)
 	}
 }
 
@@ -105,18 +135,20 @@ func testAuthAdminClearPass(t *testing.T) {
 	}
 }
 
-func testAuthAdminMD5Pass(t *testing.T) {
-	gotId, gotName, err := auth.AdminAuth(ds, "demo-admin", "41d0510a9067999b72f38ba0ce9f6195")
+// testAuthAdminRehash checks that the legacy MD5 password was replaced with a bcrypt hash by the previous login
+func testAuthAdminRehash(t *testing.T) {
+	var hash string
+	err := ds.MySQL.Session.QueryRow("SELECT password FROM ad_user WHERE id = 1").Scan(&hash)
 	if err != nil {
-		t.Fatalf("auth.AdminAuth() err = %s", err)
+		t.Fatalf("select password err = %s", err)
 	}
-	wantId := 1
-	if gotId != wantId {
-		t.Errorf("Auth.AdminAuth() id = %d, want %d", gotId, wantId)
+	if !strings.HasPrefix(hash, "$2") {
+		t.Errorf("admin password = %q, want a bcrypt hash", hash)
 	}
-	wantName := "Demo Admin"
-	if gotName != wantName {
-		t.Errorf("Auth.AdminAuth() name = %q, want %q", gotName, wantName)
+
+	_, _, err = auth.AdminAuth(ds, "demo-admin", "41d0510a9067999b72f38ba0ce9f6195")
+	if err != sql.ErrNoRows {
+		t.Errorf("auth.AdminAuth() with old hash err = %v, want %v", err, sql.ErrNoRows)
 	}
 }
 
@@ -132,3 +164,316 @@ func testAuthAdminFail(t *testing.T) {
 		t.Errorf("auth.AdminAuth() err = %v, want %v", err, sql.ErrNoRows)
 	}
 }
+
+// testAuthAdminNarrowColumn checks a legacy password is not replaced when the column is too short for the hash, as
+// for ad_user.password VARCHAR(45) in older databases, and that the login still succeeds
+func testAuthAdminNarrowColumn(t *testing.T) {
+	legacy := "41d0510a9067999b72f38ba0ce9f6195"
+	for _, q := range []string{
+		"ALTER TABLE ad_user MODIFY password VARCHAR(45) NOT NULL",
+		"UPDATE ad_user SET password = '" + legacy + "' WHERE id = 1",
+	} {
+		_, err := ds.MySQL.Session.Exec(q)
+		if err != nil {
+			t.Fatalf("Exec(%q) err = %s", q, err)
+		}
+	}
+	defer func() {
+		_, err := ds.MySQL.Session.Exec("ALTER TABLE ad_user MODIFY password VARCHAR(100) NOT NULL")
+		if err != nil {
+			t.Fatalf("restore ad_user.password err = %s", err)
+		}
+	}()
+
+	_, _, err := auth.AdminAuth(ds, "demo-admin", "demo-admin")
+	if err != nil {
+		t.Fatalf("auth.AdminAuth() err = %s", err)
+	}
+
+	var hash string
+	err = ds.MySQL.Session.QueryRow("SELECT password FROM ad_user WHERE id = 1").Scan(&hash)
+	if err != nil {
+		t.Fatalf("select password err = %s", err)
+	}
+	if hash != legacy {
+		t.Errorf("admin password = %q, want the legacy hash %q", hash, legacy)
+	}
+}
+
+// testResetComplete requests a reset, sets a new password with the token and checks the token cannot be used again
+func testResetComplete(t *testing.T) {
+	r, token, err := auth.RequestReset(ds, " Michael@mesa.net.au")
+	if err != nil {
+		t.Fatalf("auth.RequestReset() err = %s", err)
+	}
+	if r.MemberID != 1 {
+		t.Errorf("auth.RequestReset() member id = %d, want 1", r.MemberID)
+	}
+	if token == "" {
+		t.Fatal("auth.RequestReset() token is empty")
+	}
+
+	id, err := auth.CompleteReset(ds, token, "newPassword")
+	if err != nil {
+		t.Fatalf("auth.CompleteReset() err = %s", err)
+	}
+	if id != 1 {
+		t.Errorf("auth.CompleteReset() id = %d, want 1", id)
+	}
+
+	_, _, err = auth.AuthMember(ds, "michael@mesa.net.au", "newPassword")
+	if err != nil {
+		t.Errorf("auth.AuthMember() with new password err = %s", err)
+	}
+	_, _, err = auth.AuthMember(ds, "michael@mesa.net.au", "password")
+	if err != sql.ErrNoRows {
+		t.Errorf("auth.AuthMember() with old password err = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	_, err = auth.CompleteReset(ds, token, "anotherPassword")
+	if err != auth.ErrInvalidToken {
+		t.Errorf("auth.CompleteReset() reusing token err = %v, want %v", err, auth.ErrInvalidToken)
+	}
+}
+
+// testResetRevokesTokens checks that a password reset revokes the member's refresh tokens
+func testResetRevokesTokens(t *testing.T) {
+	_, rt, err := auth.NewRefresh(ds, 1, "Michael Donnici", "member", time.Hour)
+	if err != nil {
+		t.Fatalf("auth.NewRefresh() err = %s", err)
+	}
+	_, token, err := auth.Invite(ds, 1)
+	if err != nil {
+		t.Fatalf("auth.Invite() err = %s", err)
+	}
+	_, err = auth.CompleteReset(ds, token, "resetPassword")
+	if err != nil {
+		t.Fatalf("auth.CompleteReset() err = %s", err)
+	}
+	if _, _, err := auth.RotateRefresh(ds, rt); err != auth.ErrInvalidRefresh {
+		t.Errorf("auth.RotateRefresh() after reset err = %v, want %v", err, auth.ErrInvalidRefresh)
+	}
+}
+
+func testResetUnknownEmail(t *testing.T) {
+	_, token, err := auth.RequestReset(ds, "nobody@nowhere.com")
+	if err != sql.ErrNoRows {
+		t.Errorf("auth.RequestReset() err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if token != "" {
+		t.Errorf("auth.RequestReset() token = %q, want empty", token)
+	}
+}
+
+// testResetLimit checks that requests over the limit are refused, whether or not the email address is registered
+func testResetLimit(t *testing.T) {
+	for _, email := range []string{"michael@mesa.net.au", "limit@nowhere.com"} {
+		var err error
+		for i := 0; i < auth.ResetLimit+1; i++ {
+			_, _, err = auth.RequestReset(ds, email)
+		}
+		if err != auth.ErrTooManyResets {
+			t.Errorf("auth.RequestReset(%q) over limit err = %v, want %v", email, err, auth.ErrTooManyResets)
+		}
+	}
+}
+
+// testResetLimitConcurrent checks that concurrent requests cannot get past the limit
+func testResetLimitConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var allowed int
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := auth.RequestReset(ds, "concurrent@nowhere.com")
+			if err != auth.ErrTooManyResets {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != auth.ResetLimit {
+		t.Errorf("auth.RequestReset() allowed %d concurrent requests, want %d", allowed, auth.ResetLimit)
+	}
+}
+
+func testResetShortPassword(t *testing.T) {
+	_, token, err := auth.Invite(ds, 1)
+	if err != nil {
+		t.Fatalf("auth.Invite() err = %s", err)
+	}
+	_, err = auth.CompleteReset(ds, token, "short")
+	if err != auth.ErrPasswordTooShort {
+		t.Errorf("auth.CompleteReset() err = %v, want %v", err, auth.ErrPasswordTooShort)
+	}
+}
+
+func testInvite(t *testing.T) {
+	r, token, err := auth.Invite(ds, 1)
+	if err != nil {
+		t.Fatalf("auth.Invite() err = %s", err)
+	}
+	if !r.Invite || r.Email != "michael@mesa.net.au" {
+		t.Errorf("auth.Invite() = %+v, want an invite for michael@mesa.net.au", r)
+	}
+	if r.ExpiresAt.Sub(r.CreatedAt) != auth.InviteTTL {
+		t.Errorf("auth.Invite() ttl = %s, want %s", r.ExpiresAt.Sub(r.CreatedAt), auth.InviteTTL)
+	}
+
+	// invitations do not count towards the reset limit
+	_, err = auth.CompleteReset(ds, token, "invitedPassword")
+	if err != nil {
+		t.Errorf("auth.CompleteReset() err = %s", err)
+	}
+
+	_, _, err = auth.Invite(ds, 999999)
+	if err != sql.ErrNoRows {
+		t.Errorf("auth.Invite() unknown member err = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+// testRefreshRotate checks that a refresh token is replaced by a new one in the same family, with the same expiry
+func testRefreshRotate(t *testing.T) {
+	r1, token1, err := auth.NewRefresh(ds, 1, "Michael Donnici", "member", time.Hour)
+	if err != nil {
+		t.Fatalf("auth.NewRefresh() err = %s", err)
+	}
+	r2, token2, err := auth.RotateRefresh(ds, token1)
+	if err != nil {
+		t.Fatalf("auth.RotateRefresh() err = %s", err)
+	}
+	if token2 == "" || token2 == token1 {
+		t.Errorf("auth.RotateRefresh() token = %q, want a new token", token2)
+	}
+	if r2.Family != r1.Family || r2.ID != 1 || r2.Role != "member" {
+		t.Errorf("auth.RotateRefresh() = %+v, want family %s for member 1", r2, r1.Family.Hex())
+	}
+	// MongoDB stores times to the millisecond
+	if d := r2.ExpiresAt.Sub(r1.ExpiresAt); d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("auth.RotateRefresh() expires at %s, want %s", r2.ExpiresAt, r1.ExpiresAt)
+	}
+	_, _, err = auth.RotateRefresh(ds, token2)
+	if err != nil {
+		t.Errorf("auth.RotateRefresh() with new token err = %s", err)
+	}
+}
+
+// testRefreshReuse checks that using a refresh token twice revokes the whole family
+func testRefreshReuse(t *testing.T) {
+	_, token1, err := auth.NewRefresh(ds, 1, "Michael Donnici", "member", time.Hour)
+	if err != nil {
+		t.Fatalf("auth.NewRefresh() err = %s", err)
+	}
+	_, token2, err := auth.RotateRefresh(ds, token1)
+	if err != nil {
+		t.Fatalf("auth.RotateRefresh() err = %s", err)
+	}
+	_, _, err = auth.RotateRefresh(ds, token1)
+	if err != auth.ErrInvalidRefresh {
+		t.Errorf("auth.RotateRefresh() reused token err = %v, want %v", err, auth.ErrInvalidRefresh)
+	}
+	_, _, err = auth.RotateRefresh(ds, token2)
+	if err != auth.ErrInvalidRefresh {
+		t.Errorf("auth.RotateRefresh() after reuse err = %v, want %v", err, auth.ErrInvalidRefresh)
+	}
+}
+
+func testRefreshExpired(t *testing.T) {
+	_, token, err := auth.NewRefresh(ds, 1, "Michael Donnici", "member", -time.Minute)
+	if err != nil {
+		t.Fatalf("auth.NewRefresh() err = %s", err)
+	}
+	_, _, err = auth.RotateRefresh(ds, token)
+	if err != auth.ErrInvalidRefresh {
+		t.Errorf("auth.RotateRefresh() expired err = %v, want %v", err, auth.ErrInvalidRefresh)
+	}
+}
+
+func testRevokeRefresh(t *testing.T) {
+	_, token, err := auth.NewRefresh(ds, 1, "Demo Admin", "admin", time.Hour)
+	if err != nil {
+		t.Fatalf("auth.NewRefresh() err = %s", err)
+	}
+	err = auth.RevokeRefresh(ds, token)
+	if err != nil {
+		t.Fatalf("auth.RevokeRefresh() err = %s", err)
+	}
+	_, _, err = auth.RotateRefresh(ds, token)
+	if err != auth.ErrInvalidRefresh {
+		t.Errorf("auth.RotateRefresh() revoked err = %v, want %v", err, auth.ErrInvalidRefresh)
+	}
+	err = auth.RevokeRefresh(ds, "unknown")
+	if err != nil {
+		t.Errorf("auth.RevokeRefresh() unknown token err = %s", err)
+	}
+}
+
+func testRevokeToken(t *testing.T) {
+	jti := "0123456789abcdef"
+	revoked, err := auth.TokenRevoked(ds, jti)
+	if err != nil {
+		t.Fatalf("auth.TokenRevoked() err = %s", err)
+	}
+	if revoked {
+		t.Errorf("auth.TokenRevoked() = true before revocation")
+	}
+
+	err = auth.RevokeToken(ds, jti, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("auth.RevokeToken() err = %s", err)
+	}
+	revoked, err = auth.TokenRevoked(ds, jti)
+	if err != nil {
+		t.Fatalf("auth.TokenRevoked() err = %s", err)
+	}
+	if !revoked {
+		t.Errorf("auth.TokenRevoked() = false after revocation")
+	}
+
+	if err := auth.RevokeToken(ds, "", time.Now()); err == nil {
+		t.Errorf("auth.RevokeToken() without id err = nil, want an error")
+	}
+}
+
+func testRevokeUser(t *testing.T) {
+	os.Setenv("MAPPCPD_JWT_SIGNING_KEY", "testTokenSigningKey")
+	c := map[string]interface{}{"id": 7, "name": "Test Member", "role": "member"}
+	at, err := jwt.New("test", "testTokenSigningKey", 1).CustomClaims(c).Encode()
+	if err != nil {
+		t.Fatalf("jwt.Encode() err = %s", err)
+	}
+	_, rt, err := auth.NewRefresh(ds, 7, "Test Member", "member", time.Hour)
+	if err != nil {
+		t.Fatalf("auth.NewRefresh() err = %s", err)
+	}
+	if _, err := auth.DecodeToken(ds, at.Encoded); err != nil {
+		t.Fatalf("auth.DecodeToken() err = %s", err)
+	}
+
+	// the token is revoked even if it was issued in the same second as the revocation
+	err = auth.RevokeUser(ds, 7, "member")
+	if err != nil {
+		t.Fatalf("auth.RevokeUser() err = %s", err)
+	}
+
+	if _, err := auth.DecodeToken(ds, at.Encoded); err == nil {
+		t.Errorf("auth.DecodeToken() after RevokeUser err = nil, want an error")
+	}
+	if _, _, err := auth.RotateRefresh(ds, rt); err != auth.ErrInvalidRefresh {
+		t.Errorf("auth.RotateRefresh() after RevokeUser err = %v, want %v", err, auth.ErrInvalidRefresh)
+	}
+
+	// tokens issued to another user are not revoked
+	c["role"] = "admin"
+	at, err = jwt.New("test", "testTokenSigningKey", 1).CustomClaims(c).Encode()
+	if err != nil {
+		t.Fatalf("jwt.Encode() err = %s", err)
+	}
+	if _, err := auth.DecodeToken(ds, at.Encoded); err != nil {
+		t.Errorf("auth.DecodeToken() for another user err = %s", err)
+	}
+}
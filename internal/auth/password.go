@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptCost is the work factor used to hash new passwords
+const bcryptCost = 12
+
+// HashPassword returns a bcrypt hash of the password, suitable for storing
+func HashPassword(p string) (string, error) {
+	xb, err := bcrypt.GenerateFromPassword([]byte(p), bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(xb), nil
+}
+
+// CheckPassword compares a password with a stored hash. The hash is either bcrypt or, for legacy rows, an MD5 hex
+// string. If the password matches a legacy hash, or a bcrypt hash with a lower cost, rehash is true and the
+// password should be hashed again with HashPassword and stored.
+func CheckPassword(hash, p string) (ok bool, rehash bool) {
+
+	if strings.HasPrefix(hash, "$2") {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(p)) != nil {
+			return false, false
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return true, err == nil && cost < bcryptCost
+	}
+
+	sum := md5.Sum([]byte(p))
+	legacy := hex.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(strings.ToLower(hash)), []byte(legacy)) != 1 {
+		return false, false
+	}
+	return true, true
+}
+
+// RandomPassword returns a random password, eg for a new member who will set their own password via a reset
+func RandomPassword() (string, error) {
+	xb := make([]byte, 24)
+	_, err := rand.Read(xb)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(xb), nil
+}
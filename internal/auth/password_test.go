@@ -0,0 +1,46 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/cardiacsociety/web-services/internal/auth"
+)
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := auth.HashPassword("password")
+	if err != nil {
+		t.Fatalf("auth.HashPassword() err = %s", err)
+	}
+
+	cases := []struct {
+		hash     string
+		password string
+		ok       bool
+		rehash   bool
+	}{
+		{hash, "password", true, false},
+		{hash, "Password", false, false},
+		{hash, hash, false, false},
+		{"5f4dcc3b5aa765d61d8327deb882cf99", "password", true, true}, // legacy MD5
+		{"5F4DCC3B5AA765D61D8327DEB882CF99", "password", true, true},
+		{"5f4dcc3b5aa765d61d8327deb882cf99", "5f4dcc3b5aa765d61d8327deb882cf99", false, false},
+		{"", "", false, false},
+	}
+	for i, c := range cases {
+		ok, rehash := auth.CheckPassword(c.hash, c.password)
+		if ok != c.ok || rehash != c.rehash {
+			t.Errorf("case %d: auth.CheckPassword() = %v, %v, want %v, %v", i, ok, rehash, c.ok, c.rehash)
+		}
+	}
+}
+
+func TestRandomPassword(t *testing.T) {
+	p1, err := auth.RandomPassword()
+	if err != nil {
+		t.Fatalf("auth.RandomPassword() err = %s", err)
+	}
+	p2, _ := auth.RandomPassword()
+	if len(p1) < 32 || p1 == p2 {
+		t.Errorf("auth.RandomPassword() = %q, %q, want two different passwords of at least 32 characters", p1, p2)
+	}
+}
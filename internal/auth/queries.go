@@ -0,0 +1,33 @@
+package auth
+
+var queries = map[string]string{
+	"select-member-login":         selectMemberLogin,
+	"update-member-password":      updateMemberPassword,
+	"select-admin-login":          selectAdminLogin,
+	"update-admin-password":       updateAdminPassword,
+	"select-password-column-size": selectPasswordColumnSize,
+	"select-member-by-email":      selectMemberByEmail,
+	"select-member-by-id":         selectMemberByID,
+}
+
+// only active members that are allowed to log in, so a merged duplicate cannot log in
+const selectMemberLogin = `
+SELECT id, CONCAT(first_name, ' ', last_name), password FROM member
+WHERE active = 1 AND login = 1 AND primary_email = ?`
+
+const updateMemberPassword = `UPDATE member SET password = ?, updated_at = NOW() WHERE id = ?`
+
+const selectAdminLogin = `SELECT id, name, active, locked, password FROM ad_user WHERE username = ?`
+
+const updateAdminPassword = `UPDATE ad_user SET password = ?, updated_at = NOW() WHERE id = ?`
+
+// the size of the password column of a table, in the current database
+const selectPasswordColumnSize = `
+SELECT COALESCE(CHARACTER_MAXIMUM_LENGTH, 0) FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = 'password'`
+
+const selectMemberByEmail = `
+SELECT id, CONCAT(first_name, ' ', last_name) FROM member WHERE active = 1 AND primary_email = ?`
+
+const selectMemberByID = `
+SELECT id, CONCAT(first_name, ' ', last_name), COALESCE(primary_email, '') FROM member WHERE active = 1 AND id = ?`
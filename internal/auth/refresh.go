@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+	"github.com/cardiacsociety/web-services/internal/platform/jwt"
+)
+
+// ErrInvalidRefresh is returned when a refresh token is not found, has expired, or has been used or revoked
+var ErrInvalidRefresh = errors.New("the refresh token is invalid, expired or has been revoked")
+
+// Refresh is a refresh token, stored in MongoDB, that is exchanged for a new access token. Only a hash of the
+// token is stored. Each refresh token can be used once, and is replaced by a new one in the same family. The
+// family is started by a login and all of its tokens share the same expiry, so a session cannot be extended
+// beyond that. If a used token is presented again the family is revoked, as the token has been copied.
+type Refresh struct {
+	OID       bson.ObjectId `json:"_id" bson:"_id"`
+	Family    bson.ObjectId `json:"family" bson:"family"`
+	Hash      string        `json:"-" bson:"hash"`
+	ID        int           `json:"id" bson:"id"`
+	Name      string        `json:"name" bson:"name"`
+	Role      string        `json:"role" bson:"role"`
+	CreatedAt time.Time     `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time     `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time    `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+	RevokedAt *time.Time    `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// NewRefresh starts a new family of refresh tokens for a member or admin user that has logged in, and returns the
+// first token in the family. The family expires after ttl.
+func NewRefresh(ds datastore.Datastore, id int, name, role string, ttl time.Duration) (Refresh, string, error) {
+
+	now := time.Now()
+	r := Refresh{
+		OID:       bson.NewObjectId(),
+		ID:        id,
+		Name:      name,
+		Role:      role,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	r.Family = r.OID
+
+	token, err := r.insert(ds)
+	return r, token, err
+}
+
+// RotateRefresh uses a refresh token, and returns the next token in its family. It returns ErrInvalidRefresh if the
+// token cannot be used, and revokes the family if the token has been used before.
+func RotateRefresh(ds datastore.Datastore, token string) (Refresh, string, error) {
+
+	var r Refresh
+
+	col, err := ds.MongoDB.RefreshCol()
+	if err != nil {
+		return r, "", errors.Wrap(err, "RotateRefresh could not get refresh collection")
+	}
+
+	// marking the token as used in the same operation that finds it ensures it can only be used once
+	now := time.Now()
+	hash := hashToken(token)
+	_, err = col.Find(bson.M{
+		"hash":      hash,
+		"usedAt":    bson.M{"$exists": false},
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}).Apply(mgo.Change{Update: bson.M{"$set": bson.M{"usedAt": now}}, ReturnNew: true}, &r)
+	if err == mgo.ErrNotFound {
+		err = col.Find(bson.M{"hash": hash, "usedAt": bson.M{"$exists": true}}).One(&r)
+		if err == nil {
+			if err := revokeFamily(col, r.Family); err != nil {
+				return r, "", err
+			}
+		}
+		return r, "", ErrInvalidRefresh
+	}
+	if err != nil {
+		return r, "", errors.Wrap(err, "RotateRefresh find error")
+	}
+
+	next := Refresh{
+		OID:       bson.NewObjectId(),
+		Family:    r.Family,
+		ID:        r.ID,
+		Name:      r.Name,
+		Role:      r.Role,
+		CreatedAt: now,
+		ExpiresAt: r.ExpiresAt,
+	}
+	token, err = next.insert(ds)
+	return next, token, err
+}
+
+// RevokeRefresh revokes the family of a refresh token, eg at logout. An unknown token is ignored.
+func RevokeRefresh(ds datastore.Datastore, token string) error {
+
+	col, err := ds.MongoDB.RefreshCol()
+	if err != nil {
+		return errors.Wrap(err, "RevokeRefresh could not get refresh collection")
+	}
+
+	var r Refresh
+	err = col.Find(bson.M{"hash": hashToken(token)}).One(&r)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "RevokeRefresh find error")
+	}
+
+	return revokeFamily(col, r.Family)
+}
+
+// RevokeToken adds the id (jti claim) of an access token to the revocation list, until the token expires
+func RevokeToken(ds datastore.Datastore, jti string, expiresAt time.Time) error {
+
+	if jti == "" {
+		return errors.New("token does not have an id and cannot be revoked")
+	}
+
+	col, err := ds.MongoDB.RevokedCol()
+	if err != nil {
+		return errors.Wrap(err, "RevokeToken could not get revoked collection")
+	}
+	_, err = col.UpsertId(jti, bson.M{"$set": bson.M{"expiresAt": expiresAt, "revokedAt": time.Now()}})
+	if err != nil {
+		return errors.Wrap(err, "RevokeToken upsert error")
+	}
+
+	return nil
+}
+
+// RevokeUser revokes all of the refresh token families of a member or admin user, and the access tokens issued to
+// them before now, eg after a password reset or when the user can no longer log in
+func RevokeUser(ds datastore.Datastore, id int, role string) error {
+
+	now := time.Now()
+
+	col, err := ds.MongoDB.RefreshCol()
+	if err != nil {
+		return errors.Wrap(err, "RevokeUser could not get refresh collection")
+	}
+	_, err = col.UpdateAll(
+		bson.M{"id": id, "role": role, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": now}},
+	)
+	if err != nil {
+		return errors.Wrap(err, "RevokeUser refresh update error")
+	}
+
+	col, err = ds.MongoDB.RevokedCol()
+	if err != nil {
+		return errors.Wrap(err, "RevokeUser could not get revoked collection")
+	}
+	_, err = col.UpsertId(userKey(id, role), bson.M{"$set": bson.M{"revokedAt": now}})
+	if err != nil {
+		return errors.Wrap(err, "RevokeUser upsert error")
+	}
+
+	return nil
+}
+
+// TokenRevoked returns true if the id (jti claim) of an access token is on the revocation list
+func TokenRevoked(ds datastore.Datastore, jti string) (bool, error) {
+
+	if jti == "" {
+		return false, nil
+	}
+
+	col, err := ds.MongoDB.RevokedCol()
+	if err != nil {
+		return false, errors.Wrap(err, "TokenRevoked could not get revoked collection")
+	}
+	n, err := col.FindId(jti).Count()
+	if err != nil {
+		return false, errors.Wrap(err, "TokenRevoked count error")
+	}
+
+	return n > 0, nil
+}
+
+// DecodeToken decodes an access token signed with MAPPCPD_JWT_SIGNING_KEY, and checks that it has not been revoked
+func DecodeToken(ds datastore.Datastore, token string) (jwt.Token, error) {
+
+	at, err := jwt.Decode(token, os.Getenv("MAPPCPD_JWT_SIGNING_KEY"))
+	if err != nil {
+		return at, err
+	}
+
+	revoked, err := TokenRevoked(ds, at.Claims.Id)
+	if err != nil {
+		return at, err
+	}
+	if !revoked {
+		revoked, err = userRevoked(ds, at)
+		if err != nil {
+			return at, err
+		}
+	}
+	if revoked {
+		return at, errors.New("Token has been revoked")
+	}
+
+	return at, nil
+}
+
+// userRevoked returns true if the access token was issued before, or in the same second as, the user's tokens were
+// revoked by RevokeUser. The issued at claim is in whole seconds, so a token issued in the same second cannot be
+// ordered against the revocation and is treated as revoked.
+func userRevoked(ds datastore.Datastore, at jwt.Token) (bool, error) {
+
+	col, err := ds.MongoDB.RevokedCol()
+	if err != nil {
+		return false, errors.Wrap(err, "userRevoked could not get revoked collection")
+	}
+	var doc struct {
+		RevokedAt time.Time `bson:"revokedAt"`
+	}
+	err = col.FindId(userKey(at.Claims.ID, at.Claims.Role)).One(&doc)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "userRevoked find error")
+	}
+
+	return !at.IssuedAt.After(doc.RevokedAt.Truncate(time.Second)), nil
+}
+
+// userKey is the id of the revocation list entry for all of a user's tokens
+func userKey(id int, role string) string {
+	return fmt.Sprintf("%s:%d", role, id)
+}
+
+// insert stores the refresh token with a new token, and returns the token
+func (r *Refresh) insert(ds datastore.Datastore) (string, error) {
+
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	r.Hash = hash
+
+	col, err := ds.MongoDB.RefreshCol()
+	if err != nil {
+		return "", errors.Wrap(err, "insert could not get refresh collection")
+	}
+	err = col.Insert(r)
+	if err != nil {
+		return "", errors.Wrap(err, "insert refresh error")
+	}
+
+	return token, nil
+}
+
+// revokeFamily revokes all of the tokens in a family that have not already been revoked
+func revokeFamily(col *mgo.Collection, family bson.ObjectId) error {
+	_, err := col.UpdateAll(
+		bson.M{"family": family, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return errors.Wrap(err, "revoke refresh family error")
+	}
+	return nil
+}
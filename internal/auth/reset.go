@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// Reset token settings. A member can request ResetLimit resets for an email address in each ResetWindow.
+const (
+	ResetTTL          = time.Hour
+	InviteTTL         = 7 * 24 * time.Hour
+	ResetLimit        = 3
+	ResetWindow       = time.Hour
+	MinPasswordLength = 8
+)
+
+// Errors returned by the reset functions
+var (
+	ErrTooManyResets    = errors.New("too many password reset requests, please try again later")
+	ErrInvalidToken     = errors.New("the reset token is invalid, expired or has already been used")
+	ErrPasswordTooShort = errors.Errorf("password must be at least %d characters", MinPasswordLength)
+)
+
+// Reset is a request to set a member's password, stored in MongoDB. Only a hash of the token is stored, the token
+// itself is sent to the member. An invitation is a reset raised by an admin, for a new member, with a longer TTL.
+type Reset struct {
+	OID       bson.ObjectId `json:"_id" bson:"_id"`
+	Email     string        `json:"email" bson:"email"`
+	MemberID  int           `json:"memberId" bson:"memberId"`
+	Name      string        `json:"name" bson:"name"`
+	Hash      string        `json:"-" bson:"hash,omitempty"`
+	Invite    bool          `json:"invite" bson:"invite"`
+	CreatedAt time.Time     `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time     `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time    `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
+
+// RequestReset creates a reset for the active member with the email address, and returns it with the token to be
+// sent to the member. If no member has the email address it returns sql.ErrNoRows, and ErrTooManyResets if the
+// rate limit for the email address has been reached. Requests for unregistered email addresses count towards the
+// rate limit.
+func RequestReset(ds datastore.Datastore, email string) (Reset, string, error) {
+
+	r := Reset{
+		OID:       bson.NewObjectId(),
+		Email:     strings.ToLower(strings.TrimSpace(email)),
+		CreatedAt: time.Now(),
+	}
+	r.ExpiresAt = r.CreatedAt.Add(ResetTTL)
+
+	ok, err := allowReset(ds, r.Email, r.CreatedAt)
+	if err != nil {
+		return r, "", err
+	}
+	if !ok {
+		return r, "", ErrTooManyResets
+	}
+
+	err = ds.MySQL.Session.QueryRow(queries["select-member-by-email"], r.Email).Scan(&r.MemberID, &r.Name)
+	if err == sql.ErrNoRows {
+		return r, "", err
+	}
+	if err != nil {
+		return r, "", errors.Wrap(err, "select-member-by-email query error")
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return r, "", err
+	}
+	r.Hash = hash
+
+	col, err := ds.MongoDB.ResetsCol()
+	if err != nil {
+		return r, "", errors.Wrap(err, "RequestReset could not get resets collection")
+	}
+	err = col.Insert(r)
+	if err != nil {
+		return r, "", errors.Wrap(err, "RequestReset insert error")
+	}
+
+	return r, token, nil
+}
+
+// allowReset records a reset request for the email address, and returns false if ResetLimit requests were already
+// made in the ResetWindow before now. The times of the last ResetLimit requests are kept, and the request is added
+// and the earlier times are read in a single operation, so concurrent requests cannot all get under the limit.
+func allowReset(ds datastore.Datastore, email string, now time.Time) (bool, error) {
+
+	col, err := ds.MongoDB.ResetLimitsCol()
+	if err != nil {
+		return false, errors.Wrap(err, "allowReset could not get reset limits collection")
+	}
+
+	var prev struct {
+		Times []time.Time `bson:"times"`
+	}
+	_, err = col.FindId(email).Apply(mgo.Change{
+		Update: bson.M{"$push": bson.M{"times": bson.M{"$each": []time.Time{now}, "$slice": -ResetLimit}}},
+		Upsert: true,
+	}, &prev)
+	if err != nil && err != mgo.ErrNotFound {
+		return false, errors.Wrap(err, "allowReset update error")
+	}
+
+	return len(prev.Times) < ResetLimit || prev.Times[0].Before(now.Add(-ResetWindow)), nil
+}
+
+// Invite creates an invitation for the active member, so they can set their password, and returns it with the
+// token to be sent to the member.
+func Invite(ds datastore.Datastore, memberID int) (Reset, string, error) {
+
+	r := Reset{
+		OID:       bson.NewObjectId(),
+		Invite:    true,
+		CreatedAt: time.Now(),
+	}
+	r.ExpiresAt = r.CreatedAt.Add(InviteTTL)
+
+	err := ds.MySQL.Session.QueryRow(queries["select-member-by-id"], memberID).Scan(&r.MemberID, &r.Name, &r.Email)
+	if err == sql.ErrNoRows {
+		return r, "", err
+	}
+	if err != nil {
+		return r, "", errors.Wrap(err, "select-member-by-id query error")
+	}
+	if r.Email == "" {
+		return r, "", errors.Errorf("member id %d does not have a primary email address", memberID)
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return r, "", err
+	}
+	r.Hash = hash
+
+	col, err := ds.MongoDB.ResetsCol()
+	if err != nil {
+		return r, "", errors.Wrap(err, "Invite could not get resets collection")
+	}
+	err = col.Insert(r)
+	if err != nil {
+		return r, "", errors.Wrap(err, "Invite insert error")
+	}
+
+	return r, token, nil
+}
+
+// CompleteReset sets the password of the member for a reset token, and returns the member id. The token can only
+// be used once, and any other outstanding tokens for the member are cancelled. The member's existing access and
+// refresh tokens are revoked, so the member has to log in with the new password. It returns ErrInvalidToken if the
+// token is not found, has expired or has been used.
+func CompleteReset(ds datastore.Datastore, token, password string) (int, error) {
+
+	if len(password) < MinPasswordLength {
+		return 0, ErrPasswordTooShort
+	}
+
+	// hash, and check it can be stored, before the token is used up
+	hash, err := HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+	err = checkPasswordColumn(ds, "member", hash)
+	if err != nil {
+		return 0, err
+	}
+
+	col, err := ds.MongoDB.ResetsCol()
+	if err != nil {
+		return 0, errors.Wrap(err, "CompleteReset could not get resets collection")
+	}
+
+	// marking the token as used in the same operation that finds it ensures it can only be used once
+	now := time.Now()
+	var r Reset
+	_, err = col.Find(bson.M{
+		"hash":      hashToken(token),
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}).Apply(mgo.Change{Update: bson.M{"$set": bson.M{"usedAt": now}}, ReturnNew: true}, &r)
+	if err == mgo.ErrNotFound {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "CompleteReset find error")
+	}
+
+	_, err = ds.MySQL.Session.Exec(queries["update-member-password"], hash, r.MemberID)
+	if err != nil {
+		return 0, errors.Wrap(err, "update-member-password query error")
+	}
+
+	_, err = col.UpdateAll(
+		bson.M{"memberId": r.MemberID, "hash": bson.M{"$exists": true}, "usedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	)
+	if err != nil {
+		return r.MemberID, errors.Wrap(err, "CompleteReset cancel outstanding resets")
+	}
+
+	err = RevokeUser(ds, r.MemberID, "member")
+	if err != nil {
+		return r.MemberID, err
+	}
+
+	return r.MemberID, nil
+}
+
+// newToken returns a random token, and the hash of the token to be stored
+func newToken() (string, string, error) {
+	xb := make([]byte, 32)
+	_, err := rand.Read(xb)
+	if err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(xb)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of a token. A fast hash is fine as the token is random.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package cpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// carryOverEnv is the env var that holds the JSON carry-over policy
+const carryOverEnv = "MAPPCPD_CPD_CARRYOVER"
+
+// CarryOverPolicy sets how much surplus credit from one evaluation period can be carried into the next. Max
+// is the most credit that can be carried over, and a Max of 0 disables carry-over. If ActivityIDs is empty
+// then credit from all activities is eligible, otherwise only credit from the listed activities counts.
+type CarryOverPolicy struct {
+	Max         float64 `json:"max"`
+	ActivityIDs []int   `json:"activityIds"`
+}
+
+// CarryOverPolicyFromEnv returns the policy configured by the MAPPCPD_CPD_CARRYOVER env var, eg:
+// {"max": 20, "activityIds": [1, 2, 3]}. If the env var is not set carry-over is disabled.
+func CarryOverPolicyFromEnv() (CarryOverPolicy, error) {
+	var cp CarryOverPolicy
+	v := os.Getenv(carryOverEnv)
+	if v == "" {
+		return cp, nil
+	}
+	err := json.Unmarshal([]byte(v), &cp)
+	if err != nil {
+		return cp, fmt.Errorf("CarryOverPolicyFromEnv() err = %s", err)
+	}
+	if cp.Max < 0 {
+		return cp, fmt.Errorf("CarryOverPolicyFromEnv() max carry-over cannot be negative")
+	}
+	return cp, nil
+}
+
+// Surplus returns the credit from report e that can be carried into the following period. Only credit
+// obtained from activity within the period counts, so carried credit is never carried a second time.
+func (cp CarryOverPolicy) Surplus(e MemberActivityReport) float64 {
+
+	if cp.Max <= 0 {
+		return 0
+	}
+
+	surplus := e.CreditObtained - e.CreditCarriedOver - float64(e.CreditRequired)
+	if surplus <= 0 {
+		return 0
+	}
+
+	var eligible float64
+	for _, a := range e.Activities {
+		if cp.eligible(a.ActivityID) {
+			eligible += a.CreditAwarded
+		}
+	}
+
+	for _, limit := range []float64{eligible, cp.Max} {
+		if surplus > limit {
+			surplus = limit
+		}
+	}
+
+	return surplus
+}
+
+func (cp CarryOverPolicy) eligible(activityID int) bool {
+	if len(cp.ActivityIDs) == 0 {
+		return true
+	}
+	for _, id := range cp.ActivityIDs {
+		if id == activityID {
+			return true
+		}
+	}
+	return false
+}
+
+// applyCarryOver carries surplus credit forward through a member's reports, which must be sorted by start
+// date. Credit is carried from the most recent period that ended before each period started.
+func applyCarryOver(xe []MemberActivityReport, cp CarryOverPolicy) {
+	for i := range xe {
+		for j := i - 1; j >= 0; j-- {
+			if xe[j].EndDate < xe[i].StartDate {
+				xe[i].CreditCarriedOver = cp.Surplus(xe[j])
+				xe[i].CreditObtained += xe[i].CreditCarriedOver
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package cpd_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cardiacsociety/web-services/internal/cpd"
+	"github.com/matryer/is"
+)
+
+func TestCarryOverPolicyFromEnv(t *testing.T) {
+	is := is.New(t)
+	defer os.Unsetenv("MAPPCPD_CPD_CARRYOVER")
+
+	os.Unsetenv("MAPPCPD_CPD_CARRYOVER")
+	cp, err := cpd.CarryOverPolicyFromEnv()
+	is.NoErr(err)         // no policy set
+	is.Equal(cp.Max, 0.0) // carry-over disabled by default
+
+	os.Setenv("MAPPCPD_CPD_CARRYOVER", `{"max": 20, "activityIds": [1, 2]}`)
+	cp, err = cpd.CarryOverPolicyFromEnv()
+	is.NoErr(err)                    // valid policy
+	is.Equal(cp.Max, 20.0)           // max carry-over
+	is.Equal(len(cp.ActivityIDs), 2) // eligible activities
+
+	os.Setenv("MAPPCPD_CPD_CARRYOVER", `{"max": -1}`)
+	_, err = cpd.CarryOverPolicyFromEnv()
+	is.True(err != nil) // negative max
+}
+
+func TestCarryOverSurplus(t *testing.T) {
+	is := is.New(t)
+
+	r := cpd.MemberActivityReport{CreditRequired: 100, CreditObtained: 90}
+	cp := cpd.CarryOverPolicy{Max: 20}
+	is.Equal(cp.Surplus(r), 0.0) // no surplus
+
+	// surplus that was itself carried over cannot be carried again
+	r = cpd.MemberActivityReport{CreditRequired: 100, CreditObtained: 110, CreditCarriedOver: 15}
+	is.Equal(cp.Surplus(r), 0.0) // carried credit only
+
+	cp.Max = 0
+	r.CreditCarriedOver = 0
+	is.Equal(cp.Surplus(r), 0.0) // carry-over disabled
+}
+
+func TestCreatePDFWithCarryOver(t *testing.T) {
+	is := is.New(t)
+	f, err := os.Create(os.TempDir() + "/test-carryover.pdf")
+	defer f.Close()
+	is.NoErr(err) // Error creating pdf file
+
+	m := cpd.MemberActivityReport{
+		ID:                1,
+		CreditRequired:    100,
+		CreditObtained:    20,
+		CreditCarriedOver: 20,
+	}
+
+	err = cpd.PDFReport(m, f)
+	is.NoErr(err) // Could not create PDF
+}
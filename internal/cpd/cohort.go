@@ -0,0 +1,185 @@
+package cpd
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"github.com/pkg/errors"
+
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+	"github.com/cardiacsociety/web-services/internal/platform/excel"
+)
+
+// CohortFilter narrows a cohort report to members with one of the membership titles, and / or one of the
+// specialities. Empty lists are not applied.
+type CohortFilter struct {
+	TitleIDs      []int `json:"titleIds"`
+	SpecialityIDs []int `json:"specialityIds"`
+}
+
+// CohortRow is a summary of the current evaluation period for one member
+type CohortRow struct {
+	MemberID       int     `json:"memberId"`
+	Member         string  `json:"member"`
+	Title          string  `json:"title"`
+	ReportName     string  `json:"reportName"`
+	StartDate      string  `json:"startDate"`
+	EndDate        string  `json:"endDate"`
+	CreditRequired int     `json:"creditRequired"`
+	CreditObtained float64 `json:"creditObtained"`
+	Shortfall      float64 `json:"shortfall"`
+	Status         string  `json:"status"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// CohortReport returns the current evaluation period summary for every active member that matches the
+// filter, where active means a current status that is subject to CPD (ms_status.cpd), eg active or reinstated.
+// A member without an open evaluation period is included with empty period fields.
+func CohortReport(ds datastore.Datastore, f CohortFilter) ([]CohortRow, error) {
+
+	var xr []CohortRow
+
+	query, args := f.query()
+	rows, err := ds.MySQL.Session.Query(query, args...)
+	if err != nil {
+		return xr, errors.Wrap(err, "select-cohort-members query error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := CohortRow{}
+		err := rows.Scan(&r.MemberID, &r.Member, &r.Title)
+		if err != nil {
+			return xr, errors.Wrap(err, "scan error")
+		}
+		xr = append(xr, r)
+	}
+	if err := rows.Err(); err != nil {
+		return xr, err
+	}
+
+	// the reports for all of the members are generated together, so the number of queries does not grow with the
+	// size of the cohort
+	ids := make([]int, len(xr))
+	for i, r := range xr {
+		ids[i] = r.MemberID
+	}
+	reports, err := membersActivityReports(ds, ids)
+	if err != nil {
+		return xr, err
+	}
+	for i := range xr {
+		xr[i].setEvaluation(currentReport(reports[xr[i].MemberID]))
+	}
+
+	return xr, nil
+}
+
+// query adds the filter conditions to the base cohort query
+func (f CohortFilter) query() (string, []interface{}) {
+
+	query := Queries["select-cohort-members"]
+	var args []interface{}
+
+	if len(f.TitleIDs) > 0 {
+		query += ` AND mmt.ms_title_id IN (` + placeholders(len(f.TitleIDs)) + `)`
+		for _, id := range f.TitleIDs {
+			args = append(args, id)
+		}
+	}
+	if len(f.SpecialityIDs) > 0 {
+		query += ` AND m.id IN (SELECT member_id FROM mp_m_speciality WHERE active = 1 AND mp_speciality_id IN (` +
+			placeholders(len(f.SpecialityIDs)) + `))`
+		for _, id := range f.SpecialityIDs {
+			args = append(args, id)
+		}
+	}
+
+	return query + ` ORDER BY m.last_name, m.first_name`, args
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// setEvaluation sets the summary fields from the member's current evaluation period report
+func (r *CohortRow) setEvaluation(e MemberActivityReport) {
+	if e.ID == 0 {
+		r.Error = "No current evaluation period"
+		return
+	}
+	r.ReportName = e.ReportName
+	r.StartDate = e.StartDate
+	r.EndDate = e.EndDate
+	r.CreditRequired = e.CreditRequired
+	r.CreditObtained = e.CreditObtained
+	if e.CreditObtained < float64(e.CreditRequired) {
+		r.Shortfall = round2(float64(e.CreditRequired) - e.CreditObtained)
+	}
+	r.Status = e.Compliance.Status
+}
+
+// CohortExcelReport returns an excel cohort report File
+func CohortExcelReport(rows []CohortRow) (*excelize.File, error) {
+
+	f := excel.New([]string{
+		"Member",
+		"Title",
+		"Evaluation",
+		"Start",
+		"End",
+		"Required",
+		"Obtained",
+		"Shortfall",
+		"Status",
+	})
+
+	for _, r := range rows {
+
+		if r.Error != "" {
+			f.AddError(r.MemberID, r.Error)
+		}
+
+		// If dates are bung set to an empty string
+		var startDate, endDate interface{} = "", ""
+		if d, err := time.Parse("2006-01-02", r.StartDate); err == nil {
+			startDate = d
+		}
+		if d, err := time.Parse("2006-01-02", r.EndDate); err == nil {
+			endDate = d
+		}
+
+		data := []interface{}{
+			r.Member + " [" + strconv.Itoa(r.MemberID) + "]",
+			r.Title,
+			r.ReportName,
+			startDate,
+			endDate,
+			r.CreditRequired,
+			r.CreditObtained,
+			r.Shortfall,
+			r.Status,
+		}
+		err := f.AddRow(data)
+		if err != nil {
+			msg := fmt.Sprintf("AddRow() err = %s", err)
+			log.Printf(msg)
+			f.AddError(r.MemberID, msg)
+		}
+	}
+
+	// style
+	f.SetColWidthByHeading("Member", 30)
+	f.SetColWidthByHeading("Title", 18)
+	f.SetColWidthByHeading("Evaluation", 18)
+	f.SetColStyleByHeading("Start", excel.DateStyle)
+	f.SetColWidthByHeading("Start", 14)
+	f.SetColStyleByHeading("End", excel.DateStyle)
+	f.SetColWidthByHeading("End", 14)
+
+	return f.XLSX, nil
+}
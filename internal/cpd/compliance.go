@@ -0,0 +1,84 @@
+package cpd
+
+import (
+	"math"
+	"time"
+)
+
+// Compliance status values
+const (
+	StatusCompliant    = "compliant"
+	StatusOnTrack      = "on-track"
+	StatusAtRisk       = "at-risk"
+	StatusNonCompliant = "non-compliant"
+)
+
+// Compliance is a verdict on an evaluation period, along with a projection of the credit a member will
+// have obtained by the end of the period if they continue to record activity at the same rate.
+type Compliance struct {
+	Status             string  `json:"status" bson:"status"`
+	DaysElapsed        int     `json:"daysElapsed" bson:"daysElapsed"`
+	DaysRemaining      int     `json:"daysRemaining" bson:"daysRemaining"`
+	DailyRate          float64 `json:"dailyRate" bson:"dailyRate"`
+	ProjectedCredit    float64 `json:"projectedCredit" bson:"projectedCredit"`
+	ProjectedShortfall float64 `json:"projectedShortfall" bson:"projectedShortfall"`
+}
+
+// SetCompliance evaluates the report as at time t and sets the .Compliance field. It should be called after
+// the credit has been calculated, ie after ApplyRules() and any carry-over.
+//
+// - compliant: credit required has been obtained and all minimum rules are met
+// - non-compliant: the period has ended and the requirements were not satisfied
+// - on-track: the projected credit at the end of the period satisfies the requirement
+// - at-risk: the projected credit falls short, or a minimum rule has not yet been met
+func (e *MemberActivityReport) SetCompliance(t time.Time) {
+
+	c := Compliance{}
+	required := float64(e.CreditRequired)
+
+	start, err1 := time.Parse("2006-01-02", e.StartDate)
+	end, err2 := time.Parse("2006-01-02", e.EndDate)
+	if err1 != nil || err2 != nil {
+		c.Status = StatusAtRisk
+		e.Compliance = c
+		return
+	}
+
+	// Count whole days, inclusive of the start and end dates
+	day := 24 * time.Hour
+	today, _ := time.Parse("2006-01-02", t.Format("2006-01-02"))
+	totalDays := int(end.Sub(start)/day) + 1
+	c.DaysElapsed = int(today.Sub(start)/day) + 1
+	if c.DaysElapsed < 1 {
+		c.DaysElapsed = 1
+	}
+	if c.DaysElapsed > totalDays {
+		c.DaysElapsed = totalDays
+	}
+	c.DaysRemaining = totalDays - c.DaysElapsed
+
+	// credit carried over from the previous period does not count towards the rate of recording
+	c.DailyRate = (e.CreditObtained - e.CreditCarriedOver) / float64(c.DaysElapsed)
+	c.ProjectedCredit = round2(e.CreditObtained + c.DailyRate*float64(c.DaysRemaining))
+	c.DailyRate = round2(c.DailyRate)
+	if c.ProjectedCredit < required {
+		c.ProjectedShortfall = round2(required - c.ProjectedCredit)
+	}
+
+	switch {
+	case e.CreditObtained >= required && e.RulesMet():
+		c.Status = StatusCompliant
+	case c.DaysRemaining == 0 || e.Closed:
+		c.Status = StatusNonCompliant
+	case c.ProjectedShortfall == 0 && e.RulesMet():
+		c.Status = StatusOnTrack
+	default:
+		c.Status = StatusAtRisk
+	}
+
+	e.Compliance = c
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
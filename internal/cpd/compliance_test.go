@@ -0,0 +1,43 @@
+package cpd_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cardiacsociety/web-services/internal/cpd"
+	"github.com/matryer/is"
+)
+
+func TestSetCompliance(t *testing.T) {
+	is := is.New(t)
+
+	// halfway through a two year period
+	at := time.Date(2018, 12, 31, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		obtained  float64
+		closed    bool
+		at        time.Time
+		want      string
+		shortfall float64
+	}{
+		{100, false, at, cpd.StatusCompliant, 0},
+		{60, false, at, cpd.StatusOnTrack, 0},
+		{40, false, at, cpd.StatusAtRisk, 20},
+		{40, true, at, cpd.StatusNonCompliant, 20},
+		{80, false, time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), cpd.StatusNonCompliant, 20},
+	}
+
+	for _, c := range cases {
+		r := cpd.MemberActivityReport{
+			StartDate:      "2018-01-01",
+			EndDate:        "2019-12-31",
+			CreditRequired: 100,
+			CreditObtained: c.obtained,
+			Closed:         c.closed,
+		}
+		r.SetCompliance(c.at)
+		is.Equal(r.Compliance.Status, c.want)                  // compliance status
+		is.Equal(r.Compliance.ProjectedShortfall, c.shortfall) // projected shortfall
+	}
+}
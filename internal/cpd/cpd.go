@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
@@ -53,19 +54,34 @@ func ByMemberID(ds datastore.Datastore, memberID int) ([]CPD, error) {
 	return cpdByMemberID(ds, memberID)
 }
 
-// Query runs the base cpd query with any filter clause
-func Query(ds datastore.Datastore, sqlClause string) ([]CPD, error) {
-	return cpdQuery(ds, sqlClause)
+// Query runs the base cpd query with a filter, eg datastore.NewFilter().Equal("cma.member_id", 1). A nil filter
+// selects all cpd.
+func Query(ds datastore.Datastore, f *datastore.Filter) ([]CPD, error) {
+	clause, args, err := f.Where()
+	if err != nil {
+		return nil, err
+	}
+	return cpdQueryArgs(ds, clause, args...)
 }
 
 // Add inserts a new cpd record into the specified datastore, and returns the new id - used for testing
 func Add(ds datastore.Datastore, a Input) (int, error) {
-	return add(ds, a)
+	return add(ds, a, MemberEditor(a.MemberID))
+}
+
+// AddAs inserts a new cpd record, recording the change history against the editor
+func AddAs(ds datastore.Datastore, a Input, e Editor) (int, error) {
+	return add(ds, a, e)
 }
 
 // Update updates a cpd record in the specified store - used for testing
 func Update(ds datastore.Datastore, a Input) error {
-	return update(ds, a)
+	return update(ds, a, MemberEditor(a.MemberID))
+}
+
+// UpdateAs updates a cpd record, recording the change history against the editor
+func UpdateAs(ds datastore.Datastore, a Input, e Editor) error {
+	return update(ds, a, e)
 }
 
 // DuplicateOf returns the id of a duplicate member activity, or 0 if not found - from the specified store
@@ -73,9 +89,14 @@ func DuplicateOf(ds datastore.Datastore, a Input) (int, error) {
 	return duplicateOf(ds, a)
 }
 
-// Delete ensures the record is owned by MemberID before deleting from specified datastore - used for testing
+// Delete ensures the record is owned by MemberID before (soft) deleting from specified datastore - used for testing
 func Delete(ds datastore.Datastore, memberID, activityID int) error {
-	return delete(ds, memberID, activityID)
+	return delete(ds, memberID, activityID, MemberEditor(memberID))
+}
+
+// DeleteAs (soft) deletes a cpd record owned by memberID, recording the change history against the editor
+func DeleteAs(ds datastore.Datastore, memberID, activityID int, e Editor) error {
+	return delete(ds, memberID, activityID, e)
 }
 
 func cpdByID(ds datastore.Datastore, id int) (CPD, error) {
@@ -171,12 +192,13 @@ func cpdByMemberID(ds datastore.Datastore, id int) ([]CPD, error) {
 	return xc, nil
 }
 
-func cpdQuery(ds datastore.Datastore, clause string) ([]CPD, error) {
+// cpdQueryArgs runs the base cpd query with a clause containing placeholders for args
+func cpdQueryArgs(ds datastore.Datastore, clause string, args ...interface{}) ([]CPD, error) {
 
 	var xc []CPD
 
 	query := Queries["select-member-activity"] + ` ` + clause
-	rows, err := ds.MySQL.Session.Query(query)
+	rows, err := ds.MySQL.Session.Query(query, args...)
 	if err != nil {
 		return xc, err
 	}
@@ -221,7 +243,7 @@ func cpdQuery(ds datastore.Datastore, clause string) ([]CPD, error) {
 	return xc, nil
 }
 
-func add(ds datastore.Datastore, a Input) (int, error) {
+func add(ds datastore.Datastore, a Input, e Editor) (int, error) {
 
 	validate := validator.New()
 	err := validate.Struct(a)
@@ -245,24 +267,39 @@ func add(ds datastore.Datastore, a Input) (int, error) {
 	query := `INSERT INTO ce_m_activity
 	(member_id, ce_activity_id, ce_activity_type_id, evidence, created_at, updated_at,
 	activity_on, quantity, points_per_unit, description)
-	VALUES("%v", "%v", "%v", "%v", NOW(), NOW(), "%v", "%v", "%v", "%v")`
-	query = fmt.Sprintf(query, a.MemberID, a.ActivityID, a.TypeID, evidence, a.Date, a.Quantity, a.UnitCredit, a.Description)
+	VALUES(?, ?, ?, ?, NOW(), NOW(), ?, ?, ?, ?)`
+
+	tx, err := ds.MySQL.Session.Begin()
+	if err != nil {
+		return 0, err
+	}
 
-	r, err := ds.MySQL.Session.Exec(query)
+	r, err := tx.Exec(query, a.MemberID, a.ActivityID, a.TypeID, evidence, a.Date, a.Quantity, a.UnitCredit, a.Description)
 	if err != nil {
+		tx.Rollback()
 		return 0, err
 	}
 
 	// Get the new id...
 	id, err := r.LastInsertId()
 	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	after, err := snapshot(tx, int(id))
+	if err == nil {
+		err = logChange(tx, e, int(id), actionInsert, nil, after)
+	}
+	if err != nil {
+		tx.Rollback()
 		return 0, err
 	}
 
-	return int(id), nil
+	return int(id), tx.Commit()
 }
 
-func update(ds datastore.Datastore, a Input) error {
+func update(ds datastore.Datastore, a Input, e Editor) error {
 
 	validate := validator.New()
 	err := validate.Struct(a)
@@ -282,24 +319,21 @@ func update(ds datastore.Datastore, a Input) error {
 		evidence = 1
 	}
 
-	query := `UPDATE ce_m_activity SET ce_activity_id= "%v", ce_activity_type_id= "%v", evidence= "%v",
-    updated_at = NOW(), activity_on = "%v", quantity= "%v", points_per_unit= "%v", description = "%v"
-    WHERE id = %v LIMIT 1`
-	query = fmt.Sprintf(query, a.ActivityID, a.TypeID, evidence, a.Date, a.Quantity, a.UnitCredit, a.Description, a.ID)
-	_, err = ds.MySQL.Session.Exec(query)
-	if err != nil {
-		return err
-	}
+	query := `UPDATE ce_m_activity SET ce_activity_id = ?, ce_activity_type_id = ?, evidence = ?,
+    updated_at = NOW(), activity_on = ?, quantity = ?, points_per_unit = ?, description = ?
+    WHERE member_id = ? AND id = ? AND active = 1 LIMIT 1`
 
-	return nil
+	want := map[string]string{"member_id": strconv.Itoa(a.MemberID), "active": "1"}
+	return changeWithHistory(ds, e, a.ID, actionUpdate, want, query,
+		a.ActivityID, a.TypeID, evidence, a.Date, a.Quantity, a.UnitCredit, a.Description, a.MemberID, a.ID)
 }
 
-// delete requires memberID to ensure ownership of the cpd record
-func delete(ds datastore.Datastore, memberID, activityID int) error {
-	query := `DELETE FROM ce_m_activity WHERE member_id = %d AND id = %d LIMIT 1`
-	query = fmt.Sprintf(query, memberID, activityID)
-	_, err := ds.MySQL.Session.Exec(query)
-	return err
+// delete requires memberID to ensure ownership of the cpd record. Records are soft deleted so that the
+// change history is complete, and so they can be restored.
+func delete(ds datastore.Datastore, memberID, activityID int, e Editor) error {
+	query := `UPDATE ce_m_activity SET active = 0, updated_at = NOW() WHERE member_id = ? AND id = ? AND active = 1 LIMIT 1`
+	want := map[string]string{"member_id": strconv.Itoa(memberID), "active": "1"}
+	return changeWithHistory(ds, e, activityID, actionDelete, want, query, memberID, activityID)
 }
 
 func duplicateOf(ds datastore.Datastore, a Input) (int, error) {
@@ -312,11 +346,10 @@ func duplicateOf(ds datastore.Datastore, a Input) (int, error) {
 		return dupId, err
 	}
 
-	query := `SELECT id FROM ce_m_activity WHERE member_id = "%v" AND ce_activity_id = "%v" AND 
-		ce_activity_type_id = "%v" AND activity_on = "%v" AND description = "%v" LIMIT 1`
-	query = fmt.Sprintf(query, a.MemberID, a.ActivityID, a.TypeID, a.Date, a.Description)
+	query := `SELECT id FROM ce_m_activity WHERE active = 1 AND member_id = ? AND ce_activity_id = ? AND
+		ce_activity_type_id = ? AND activity_on = ? AND description = ? LIMIT 1`
 
-	err = ds.MySQL.Session.QueryRow(query).Scan(&dupId)
+	err = ds.MySQL.Session.QueryRow(query, a.MemberID, a.ActivityID, a.TypeID, a.Date, a.Description).Scan(&dupId)
 	if err == sql.ErrNoRows {
 		return dupId, nil
 	}
@@ -2,7 +2,13 @@ package cpd_test
 
 import (
 	"log"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/cardiacsociety/web-services/internal/cpd"
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
@@ -25,10 +31,20 @@ func TestCPD(t *testing.T) {
 		t.Run("testCPDByID", testCPDByID)
 		t.Run("testCPDByMemberID", testCPDByMemberID)
 		t.Run("testCPDQuery", testCPDQuery)
+		t.Run("testCurrentEvaluationPeriodReport", testCurrentEvaluationPeriodReport)
+		t.Run("testEvaluationRules", testEvaluationRules)
+		t.Run("testCohortReport", testCohortReport)
+		t.Run("testImportDryRun", testImportDryRun)
 		t.Run("testAddCPD", testAddCPD)
 		t.Run("testUpdateCPD", testUpdateCPD)
 		t.Run("testDuplicateOf", testDuplicateOf)
 		t.Run("testDelete", testDelete)
+		t.Run("testHistory", testHistory)
+		t.Run("testUpdateNotFound", testUpdateNotFound)
+		t.Run("testRestore", testRestore)
+		t.Run("testRolloverPeriods", testRolloverPeriods)
+		t.Run("testRecurringCatchUp", testRecurringCatchUp)
+		t.Run("testRecurringAutoRecordNoType", testRecurringAutoRecordNoType)
 	})
 }
 
@@ -38,11 +54,19 @@ func setup() (datastore.Datastore, func()) {
 	if err != nil {
 		log.Fatalf("SetupMySQL() err = %s", err)
 	}
+	err = db.SetupMongoDB()
+	if err != nil {
+		log.Fatalf("SetupMongoDB() err = %s", err)
+	}
 	return db.Store, func() {
 		err := db.TearDownMySQL()
 		if err != nil {
 			log.Fatalf("TearDownMySQL() err = %s", err)
 		}
+		err = db.TearDownMongoDB()
+		if err != nil {
+			log.Fatalf("TearDownMongoDB() err = %s", err)
+		}
 	}
 }
 
@@ -90,7 +114,7 @@ func testCPDByMemberID(t *testing.T) {
 }
 
 func testCPDQuery(t *testing.T) {
-	xc, err := cpd.Query(ds, "WHERE cma.description LIKE '%Bruno%'")
+	xc, err := cpd.Query(ds, datastore.NewFilter().Like("cma.description", "%Bruno%"))
 	if err != nil {
 		t.Fatalf("cpd.Query() err = %s", err)
 	}
@@ -101,6 +125,131 @@ func testCPDQuery(t *testing.T) {
 	}
 }
 
+func testCurrentEvaluationPeriodReport(t *testing.T) {
+	arg := 1 // member id
+	r, err := cpd.CurrentEvaluationPeriodReport(ds, arg)
+	if err != nil {
+		t.Fatalf("cpd.CurrentEvaluationPeriodReport(%d) err = %s", arg, err)
+	}
+	got := r.CreditObtained
+	want := 5.0
+	if got != want {
+		t.Errorf("cpd.CurrentEvaluationPeriodReport(%d).CreditObtained = %.2f, want %.2f", arg, got, want)
+	}
+}
+
+func testEvaluationRules(t *testing.T) {
+	rules := `[
+		{"name": "Group learning min", "type": "category-min", "categoryId": 10, "value": 10},
+		{"name": "Group learning yearly cap", "type": "per-year-max", "activityId": 23, "value": 1}
+	]`
+	os.Setenv("MAPPCPD_CPD_RULES", rules)
+	defer os.Unsetenv("MAPPCPD_CPD_RULES")
+
+	arg := 1 // member id
+	r, err := cpd.CurrentEvaluationPeriodReport(ds, arg)
+	if err != nil {
+		t.Fatalf("cpd.CurrentEvaluationPeriodReport(%d) err = %s", arg, err)
+	}
+
+	// two group learning activities in 2018 are capped at 1 credit for the year
+	got := r.CreditObtained
+	want := 4.0
+	if got != want {
+		t.Errorf("cpd.CurrentEvaluationPeriodReport(%d).CreditObtained = %.2f, want %.2f", arg, got, want)
+	}
+
+	// the per-year cap is applied before the minimum is checked, regardless of declared order
+	if len(r.Rules) != 2 {
+		t.Fatalf("cpd.CurrentEvaluationPeriodReport(%d).Rules count = %d, want 2", arg, len(r.Rules))
+	}
+	if r.Rules[0].Type != cpd.RulePerYearMax || !r.Rules[0].Applied {
+		t.Errorf("Rules[0] = %+v, want applied %s", r.Rules[0], cpd.RulePerYearMax)
+	}
+	if r.RulesMet() {
+		t.Errorf("RulesMet() = true, want false")
+	}
+}
+
+func testCohortReport(t *testing.T) {
+
+	cases := []struct {
+		filter cpd.CohortFilter
+		want   int // rows
+	}{
+		{cpd.CohortFilter{}, 1},
+		{cpd.CohortFilter{TitleIDs: []int{2}}, 1},
+		{cpd.CohortFilter{TitleIDs: []int{99}}, 0},
+	}
+
+	for _, c := range cases {
+		xr, err := cpd.CohortReport(ds, c.filter)
+		if err != nil {
+			t.Fatalf("cpd.CohortReport(%v) err = %s", c.filter, err)
+		}
+		got := len(xr)
+		if got != c.want {
+			t.Errorf("cpd.CohortReport(%v) count = %d, want %d", c.filter, got, c.want)
+		}
+	}
+
+	// member 1 has a current triennium, so should not have a shortfall error
+	xr, err := cpd.CohortReport(ds, cpd.CohortFilter{})
+	if err != nil {
+		t.Fatalf("cpd.CohortReport() err = %s", err)
+	}
+	if xr[0].Error != "" || xr[0].CreditRequired != 250 {
+		t.Errorf("cpd.CohortReport() row = %+v, want 250 required and no error", xr[0])
+	}
+
+	f, err := cpd.CohortExcelReport(xr)
+	if err != nil {
+		t.Fatalf("cpd.CohortExcelReport() err = %s", err)
+	}
+	rows := f.GetRows(f.GetSheetName(f.GetActiveSheetIndex())) // heading and 1 record
+	if len(rows) != 2 {
+		t.Errorf("GetRows() row count = %d, want 2", len(rows))
+	}
+}
+
+func testImportDryRun(t *testing.T) {
+
+	data := `date,activityId,typeId,quantity,description
+2018-02-03,23,25,1,BJJ like Bruno Malfacine
+2018-03-01,23,25,2,Cardiology conference
+2018-03-01,23,25,2,Cardiology conference
+2018-03-02,23,1,1,Wrong type
+2018/03/03,20,1,1,Bad date`
+
+	xr, err := cpd.ParseCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("cpd.ParseCSV() err = %s", err)
+	}
+	xr = cpd.Import(ds, xr, 1, cpd.MemberEditor(1), true)
+
+	want := []string{
+		cpd.ImportStatusDuplicate, // existing activity id 1
+		cpd.ImportStatusValid,
+		cpd.ImportStatusDuplicate, // duplicate of row 3
+		cpd.ImportStatusInvalid,
+		cpd.ImportStatusInvalid,
+	}
+	for i, r := range xr {
+		if r.Status != want[i] {
+			t.Errorf("cpd.Import() row %d status = %q, want %q (errors: %v)", r.Row, r.Status, want[i], r.Errors)
+		}
+	}
+
+	// dry run should not have added anything
+	xc, err := cpd.ByMemberID(ds, 1)
+	if err != nil {
+		t.Fatalf("cpd.ByMemberID() err = %s", err)
+	}
+	if len(xc) != 3 {
+		t.Errorf("cpd.ByMemberID() count = %d, want 3", len(xc))
+	}
+}
+
 func testAddCPD(t *testing.T) {
 	c := cpd.Input{
 		MemberID:    1,
@@ -191,7 +340,7 @@ func testDuplicateOf(t *testing.T) {
 func testDelete(t *testing.T) {
 
 	// get a count before deleting
-	xc, err := cpd.Query(ds, "")
+	xc, err := cpd.Query(ds, nil)
 	if err != nil {
 		t.Fatalf("cpd.Query() err = %s", err)
 	}
@@ -206,7 +355,7 @@ func testDelete(t *testing.T) {
 	}
 
 	// get the count after deleting
-	xc, err = cpd.Query(ds, "")
+	xc, err = cpd.Query(ds, nil)
 	if err != nil {
 		t.Fatalf("cpd.Query() err = %s", err)
 	}
@@ -218,3 +367,269 @@ func testDelete(t *testing.T) {
 		t.Errorf("cpd.Query() count = %d, want %d", got, want)
 	}
 }
+
+// testHistory checks the soft delete from testDelete was recorded in the change history
+func testHistory(t *testing.T) {
+
+	xc, err := cpd.History(ds, 3)
+	if err != nil {
+		t.Fatalf("cpd.History() err = %s", err)
+	}
+	if len(xc) == 0 {
+		t.Fatalf("cpd.History() count = 0, want > 0")
+	}
+
+	c := xc[len(xc)-1]
+	if c.Action != "delete" {
+		t.Errorf("Change.Action = %q, want %q", c.Action, "delete")
+	}
+	if c.MemberID != 1 || c.UserType != cpd.EditorMember {
+		t.Errorf("Change member = %d (%s), want 1 (%s)", c.MemberID, c.UserType, cpd.EditorMember)
+	}
+	want := cpd.FieldChange{Field: "active", Before: "1", After: "0"}
+	if len(c.Fields) != 1 || c.Fields[0] != want {
+		t.Errorf("Change.Fields = %v, want [%v]", c.Fields, want)
+	}
+}
+
+// testUpdateNotFound checks the record deleted in testDelete, and a record owned by another member, cannot be
+// edited, and that no history is recorded
+func testUpdateNotFound(t *testing.T) {
+
+	xc, err := cpd.History(ds, 3)
+	if err != nil {
+		t.Fatalf("cpd.History() err = %s", err)
+	}
+
+	cases := []struct {
+		name     string
+		memberID int
+		id       int
+	}{
+		{"deleted", 1, 3},
+		{"other member", 2, 2},
+	}
+	for _, c := range cases {
+		in := cpd.Input{
+			ID:          c.id,
+			MemberID:    c.memberID,
+			ActivityID:  24,
+			TypeID:      25,
+			Date:        "2018-05-07",
+			Quantity:    1,
+			Description: "Should not be saved",
+		}
+		err := cpd.Update(ds, in)
+		if errors.Cause(err) != cpd.ErrActivityNotFound {
+			t.Errorf("%s: cpd.Update() err = %v, want %s", c.name, err, cpd.ErrActivityNotFound)
+		}
+	}
+
+	xc2, err := cpd.History(ds, 3)
+	if err != nil {
+		t.Fatalf("cpd.History() err = %s", err)
+	}
+	if len(xc2) != len(xc) {
+		t.Errorf("History() count = %d after failed update, want %d", len(xc2), len(xc))
+	}
+}
+
+// testRestore restores the record deleted in testDelete
+func testRestore(t *testing.T) {
+
+	err := cpd.Restore(ds, 3, cpd.AdminEditor(1))
+	if err != nil {
+		t.Fatalf("cpd.Restore() err = %s", err)
+	}
+
+	_, err = cpd.ByID(ds, 3)
+	if err != nil {
+		t.Errorf("cpd.ByID() err = %s", err)
+	}
+
+	xc, err := cpd.History(ds, 3)
+	if err != nil {
+		t.Fatalf("cpd.History() err = %s", err)
+	}
+	c := xc[len(xc)-1]
+	if c.Action != "update" || c.UserType != cpd.EditorAdmin {
+		t.Errorf("Change = %s by %s, want update by %s", c.Action, c.UserType, cpd.EditorAdmin)
+	}
+
+	// the record is now active, and there is no record 9999, so neither can be restored
+	for _, id := range []int{3, 9999} {
+		err = cpd.Restore(ds, id, cpd.AdminEditor(1))
+		if errors.Cause(err) != cpd.ErrActivityNotFound {
+			t.Errorf("cpd.Restore(%d) err = %v, want %s", id, err, cpd.ErrActivityNotFound)
+		}
+	}
+	xc2, err := cpd.History(ds, 3)
+	if err != nil {
+		t.Fatalf("cpd.History() err = %s", err)
+	}
+	if len(xc2) != len(xc) {
+		t.Errorf("History() count = %d after failed restore, want %d", len(xc2), len(xc))
+	}
+}
+
+func testRolloverPeriods(t *testing.T) {
+
+	// member 1 has an open triennium ending 2020-12-31
+	xr, err := cpd.RolloverPeriods(ds, "2021-01-01")
+	if err != nil {
+		t.Fatalf("cpd.RolloverPeriods() err = %s", err)
+	}
+	if len(xr) != 1 {
+		t.Fatalf("cpd.RolloverPeriods() count = %d, want 1", len(xr))
+	}
+	r := xr[0]
+	if r.Error != nil {
+		t.Fatalf("cpd.RolloverPeriods() result err = %s", r.Error)
+	}
+	if r.StartDate != "2021-01-01" || r.EndDate != "2023-12-31" {
+		t.Errorf("cpd.RolloverPeriods() period = %s - %s, want 2021-01-01 - 2023-12-31", r.StartDate, r.EndDate)
+	}
+
+	cr, err := cpd.CurrentEvaluationPeriodReport(ds, 1)
+	if err != nil {
+		t.Fatalf("cpd.CurrentEvaluationPeriodReport() err = %s", err)
+	}
+	if cr.ID != r.NewID || cr.CreditRequired != 250 {
+		t.Errorf("cpd.CurrentEvaluationPeriodReport() id = %d, required = %d, want %d, 250", cr.ID, cr.CreditRequired, r.NewID)
+	}
+
+	// nothing left to roll over
+	xr, err = cpd.RolloverPeriods(ds, "2021-01-01")
+	if err != nil {
+		t.Fatalf("cpd.RolloverPeriods() err = %s", err)
+	}
+	if len(xr) != 0 {
+		t.Errorf("cpd.RolloverPeriods() second run count = %d, want 0", len(xr))
+	}
+}
+
+// testRecurringCatchUp records two missed occurrences of a weekly recurring activity, skips the third, and checks
+// Next has moved past them
+func testRecurringCatchUp(t *testing.T) {
+
+	now := time.Now()
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -20)
+	a := cpd.RecurringActivity{
+		ID:          bson.NewObjectId(),
+		ActivityID:  24,
+		TypeID:      25,
+		Quantity:    1,
+		Description: "Weekly journal club",
+		Rule:        "FREQ=WEEKLY",
+		Start:       next,
+		Next:        next,
+	}
+	r, err := cpd.MemberRecurring(ds, 1)
+	if err != nil {
+		t.Fatalf("cpd.MemberRecurring() err = %s", err)
+	}
+	r.Activities = append(r.Activities, a)
+	err = r.Save(ds)
+	if err != nil {
+		t.Fatalf("Recurring.Save() err = %s", err)
+	}
+
+	xo, err := r.Missed(ds, a.ID.Hex(), now)
+	if err != nil {
+		t.Fatalf("Recurring.Missed() err = %s", err)
+	}
+	if len(xo) != 3 {
+		t.Fatalf("Recurring.Missed() count = %d, want 3", len(xo))
+	}
+
+	xr, err := r.CatchUp(ds, a.ID.Hex(), []string{xo[0].Date, xo[1].Date}, []string{xo[2].Date}, now)
+	if err != nil {
+		t.Fatalf("Recurring.CatchUp() err = %s", err)
+	}
+	if len(xr) != 3 {
+		t.Fatalf("Recurring.CatchUp() count = %d, want 3", len(xr))
+	}
+	for _, res := range xr[:2] {
+		if res.Error != nil || res.ID == 0 {
+			t.Errorf("Recurring.CatchUp() result = %s, want recorded", res)
+			continue
+		}
+		c, err := cpd.ByID(ds, res.ID)
+		if err != nil {
+			t.Fatalf("cpd.ByID(%d) err = %s", res.ID, err)
+		}
+		if c.Date != res.Date || c.Description != a.Description {
+			t.Errorf("cpd.ByID(%d) = %s %q, want %s %q", res.ID, c.Date, c.Description, res.Date, a.Description)
+		}
+	}
+	if !xr[2].Skipped {
+		t.Errorf("Recurring.CatchUp() result = %s, want skipped", xr[2])
+	}
+
+	// fetch the saved doc to check Next was moved past the skipped occurrence
+	r, err = cpd.MemberRecurring(ds, 1)
+	if err != nil {
+		t.Fatalf("cpd.MemberRecurring() err = %s", err)
+	}
+	got, err := r.GetActivity(a.ID.Hex())
+	if err != nil {
+		t.Fatalf("Recurring.GetActivity() err = %s", err)
+	}
+	if want := next.AddDate(0, 0, 21); !got.Next.Equal(want) {
+		t.Errorf("RecurringActivity.Next = %s, want %s", got.Next, want)
+	}
+	xo, err = r.Missed(ds, a.ID.Hex(), now)
+	if err != nil {
+		t.Fatalf("Recurring.Missed() err = %s", err)
+	}
+	if len(xo) != 0 {
+		t.Errorf("Recurring.Missed() count = %d after catch up, want 0", len(xo))
+	}
+}
+
+// testRecurringAutoRecordNoType checks a recurring activity saved without a type id, for an activity with more than
+// one type, has auto-record switched off rather than failing on every run
+func testRecurringAutoRecordNoType(t *testing.T) {
+
+	now := time.Now()
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+	a := cpd.RecurringActivity{
+		ID:          bson.NewObjectId(),
+		ActivityID:  24,
+		Quantity:    1,
+		Description: "Legacy daily reading",
+		Type:        "daily",
+		Next:        next,
+		AutoRecord:  true,
+	}
+
+	r, err := cpd.MemberRecurring(ds, 1)
+	if err != nil {
+		t.Fatalf("cpd.MemberRecurring() err = %s", err)
+	}
+	r.Activities = append(r.Activities, a)
+	err = r.Save(ds)
+	if err != nil {
+		t.Fatalf("Recurring.Save() err = %s", err)
+	}
+
+	xr := r.AutoRecord(ds, now)
+	if len(xr) != 1 || xr[0].Error == nil {
+		t.Fatalf("AutoRecord() = %v, want one error", xr)
+	}
+
+	r, err = cpd.MemberRecurring(ds, 1)
+	if err != nil {
+		t.Fatalf("cpd.MemberRecurring() err = %s", err)
+	}
+	got, err := r.GetActivity(a.ID.Hex())
+	if err != nil {
+		t.Fatalf("Recurring.GetActivity() err = %s", err)
+	}
+	if got.AutoRecord {
+		t.Errorf("RecurringActivity.AutoRecord = true, want false for an activity without a type")
+	}
+	if xr := r.AutoRecord(ds, now); len(xr) != 0 {
+		t.Errorf("AutoRecord() second run results = %v, want none", xr)
+	}
+}
@@ -0,0 +1,151 @@
+package cpd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// RolloverResult is the outcome of closing one member evaluation period and opening the next
+type RolloverResult struct {
+	MemberID  int    `json:"memberId"`
+	ClosedID  int    `json:"closedId"`
+	NewID     int    `json:"newId"`
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+	Error     error  `json:"-"`
+}
+
+// String describes the result in the same way as other bulk admin operations
+func (r RolloverResult) String() string {
+	if r.Error != nil {
+		return fmt.Sprintf("Error rolling over evaluation id %d for member id %d - %s", r.ClosedID, r.MemberID, r.Error)
+	}
+	if r.NewID == 0 {
+		return fmt.Sprintf("Closed evaluation id %d for member id %d, successor period starting %s already exists",
+			r.ClosedID, r.MemberID, r.StartDate)
+	}
+	return fmt.Sprintf("Closed evaluation id %d for member id %d, opened evaluation id %d (%s - %s)",
+		r.ClosedID, r.MemberID, r.NewID, r.StartDate, r.EndDate)
+}
+
+// evaluationPeriod is an open member evaluation period due to be closed
+type evaluationPeriod struct {
+	id           int
+	memberID     int
+	evaluationID int
+	endDate      string
+}
+
+// RolloverPeriods closes all open member evaluation periods that end before the date specified (YYYY-MM-DD)
+// and creates a successor period for each member, using the duration and credit required by the
+// ce_evaluation template. The successor starts the day after the closed period ends. Each member is
+// processed in a single transaction, and a successor period is not created if one already exists.
+func RolloverPeriods(ds datastore.Datastore, before string) ([]RolloverResult, error) {
+
+	var xr []RolloverResult
+
+	_, err := time.Parse("2006-01-02", before)
+	if err != nil {
+		return xr, errors.Wrap(err, "invalid date")
+	}
+
+	xp, err := openPeriodsEndingBefore(ds, before)
+	if err != nil {
+		return xr, err
+	}
+
+	for _, p := range xp {
+		xr = append(xr, rolloverPeriod(ds, p))
+	}
+
+	return xr, nil
+}
+
+func openPeriodsEndingBefore(ds datastore.Datastore, before string) ([]evaluationPeriod, error) {
+
+	var xp []evaluationPeriod
+
+	rows, err := ds.MySQL.Session.Query(Queries["select-open-evaluations-ending-before"], before)
+	if err != nil {
+		return xp, errors.Wrap(err, "select-open-evaluations-ending-before query error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := evaluationPeriod{}
+		err := rows.Scan(&p.id, &p.memberID, &p.evaluationID, &p.endDate)
+		if err != nil {
+			return xp, errors.Wrap(err, "scan error")
+		}
+		xp = append(xp, p)
+	}
+
+	return xp, rows.Err()
+}
+
+// rolloverPeriod closes a single evaluation period and opens the successor
+func rolloverPeriod(ds datastore.Datastore, p evaluationPeriod) RolloverResult {
+
+	r := RolloverResult{MemberID: p.memberID, ClosedID: p.id}
+
+	var months, points int
+	err := ds.MySQL.Session.QueryRow(Queries["select-evaluation-template"], p.evaluationID).Scan(&months, &points)
+	if err != nil {
+		r.Error = errors.Wrap(err, "could not fetch evaluation template")
+		return r
+	}
+
+	end, err := time.Parse("2006-01-02", p.endDate)
+	if err != nil {
+		r.Error = errors.Wrap(err, "invalid end date")
+		return r
+	}
+	start := end.AddDate(0, 0, 1)
+	r.StartDate = start.Format("2006-01-02")
+	r.EndDate = start.AddDate(0, months, -1).Format("2006-01-02")
+
+	tx, err := ds.MySQL.Session.Begin()
+	if err != nil {
+		r.Error = err
+		return r
+	}
+
+	_, err = tx.Exec(Queries["update-close-member-evaluation"], p.id)
+	if err != nil {
+		tx.Rollback()
+		r.Error = errors.Wrap(err, "update-close-member-evaluation query error")
+		return r
+	}
+
+	var count int
+	err = tx.QueryRow(Queries["select-member-evaluation-starting-on"], p.memberID, r.StartDate).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		r.Error = errors.Wrap(err, "select-member-evaluation-starting-on query error")
+		return r
+	}
+
+	if count == 0 {
+		comment := fmt.Sprintf("Created by rollover of evaluation id %d", p.id)
+		res, err := tx.Exec(Queries["insert-member-evaluation"], p.memberID, p.evaluationID, points, r.StartDate, r.EndDate, comment)
+		if err != nil {
+			tx.Rollback()
+			r.Error = errors.Wrap(err, "insert-member-evaluation query error")
+			return r
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			r.Error = err
+			return r
+		}
+		r.NewID = int(id)
+	}
+
+	r.Error = tx.Commit()
+	return r
+}
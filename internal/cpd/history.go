@@ -0,0 +1,267 @@
+package cpd
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// Editor types
+const (
+	EditorMember = "member"
+	EditorAdmin  = "admin"
+)
+
+// Change history actions, as per log_data_action.action
+const (
+	actionInsert = "insert"
+	actionUpdate = "update"
+	actionDelete = "delete"
+)
+
+// ErrActivityNotFound is returned when the member activity record to change does not exist, or is not in the
+// required state, eg restoring a record that is not deleted
+var ErrActivityNotFound = errors.New("activity not found")
+
+// historyTable is the log_data_table.table_name for member activity changes
+const historyTable = "ce_m_activity"
+
+// historyFields are the ce_m_activity columns tracked in the change history
+var historyFields = []string{
+	"ce_activity_id",
+	"ce_activity_type_id",
+	"evidence",
+	"activity_on",
+	"quantity",
+	"points_per_unit",
+	"description",
+	"active",
+}
+
+// Editor identifies the user (member or admin) that made a change to a member activity record
+type Editor struct {
+	ID   int
+	Type string
+}
+
+// MemberEditor returns an Editor for a member
+func MemberEditor(id int) Editor {
+	return Editor{ID: id, Type: EditorMember}
+}
+
+// AdminEditor returns an Editor for an admin user
+func AdminEditor(id int) Editor {
+	return Editor{ID: id, Type: EditorAdmin}
+}
+
+// Change is an entry in the change history of a member activity record
+type Change struct {
+	ID         int           `json:"id"`
+	ActivityID int           `json:"activityId"`
+	MemberID   int           `json:"memberId"`
+	UserID     int           `json:"userId"`
+	UserType   string        `json:"userType"`
+	Action     string        `json:"action"`
+	Message    string        `json:"message"`
+	CreatedAt  string        `json:"createdAt"`
+	Fields     []FieldChange `json:"fields"`
+}
+
+// FieldChange is the old and new value of a single field
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// History fetches the change history for a member activity record, oldest first
+func History(ds datastore.Datastore, activityID int) ([]Change, error) {
+
+	var xc []Change
+
+	rows, err := ds.MySQL.Session.Query(Queries["select-activity-history"], historyTable, activityID)
+	if err != nil {
+		return xc, errors.Wrap(err, "select-activity-history query error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := Change{}
+		err := rows.Scan(&c.ID, &c.ActivityID, &c.MemberID, &c.UserID, &c.UserType, &c.Action, &c.Message, &c.CreatedAt)
+		if err != nil {
+			return xc, errors.Wrap(err, "scan error")
+		}
+		xc = append(xc, c)
+	}
+	if err := rows.Err(); err != nil {
+		return xc, err
+	}
+
+	for i := range xc {
+		xc[i].Fields, err = historyFieldChanges(ds, xc[i].ID)
+		if err != nil {
+			return xc, err
+		}
+	}
+
+	return xc, nil
+}
+
+func historyFieldChanges(ds datastore.Datastore, actionID int) ([]FieldChange, error) {
+
+	var xf []FieldChange
+
+	rows, err := ds.MySQL.Session.Query(Queries["select-activity-history-fields"], actionID)
+	if err != nil {
+		return xf, errors.Wrap(err, "select-activity-history-fields query error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f := FieldChange{}
+		err := rows.Scan(&f.Field, &f.Before, &f.After)
+		if err != nil {
+			return xf, errors.Wrap(err, "scan error")
+		}
+		xf = append(xf, f)
+	}
+
+	return xf, rows.Err()
+}
+
+// Restore un-deletes a member activity record, recording the change history against the editor. It returns
+// ErrActivityNotFound if there is no deleted record with the id.
+func Restore(ds datastore.Datastore, activityID int, e Editor) error {
+	query := `UPDATE ce_m_activity SET active = 1, updated_at = NOW() WHERE id = ? AND active = 0 LIMIT 1`
+	return changeWithHistory(ds, e, activityID, actionUpdate, map[string]string{"active": "0"}, query, activityID)
+}
+
+// changeWithHistory runs the update query for the activity record, and logs the change, in a single
+// transaction. The record is locked and must have the field values in want, eg the owner's member_id and an
+// active flag of 1, before the change, or ErrActivityNotFound is returned and nothing is changed.
+func changeWithHistory(ds datastore.Datastore, e Editor, activityID int, action string, want map[string]string, query string, args ...interface{}) error {
+
+	tx, err := ds.MySQL.Session.Begin()
+	if err != nil {
+		return err
+	}
+
+	before, err := snapshot(tx, activityID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for f, v := range want {
+		if before[f] != v {
+			tx.Rollback()
+			return errors.Wrapf(ErrActivityNotFound, "activity id %d", activityID)
+		}
+	}
+
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	after, err := snapshot(tx, activityID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = logChange(tx, e, activityID, action, before, after)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// snapshot returns the tracked fields of a member activity record, including the member id
+func snapshot(tx *sql.Tx, activityID int) (map[string]string, error) {
+
+	values := make([]string, len(historyFields)+1)
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	err := tx.QueryRow(Queries["select-activity-snapshot"], activityID).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return nil, errors.Wrapf(ErrActivityNotFound, "activity id %d", activityID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "select-activity-snapshot query error")
+	}
+
+	m := map[string]string{"member_id": values[0]}
+	for i, f := range historyFields {
+		m[f] = values[i+1]
+	}
+	return m, nil
+}
+
+// logChange writes the log_data_action record, and a log_data_field record for each field that changed
+func logChange(tx *sql.Tx, e Editor, activityID int, action string, before, after map[string]string) error {
+
+	tableID, err := historyTableID(tx)
+	if err != nil {
+		return err
+	}
+
+	var changed []FieldChange
+	for _, f := range historyFields {
+		if before[f] != after[f] {
+			changed = append(changed, FieldChange{Field: f, Before: before[f], After: after[f]})
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%s %s activity id %d", e.Type, action, activityID)
+	if action == actionUpdate && before["active"] == "0" && after["active"] == "1" {
+		msg = fmt.Sprintf("%s restored activity id %d", e.Type, activityID)
+	}
+
+	res, err := tx.Exec(Queries["insert-activity-history"], tableID, activityID, e.ID, after["member_id"], e.Type, action, msg)
+	if err != nil {
+		return errors.Wrap(err, "insert-activity-history query error")
+	}
+	actionID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changed {
+		_, err := tx.Exec(Queries["insert-activity-history-field"], actionID, c.Field, c.Before, c.After)
+		if err != nil {
+			return errors.Wrap(err, "insert-activity-history-field query error")
+		}
+	}
+
+	return nil
+}
+
+// historyTableID returns the log_data_table id for ce_m_activity, adding it if required
+func historyTableID(tx *sql.Tx) (int, error) {
+	var id int
+	err := tx.QueryRow(Queries["select-log-data-table-id"], historyTable).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, errors.Wrap(err, "select-log-data-table-id query error")
+	}
+	res, err := tx.Exec(Queries["insert-log-data-table"], historyTable)
+	if err != nil {
+		return 0, errors.Wrap(err, "insert-log-data-table query error")
+	}
+	n, err := res.LastInsertId()
+	return int(n), err
+}
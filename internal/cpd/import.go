@@ -0,0 +1,237 @@
+package cpd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"gopkg.in/go-playground/validator.v9"
+
+	"github.com/cardiacsociety/web-services/internal/activity"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// Import row status values
+const (
+	ImportStatusInvalid   = "invalid"
+	ImportStatusDuplicate = "duplicate"
+	ImportStatusValid     = "valid" // passed validation in a dry run
+	ImportStatusAdded     = "added"
+	ImportStatusFailed    = "failed"
+)
+
+// importColumns are the recognised column headings in an import file. Headings are not case sensitive and
+// columns can be in any order. The memberId column is only used by admin imports.
+var importColumns = []string{"memberid", "date", "activityid", "typeid", "quantity", "description", "evidence"}
+
+// ImportRow is a single row from an import file, and the outcome of importing it. Row is the line number
+// in the file, with the heading as row 1.
+type ImportRow struct {
+	Row         int      `json:"row"`
+	Input       Input    `json:"input"`
+	Status      string   `json:"status"`
+	ID          int      `json:"id,omitempty"`
+	DuplicateOf int      `json:"duplicateOf,omitempty"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// ParseCSV reads member activity rows from a CSV file with a heading row
+func ParseCSV(r io.Reader) ([]ImportRow, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("ParseCSV() err = %s", err)
+	}
+	return parseRecords(records)
+}
+
+// ParseXLSX reads member activity rows from the first sheet of an excel file with a heading row
+func ParseXLSX(r io.Reader) ([]ImportRow, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("ParseXLSX() err = %s", err)
+	}
+	return parseRecords(f.GetRows(f.GetSheetName(1)))
+}
+
+func parseRecords(records [][]string) ([]ImportRow, error) {
+
+	var xr []ImportRow
+
+	if len(records) == 0 {
+		return xr, fmt.Errorf("import file is empty")
+	}
+
+	// map column heading -> index
+	cols := map[string]int{}
+	for i, h := range records[0] {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, c := range importColumns[1:] {
+		if _, ok := cols[c]; !ok {
+			return xr, fmt.Errorf("import file is missing column %q", c)
+		}
+	}
+
+	for i, rec := range records[1:] {
+		if blankRecord(rec) {
+			continue
+		}
+		xr = append(xr, parseRecord(i+2, rec, cols))
+	}
+
+	return xr, nil
+}
+
+func parseRecord(row int, rec []string, cols map[string]int) ImportRow {
+
+	ir := ImportRow{Row: row}
+
+	value := func(col string) string {
+		i, ok := cols[col]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+	toInt := func(col string) int {
+		v := value(col)
+		if v == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			ir.Errors = append(ir.Errors, fmt.Sprintf("%s %q is not a whole number", col, v))
+		}
+		return n
+	}
+
+	ir.Input.MemberID = toInt("memberid")
+	ir.Input.ActivityID = toInt("activityid")
+	ir.Input.TypeID = toInt("typeid")
+	ir.Input.Date = value("date")
+	ir.Input.Description = value("description")
+
+	if v := value("quantity"); v != "" {
+		q, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			ir.Errors = append(ir.Errors, fmt.Sprintf("quantity %q is not a number", v))
+		}
+		ir.Input.Quantity = q
+	}
+
+	switch strings.ToLower(value("evidence")) {
+	case "1", "true", "yes", "y":
+		ir.Input.Evidence = true
+	}
+
+	return ir
+}
+
+func blankRecord(rec []string) bool {
+	for _, v := range rec {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Import validates and adds the rows. If memberID is > 0 all rows are recorded for that member, otherwise
+// each row must specify a member id. Rows are validated against the activity types, and checked for
+// duplicates both in the database and earlier in the same file. If dryRun is true nothing is written and
+// valid rows are marked ImportStatusValid. Added rows are recorded in the change history against the editor.
+func Import(ds datastore.Datastore, rows []ImportRow, memberID int, e Editor, dryRun bool) []ImportRow {
+
+	types := map[int]map[int]bool{} // activity id -> type ids, cached
+	seen := map[string]int{}        // duplicate key -> row number
+
+	for i := range rows {
+		r := &rows[i]
+		if memberID > 0 {
+			r.Input.MemberID = memberID
+		}
+		r.validate(ds, types)
+		if len(r.Errors) > 0 {
+			r.Status = ImportStatusInvalid
+			continue
+		}
+
+		key := fmt.Sprintf("%d|%d|%d|%s|%s", r.Input.MemberID, r.Input.ActivityID, r.Input.TypeID, r.Input.Date, r.Input.Description)
+		if n, ok := seen[key]; ok {
+			r.Status = ImportStatusDuplicate
+			r.Errors = append(r.Errors, fmt.Sprintf("duplicate of row %d", n))
+			continue
+		}
+		seen[key] = r.Row
+
+		dupID, err := DuplicateOf(ds, r.Input)
+		if err != nil {
+			r.Status = ImportStatusFailed
+			r.Errors = append(r.Errors, err.Error())
+			continue
+		}
+		if dupID > 0 {
+			r.Status = ImportStatusDuplicate
+			r.DuplicateOf = dupID
+			r.Errors = append(r.Errors, fmt.Sprintf("duplicate of existing activity id %d", dupID))
+			continue
+		}
+
+		if dryRun {
+			r.Status = ImportStatusValid
+			continue
+		}
+
+		id, err := AddAs(ds, r.Input, e)
+		if err != nil {
+			r.Status = ImportStatusFailed
+			r.Errors = append(r.Errors, err.Error())
+			continue
+		}
+		r.ID = id
+		r.Status = ImportStatusAdded
+	}
+
+	return rows
+}
+
+// validate checks the row input, adding any problems to .Errors
+func (r *ImportRow) validate(ds datastore.Datastore, types map[int]map[int]bool) {
+
+	if r.Input.MemberID == 0 {
+		r.Errors = append(r.Errors, "member id is required")
+	}
+
+	err := validator.New().Struct(r.Input)
+	if verrs, ok := err.(validator.ValidationErrors); ok {
+		for _, e := range verrs {
+			r.Errors = append(r.Errors, fmt.Sprintf("%s failed validation (%s)", e.Field(), e.Tag()))
+		}
+	}
+
+	if _, err := time.Parse("2006-01-02", r.Input.Date); r.Input.Date != "" && err != nil {
+		r.Errors = append(r.Errors, fmt.Sprintf("date %q should be YYYY-MM-DD", r.Input.Date))
+	}
+
+	if r.Input.ActivityID == 0 || r.Input.TypeID == 0 {
+		return
+	}
+	if _, ok := types[r.Input.ActivityID]; !ok {
+		types[r.Input.ActivityID] = map[int]bool{}
+		xt, err := activity.Types(ds, r.Input.ActivityID)
+		if err != nil {
+			r.Errors = append(r.Errors, err.Error())
+			return
+		}
+		for _, t := range xt {
+			types[r.Input.ActivityID][t.ID] = true
+		}
+	}
+	if !types[r.Input.ActivityID][r.Input.TypeID] {
+		r.Errors = append(r.Errors, fmt.Sprintf("type id %d is not valid for activity id %d", r.Input.TypeID, r.Input.ActivityID))
+	}
+}
@@ -0,0 +1,31 @@
+package cpd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cardiacsociety/web-services/internal/cpd"
+	"github.com/matryer/is"
+)
+
+func TestParseCSV(t *testing.T) {
+	is := is.New(t)
+
+	data := `Date,ActivityID,TypeID,Quantity,Description,Evidence
+2018-03-01,23,25,2,Cardiology conference,yes
+
+2018-03-02,23,25,two,Journal club,
+`
+	xr, err := cpd.ParseCSV(strings.NewReader(data))
+	is.NoErr(err)                                                      // parse csv
+	is.Equal(len(xr), 2)                                               // blank rows are skipped
+	is.Equal(xr[0].Row, 2)                                             // row number
+	is.Equal(xr[0].Input.Quantity, 2.0)                                // quantity
+	is.True(xr[0].Input.Evidence)                                      // evidence
+	is.Equal(len(xr[0].Errors), 0)                                     // no errors
+	is.Equal(xr[1].Row, 3)                                             // blank lines are ignored by the csv reader
+	is.Equal(xr[1].Errors, []string{`quantity "two" is not a number`}) // bad quantity
+
+	_, err = cpd.ParseCSV(strings.NewReader("date,activityId\n2018-03-01,23\n"))
+	is.True(err != nil) // missing columns
+}
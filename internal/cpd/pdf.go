@@ -32,6 +32,7 @@ func PDFReport(reportData MemberActivityReport, w io.Writer) error {
 	addPageHeaderImage(pdf)
 	addContextSection(pdf, reportData)
 	addSummarySection(pdf, reportData)
+	addRulesSection(pdf, reportData)
 	addDetailSection(pdf, reportData)
 
 	return pdf.Output(w)
@@ -61,6 +62,15 @@ func addSummarySection(pdf *gofpdf.Fpdf, reportData MemberActivityReport) {
 	addSummary(pdf, reportData)
 }
 
+// addRulesSection lists the evaluation rules that were applied to the report, if any
+func addRulesSection(pdf *gofpdf.Fpdf, reportData MemberActivityReport) {
+	if len(reportData.Rules) == 0 {
+		return
+	}
+	addSectionHeading(pdf, "Rules")
+	addRules(pdf, reportData)
+}
+
 func addDetailSection(pdf *gofpdf.Fpdf, reportData MemberActivityReport) {
 	addSectionHeading(pdf, "Detail")
 	addDetail(pdf, reportData)
@@ -94,6 +104,13 @@ func addSummary(pdf *gofpdf.Fpdf, r MemberActivityReport) {
 		pdf.Ln(height7)
 		total += a.CreditAwarded
 	}
+	if r.CreditCarriedOver > 0 {
+		pdf.SetFont("Arial", "I", text12)
+		pdf.Cell(width140, height7, "Carried over from previous period")
+		pdf.CellFormat(width30, height7, floatToString(r.CreditCarriedOver), "", 0, "R", false, 0, "")
+		pdf.Ln(height7)
+		total += r.CreditCarriedOver
+	}
 	addRowDividerLine(pdf, 0)
 	pdf.SetFont("Arial", "B", text12)
 	pdf.CellFormat(width140, height7, "Total:", "", 0, "R", false, 0, "")
@@ -103,6 +120,26 @@ func addSummary(pdf *gofpdf.Fpdf, r MemberActivityReport) {
 	pdf.Ln(height7)
 }
 
+func addRules(pdf *gofpdf.Fpdf, r MemberActivityReport) {
+	pdf.SetFont("Arial", "", text10)
+	for _, rr := range r.Rules {
+		status := "-"
+		switch {
+		case !rr.Met:
+			status = "Not met"
+		case rr.Applied:
+			status = "-" + floatToString(rr.Reduction)
+		}
+		nextCellY := pdf.GetY()
+		pdf.MultiCell(width140, height4, rr.Explanation, "0", "L", false)
+		nextRowY := pdf.GetY()
+		pdf.SetXY(pdf.GetX()+width140, nextCellY)
+		pdf.CellFormat(width30, height4, status, "0", 0, "R", false, 0, "")
+		pdf.SetY(nextRowY)
+		addRowDividerLine(pdf, 0)
+	}
+}
+
 func addDetail(pdf *gofpdf.Fpdf, r MemberActivityReport) {
 
 	colWidths := []float64{22, 0, 16, 16, 16}
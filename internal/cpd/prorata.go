@@ -0,0 +1,177 @@
+package cpd
+
+import (
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// pauseStatusesEnv is the env var that holds a comma-separated list of membership status names that pause
+// the accrual of a credit requirement, eg "Leave of Absence,Parental Leave"
+const pauseStatusesEnv = "MAPPCPD_CPD_PAUSE_STATUSES"
+
+// defaultPauseStatuses is used when pauseStatusesEnv is not set
+var defaultPauseStatuses = []string{"Leave of Absence"}
+
+// StatusChange is a change of membership status on a date (YYYY-MM-DD)
+type StatusChange struct {
+	Date string
+	Name string
+}
+
+// MembershipPeriod holds the data needed to pro-rate a credit requirement for a member. It is the same data
+// as member.Member.DateOfEntry and the membership status history, however the member package imports cpd so
+// it is fetched here directly.
+type MembershipPeriod struct {
+	DateOfEntry   string
+	StatusHistory []StatusChange // oldest first
+}
+
+// PauseStatuses returns the membership status names that pause a credit requirement
+func PauseStatuses() []string {
+	v := os.Getenv(pauseStatusesEnv)
+	if v == "" {
+		return defaultPauseStatuses
+	}
+	var xs []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			xs = append(xs, s)
+		}
+	}
+	return xs
+}
+
+// ProRata returns the fraction (0 - 1) of the evaluation period from start to end (inclusive) during which
+// the member was required to obtain credit. Days before the date of entry, and days when the member held one
+// of the pause statuses, are excluded.
+func (mp MembershipPeriod) ProRata(start, end string, pauses []string) float64 {
+
+	s, err1 := time.Parse("2006-01-02", start)
+	e, err2 := time.Parse("2006-01-02", end)
+	if err1 != nil || err2 != nil || e.Before(s) {
+		return 1
+	}
+	e = e.AddDate(0, 0, 1) // exclusive end
+	totalDays := e.Sub(s).Hours() / 24
+
+	from := s
+	if doe, err := time.Parse("2006-01-02", mp.DateOfEntry); err == nil && doe.After(from) {
+		from = doe
+	}
+	if !from.Before(e) {
+		return 0
+	}
+
+	// Walk the status history, subtracting the days spent in a pause status within [from, e)
+	var pausedDays float64
+	for i, sc := range mp.StatusHistory {
+		if !isPauseStatus(sc.Name, pauses) {
+			continue
+		}
+		ps, err := time.Parse("2006-01-02", sc.Date)
+		if err != nil {
+			continue
+		}
+		pe := e
+		if i+1 < len(mp.StatusHistory) {
+			if next, err := time.Parse("2006-01-02", mp.StatusHistory[i+1].Date); err == nil {
+				pe = next
+			}
+		}
+		if ps.Before(from) {
+			ps = from
+		}
+		if pe.After(e) {
+			pe = e
+		}
+		if pe.After(ps) {
+			pausedDays += pe.Sub(ps).Hours() / 24
+		}
+	}
+
+	activeDays := e.Sub(from).Hours()/24 - pausedDays
+	if activeDays < 0 {
+		activeDays = 0
+	}
+	return activeDays / totalDays
+}
+
+func isPauseStatus(name string, pauses []string) bool {
+	for _, p := range pauses {
+		if strings.EqualFold(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// proRate adjusts .CreditRequired for the portion of the period the member was required to obtain credit,
+// keeping the original value in .CreditRequiredFull
+func (e *MemberActivityReport) proRate(mp MembershipPeriod, pauses []string) {
+	e.CreditRequiredFull = e.CreditRequired
+	e.ProRata = mp.ProRata(e.StartDate, e.EndDate, pauses)
+	e.CreditRequired = int(math.Round(float64(e.CreditRequiredFull) * e.ProRata))
+}
+
+// memberPeriods fetches the date of entry and status history of each of the members, by member id
+func memberPeriods(ds datastore.Datastore, memberIDs []int) (map[int]MembershipPeriod, error) {
+
+	mps := map[int]MembershipPeriod{}
+
+	clause, args, err := datastore.NewFilter().In("id", memberIDs).Where()
+	if err != nil {
+		return mps, err
+	}
+	rows, err := ds.MySQL.Session.Query(Queries["select-members-date-of-entry"]+clause, args...)
+	if err != nil {
+		return mps, errors.Wrap(err, "select-members-date-of-entry query error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var mp MembershipPeriod
+		err := rows.Scan(&id, &mp.DateOfEntry)
+		if err != nil {
+			return mps, errors.Wrap(err, "scan error")
+		}
+		mps[id] = mp
+	}
+	if err := rows.Err(); err != nil {
+		return mps, err
+	}
+
+	clause, args, err = datastore.NewFilter().In("mms.member_id", memberIDs).
+		OrderBy("mms.created_at", false).OrderBy("mms.id", false).Where()
+	if err != nil {
+		return mps, err
+	}
+	rows, err = ds.MySQL.Session.Query(Queries["select-members-status-history"]+clause, args...)
+	if err != nil {
+		return mps, errors.Wrap(err, "select-members-status-history query error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		sc := StatusChange{}
+		err := rows.Scan(&id, &sc.Date, &sc.Name)
+		if err != nil {
+			return mps, errors.Wrap(err, "scan error")
+		}
+		mp, ok := mps[id]
+		if !ok {
+			continue // no member record
+		}
+		mp.StatusHistory = append(mp.StatusHistory, sc)
+		mps[id] = mp
+	}
+
+	return mps, rows.Err()
+}
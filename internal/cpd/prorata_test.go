@@ -0,0 +1,46 @@
+package cpd_test
+
+import (
+	"testing"
+
+	"github.com/cardiacsociety/web-services/internal/cpd"
+	"github.com/matryer/is"
+)
+
+func TestProRata(t *testing.T) {
+	is := is.New(t)
+
+	pauses := []string{"Leave of Absence"}
+	start, end := "2018-01-01", "2020-12-31" // 1096 days
+
+	cases := []struct {
+		mp   cpd.MembershipPeriod
+		want float64
+	}{
+		// joined before the period
+		{cpd.MembershipPeriod{DateOfEntry: "2000-01-01"}, 1},
+		// joined half way through - 548 days remaining
+		{cpd.MembershipPeriod{DateOfEntry: "2019-07-03"}, 0.5},
+		// joined after the period
+		{cpd.MembershipPeriod{DateOfEntry: "2021-03-01"}, 0},
+		// 365 days of leave in 2019, case-insensitive status name
+		{cpd.MembershipPeriod{
+			DateOfEntry: "2000-01-01",
+			StatusHistory: []cpd.StatusChange{
+				{Date: "2000-01-01", Name: "Active"},
+				{Date: "2019-01-01", Name: "leave of absence"},
+				{Date: "2020-01-01", Name: "Active"},
+			},
+		}, 731.0 / 1096},
+		// leave that started before the period and is ongoing
+		{cpd.MembershipPeriod{
+			StatusHistory: []cpd.StatusChange{
+				{Date: "2017-06-01", Name: "Leave of Absence"},
+			},
+		}, 0},
+	}
+
+	for _, c := range cases {
+		is.Equal(c.mp.ProRata(start, end, pauses), c.want) // pro-rata fraction
+	}
+}
@@ -1,8 +1,23 @@
 package cpd
 
 var Queries = map[string]string{
-	"select-member-activity":            selectMemberActivity,
-	"select-cpd-summary-by-activity-id": selectCPDSummaryByActivityID,
+	"select-member-activity":                selectMemberActivity,
+	"select-open-evaluations-ending-before": selectOpenEvaluationsEndingBefore,
+	"select-evaluation-template":            selectEvaluationTemplate,
+	"select-member-evaluation-starting-on":  selectMemberEvaluationStartingOn,
+	"update-close-member-evaluation":        updateCloseMemberEvaluation,
+	"insert-member-evaluation":              insertMemberEvaluation,
+	"select-member-evaluations":             selectMemberEvaluations,
+	"select-members-date-of-entry":          selectMembersDateOfEntry,
+	"select-members-status-history":         selectMembersStatusHistory,
+	"select-cohort-members":                 selectCohortMembers,
+	"select-activity-snapshot":              selectActivitySnapshot,
+	"select-log-data-table-id":              selectLogDataTableID,
+	"insert-log-data-table":                 insertLogDataTable,
+	"insert-activity-history":               insertActivityHistory,
+	"insert-activity-history-field":         insertActivityHistoryField,
+	"select-activity-history":               selectActivityHistory,
+	"select-activity-history-fields":        selectActivityHistoryFields,
 }
 
 const selectMemberActivity = `SELECT
@@ -25,7 +40,7 @@ const selectMemberActivity = `SELECT
   IFNULL(cat.id, 0)                    AS 'typeId',
   COALESCE(cat.name, '')               AS 'typeName'
 FROM
-  ce_m_activity cma
+  (SELECT * FROM ce_m_activity WHERE active = 1) cma
   LEFT JOIN
   ce_activity ca ON cma.ce_activity_id = ca.id
   LEFT JOIN
@@ -35,16 +50,126 @@ FROM
   LEFT JOIN
   ce_activity_type cat ON cma.ce_activity_type_id = cat.id`
 
-const selectCPDSummaryByActivityID = `SELECT
-  SUM(cma.quantity)                       AS TotalUnits,
-  cma.points_per_unit                     AS UnitCredit,
-  SUM(cma.quantity * cma.points_per_unit) AS CreditObtained
+const selectOpenEvaluationsEndingBefore = `SELECT
+  cme.id, cme.member_id, cme.ce_evaluation_id, cme.end_on
 FROM
-  ce_m_activity cma
+  ce_m_evaluation cme
 WHERE
-  cma.active = 1
-  AND cma.activity_on >= ?
-  AND cma.activity_on <= ?
-  AND cma.member_id = ?
-  AND cma.ce_activity_id = ?
-GROUP BY cma.ce_activity_id`
+  cme.active = 1
+  AND cme.closed = 0
+  AND cme.end_on < ?
+ORDER BY cme.member_id, cme.end_on`
+
+const selectEvaluationTemplate = `SELECT
+  COALESCE(duration_months, 12) AS durationMonths,
+  points_required               AS pointsRequired
+FROM
+  ce_evaluation
+WHERE
+  id = ?`
+
+const selectMemberEvaluationStartingOn = `SELECT
+  COUNT(*)
+FROM
+  ce_m_evaluation
+WHERE
+  active = 1
+  AND member_id = ?
+  AND start_on = ?`
+
+const updateCloseMemberEvaluation = `UPDATE ce_m_evaluation SET closed = 1, updated_at = NOW() WHERE id = ?`
+
+const insertMemberEvaluation = `INSERT INTO ce_m_evaluation
+  (member_id, ce_evaluation_id, active, closed, created_at, updated_at, cpd_points_required, start_on, end_on, comment)
+VALUES
+  (?, ?, 1, 0, NOW(), NOW(), ?, ?, ?, ?)`
+
+// member evaluation periods, the WHERE clause is added by the caller
+const selectMemberEvaluations = `SELECT
+  cme.id,
+  cme.member_id,
+  ce.name,
+  cme.cpd_points_required,
+  cme.start_on,
+  cme.end_on,
+  cme.closed
+FROM
+  ce_m_evaluation cme
+  LEFT JOIN
+  ce_evaluation ce ON cme.ce_evaluation_id = ce.id`
+
+// the WHERE clause is added by the caller
+const selectMembersDateOfEntry = `SELECT id, COALESCE(date_of_entry, '') FROM member`
+
+// the WHERE clause is added by the caller
+const selectMembersStatusHistory = `SELECT
+  mms.member_id                           AS memberId,
+  DATE_FORMAT(mms.created_at, '%Y-%m-%d') AS statusDate,
+  COALESCE(ms.name, '')                   AS statusName
+FROM
+  ms_m_status mms
+  INNER JOIN
+  ms_status ms ON mms.ms_status_id = ms.id`
+
+// members in a current status that is subject to CPD, eg active or reinstated
+const selectCohortMembers = `SELECT
+  m.id                                   AS memberId,
+  CONCAT(m.first_name, ' ', m.last_name) AS member,
+  COALESCE(mt.name, '')                  AS title
+FROM
+  member m
+  INNER JOIN
+  ms_m_status mms ON mms.member_id = m.id AND mms.current = 1 AND mms.active = 1
+  INNER JOIN
+  ms_status ms ON mms.ms_status_id = ms.id AND ms.active = 1 AND ms.cpd = 1
+  LEFT JOIN
+  ms_m_title mmt ON mmt.member_id = m.id AND mmt.current = 1
+  LEFT JOIN
+  ms_title mt ON mmt.ms_title_id = mt.id
+WHERE
+  m.active = 1`
+
+const selectActivitySnapshot = `SELECT
+  member_id,
+  ce_activity_id,
+  COALESCE(ce_activity_type_id, ''),
+  COALESCE(evidence, ''),
+  COALESCE(activity_on, ''),
+  quantity,
+  points_per_unit,
+  COALESCE(description, ''),
+  active
+FROM ce_m_activity
+WHERE id = ?
+FOR UPDATE`
+
+const selectLogDataTableID = `SELECT id FROM log_data_table WHERE table_name = ? AND active = 1 LIMIT 1`
+
+const insertLogDataTable = `INSERT INTO log_data_table (active, created_at, updated_at, table_name) VALUES (1, NOW(), NOW(), ?)`
+
+const insertActivityHistory = `INSERT INTO log_data_action
+  (log_data_table_id, record_id, user_id, member_id, active, created_at, updated_at, user_type, action, message)
+  VALUES (?, ?, ?, ?, 1, NOW(), NOW(), ?, ?, ?)`
+
+const insertActivityHistoryField = `INSERT INTO log_data_field
+  (log_data_action_id, active, created_at, updated_at, field_name, value_before, value_after)
+  VALUES (?, 1, NOW(), NOW(), ?, ?, ?)`
+
+const selectActivityHistory = `SELECT
+  lda.id,
+  lda.record_id,
+  COALESCE(lda.member_id, 0),
+  lda.user_id,
+  lda.user_type,
+  lda.action,
+  lda.message,
+  lda.created_at
+FROM log_data_action lda
+  LEFT JOIN log_data_table ldt ON lda.log_data_table_id = ldt.id
+WHERE ldt.table_name = ? AND lda.record_id = ? AND lda.active = 1
+ORDER BY lda.created_at, lda.id`
+
+const selectActivityHistoryFields = `SELECT field_name, value_before, value_after
+FROM log_data_field
+WHERE log_data_action_id = ? AND active = 1
+ORDER BY id`
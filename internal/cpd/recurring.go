@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"time"
 
+	"gopkg.in/go-playground/validator.v9"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/cardiacsociety/web-services/internal/activity"
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
 )
 
@@ -30,8 +32,80 @@ type RecurringActivity struct {
 	UpdatedAt   time.Time     `json:"updatedAt" bson:"updatedAt"`
 	Quantity    float64       `json:"quantity" validate:"required"`
 	Description string        `json:"description" validate:"required"`
-	Type        string        `json:"type" validate:"required"`
+	Type        string        `json:"type"` // daily, weekly or monthly - superseded by Rule
 	Next        time.Time     `json:"next"`
+	TypeID      int           `json:"typeId" bson:"typeId" validate:"required,min=1"`
+	AutoRecord  bool          `json:"autoRecord" bson:"autoRecord"` // recorded by the scheduler when due
+	Rule        string        `json:"rule" bson:"rule"`             // RRULE, eg FREQ=WEEKLY;INTERVAL=2;BYDAY=TU
+	Start       time.Time     `json:"start" bson:"start"`           // first occurrence, defaults to Next
+	Done        bool          `json:"done" bson:"done"`             // no more occurrences
+}
+
+// maxOccurrences limits the number of occurrences returned by RecurringActivity.Due, as protection against a
+// Next value that is a long way in the past
+const maxOccurrences = 400
+
+// OccurrenceResult is the outcome of recording, or skipping, one occurrence of a recurring activity
+type OccurrenceResult struct {
+	MemberID    int           `json:"memberId"`
+	RecurringID bson.ObjectId `json:"recurringId"`
+	Date        string        `json:"date"`
+	ID          int           `json:"id"`
+	DuplicateOf int           `json:"duplicateOf"`
+	Skipped     bool          `json:"skipped"`
+	Error       error         `json:"-"`
+}
+
+// Occurrence is a due occurrence of a recurring activity. DuplicateOf is the id of an existing member activity
+// record that matches the occurrence, if any.
+type Occurrence struct {
+	Date        string `json:"date"`
+	DuplicateOf int    `json:"duplicateOf"`
+}
+
+// OccurrenceError is returned by Missed and CatchUp when the request is not valid for the recurring activity, eg a
+// date that is not a missed occurrence, as opposed to a database error
+type OccurrenceError struct {
+	Message string `json:"message"`
+}
+
+func (e OccurrenceError) Error() string {
+	return e.Message
+}
+
+// String describes the result in the same way as other bulk admin operations
+func (r OccurrenceResult) String() string {
+	if r.Error != nil {
+		return fmt.Sprintf("Error recording recurring activity %s for member id %d on %s - %s",
+			r.RecurringID.Hex(), r.MemberID, r.Date, r.Error)
+	}
+	if r.Skipped {
+		return fmt.Sprintf("Skipped recurring activity %s for member id %d on %s", r.RecurringID.Hex(), r.MemberID, r.Date)
+	}
+	if r.DuplicateOf > 0 {
+		return fmt.Sprintf("Recurring activity %s for member id %d on %s already recorded as activity id %d",
+			r.RecurringID.Hex(), r.MemberID, r.Date, r.DuplicateOf)
+	}
+	return fmt.Sprintf("Recorded recurring activity %s for member id %d on %s as activity id %d",
+		r.RecurringID.Hex(), r.MemberID, r.Date, r.ID)
+}
+
+// AutoRecurring fetches the Recurring docs that have at least one activity in auto-record mode
+func AutoRecurring(ds datastore.Datastore) ([]Recurring, error) {
+
+	var xr []Recurring
+
+	c, err := ds.MongoDB.RecurringCol()
+	if err != nil {
+		return xr, errors.New("AutoRecurring() could not get a pointer to collection -" + err.Error())
+	}
+
+	err = c.Find(bson.M{"activities.autoRecord": true}).All(&xr)
+	if err != nil {
+		return xr, errors.New("AutoRecurring() database error -" + err.Error())
+	}
+
+	return xr, nil
 }
 
 // MemberRecurring initialises a value of type Recurring and returns a pointer to same.
@@ -87,7 +161,7 @@ func (r *Recurring) RemoveActivity(ds datastore.Datastore, oid string) error {
 
 	// The activities are stored in a doc, as sub docs in an activity array.
 	// Removing one of them can be achieved with some fancy Mongo using $pull - like this:
-	// db.Recurring.update({"activities.oid": ObjectId("59091436a9fb6e78d8945157")}, {$pull: {"activities": {"oid": ObjectId("59091436a9fb6e78d8945157")}}})
+	// db.Recurring.update({"activities._id": ObjectId("59091436a9fb6e78d8945157")}, {$pull: {"activities": {"_id": ObjectId("59091436a9fb6e78d8945157")}}})
 
 	// get a pointer to the collection...
 	c, err := ds.MongoDB.RecurringCol()
@@ -97,8 +171,8 @@ func (r *Recurring) RemoveActivity(ds datastore.Datastore, oid string) error {
 	}
 
 	// Selector and updater
-	s := bson.M{"activities.oid": bson.ObjectIdHex(oid)}
-	u := bson.M{"$pull": bson.M{"activities": bson.M{"oid": bson.ObjectIdHex(oid)}}}
+	s := bson.M{"activities._id": bson.ObjectIdHex(oid)}
+	u := bson.M{"$pull": bson.M{"activities": bson.M{"_id": bson.ObjectIdHex(oid)}}}
 	err = c.Update(s, u)
 	if err != nil {
 		fmt.Println("Recurring.RemoveActivity() update error -", err)
@@ -123,6 +197,10 @@ func (r *Recurring) RemoveActivity(ds datastore.Datastore, oid string) error {
 // GetActivity returns just the RecurringActivity identified by _id
 func (r *Recurring) GetActivity(oid string) (RecurringActivity, error) {
 
+	if !bson.IsObjectIdHex(oid) {
+		return RecurringActivity{}, errors.New("Invalid activity id " + oid)
+	}
+
 	for _, v := range r.Activities {
 		if v.ID == bson.ObjectIdHex(oid) {
 			return v, nil
@@ -140,15 +218,25 @@ func (r *Recurring) Record(ds datastore.Datastore, oid string) error {
 		return err
 	}
 
+	if a.Done {
+		return errors.New(".CPD() recurring activity has no more occurrences")
+	}
+
 	// Make idempotent by not allowing to skip if date is in the future
 	if a.Next.After(time.Now()) {
 		return errors.New(".CPD() cannot record a recurring activity if .Next is in the future")
 	}
 
+	err = a.setTypeID(ds)
+	if err != nil {
+		return err
+	}
+
 	ar := Input{}
 	ar.MemberID = r.MemberID
 	ar.ActivityID = a.ActivityID
 	ar.Date = a.Next.Format("2006-01-02")
+	ar.TypeID = a.TypeID
 	ar.Quantity = a.Quantity
 	ar.Description = a.Description
 
@@ -161,11 +249,242 @@ func (r *Recurring) Record(ds datastore.Datastore, oid string) error {
 
 	// Increment next
 	a.UpdateNext()
-	r.UpdateActivity(ds, a)
+	return r.UpdateActivity(ds, a)
+}
+
+// AutoRecord records every due occurrence, up to and including now, of the recurring activities that are in
+// auto-record mode, and saves the advanced Next values. An occurrence that already has a matching member activity
+// record is not added again, so it is safe to re-run.
+func (r *Recurring) AutoRecord(ds datastore.Datastore, now time.Time) []OccurrenceResult {
+
+	var xr []OccurrenceResult
+
+	for _, a := range r.Activities {
+		if !a.AutoRecord {
+			continue
+		}
+
+		due, err := a.Due(now)
+		if err != nil {
+			xr = append(xr, OccurrenceResult{MemberID: r.MemberID, RecurringID: a.ID, Error: err})
+			continue
+		}
+		if len(due) == 0 {
+			continue
+		}
+
+		// an activity without a type cannot be recorded, so auto-record is switched off rather than failing on
+		// every run, and the member can record it manually once the type is set
+		err = a.setTypeID(ds)
+		if _, ok := err.(OccurrenceError); ok {
+			a.AutoRecord = false
+			a.UpdatedAt = time.Now()
+			if uerr := r.UpdateActivity(ds, a); uerr != nil {
+				err = uerr
+			} else {
+				err = fmt.Errorf("%s, auto-record has been switched off", err)
+			}
+		}
+		if err != nil {
+			xr = append(xr, OccurrenceResult{MemberID: r.MemberID, RecurringID: a.ID, Error: err})
+			continue
+		}
+
+		for _, d := range due {
+			res := r.record(ds, a, d)
+			xr = append(xr, res)
+			if res.Error != nil {
+				break
+			}
+			a.Next = d
+			a.UpdateNext()
+		}
+		if err := r.UpdateActivity(ds, a); err != nil {
+			xr = append(xr, OccurrenceResult{MemberID: r.MemberID, RecurringID: a.ID, Error: err})
+		}
+	}
+
+	return xr
+}
+
+// Missed returns the occurrences of the recurring activity from Next up to and including now, with any existing
+// member activity record that matches each one. It returns an OccurrenceError if the occurrences cannot be
+// worked out, eg the rule is not valid.
+func (r *Recurring) Missed(ds datastore.Datastore, oid string, now time.Time) ([]Occurrence, error) {
+
+	var xo []Occurrence
+
+	a, err := r.GetActivity(oid)
+	if err != nil {
+		return xo, err
+	}
+
+	due, err := a.Due(now)
+	if err != nil {
+		return xo, OccurrenceError{err.Error()}
+	}
+
+	for _, d := range due {
+		o := Occurrence{Date: d.Format("2006-01-02")}
+		o.DuplicateOf, err = DuplicateOf(ds, a.input(r.MemberID, d))
+		if err != nil {
+			return xo, err
+		}
+		xo = append(xo, o)
+	}
+
+	return xo, nil
+}
+
+// CatchUp records and skips missed occurrences (YYYY-MM-DD) of the recurring activity in one operation. Each date
+// must be a due occurrence, as per Missed. Occurrences that already have a matching member activity record are
+// not added again. Next is moved past the latest occurrence that is recorded or skipped, so any earlier
+// occurrences that are not listed are also skipped. It returns an OccurrenceError, before anything is written, if
+// the request is not valid.
+func (r *Recurring) CatchUp(ds datastore.Datastore, oid string, record, skip []string, now time.Time) ([]OccurrenceResult, error) {
+
+	var xr []OccurrenceResult
+
+	a, err := r.GetActivity(oid)
+	if err != nil {
+		return xr, err
+	}
+
+	due, err := a.Due(now)
+	if err != nil {
+		return xr, OccurrenceError{err.Error()}
+	}
+
+	actions := map[string]string{}
+	for _, d := range record {
+		actions[d] = "record"
+	}
+	for _, d := range skip {
+		if actions[d] == "record" {
+			return xr, OccurrenceError{fmt.Sprintf("occurrence %s cannot be both recorded and skipped", d)}
+		}
+		actions[d] = "skip"
+	}
+	dueDates := map[string]bool{}
+	for _, d := range due {
+		dueDates[d.Format("2006-01-02")] = true
+	}
+	for d := range actions {
+		if !dueDates[d] {
+			return xr, OccurrenceError{fmt.Sprintf("%s is not a missed occurrence of recurring activity %s", d, oid)}
+		}
+	}
 
+	if len(record) > 0 {
+		err = a.setTypeID(ds)
+		if err != nil {
+			return xr, err
+		}
+	}
+
+	var last time.Time
+	for _, d := range due {
+		switch actions[d.Format("2006-01-02")] {
+		case "record":
+			res := r.record(ds, a, d)
+			xr = append(xr, res)
+			if res.Error != nil {
+				// stop here so the failed occurrence remains due
+				return xr, r.advance(ds, a, last)
+			}
+		case "skip":
+			xr = append(xr, OccurrenceResult{MemberID: r.MemberID, RecurringID: a.ID, Date: d.Format("2006-01-02"), Skipped: true})
+		default:
+			continue
+		}
+		last = d
+	}
+
+	return xr, r.advance(ds, a, last)
+}
+
+// advance moves Next past the occurrence on d, and saves, unless d is zero
+func (r *Recurring) advance(ds datastore.Datastore, a RecurringActivity, d time.Time) error {
+	if d.IsZero() {
+		return nil
+	}
+	a.Next = d
+	a.UpdateNext()
+	a.UpdatedAt = time.Now()
+	return r.UpdateActivity(ds, a)
+}
+
+// input returns the member activity record for the occurrence of the recurring activity on d
+func (a RecurringActivity) input(memberID int, d time.Time) Input {
+	ar := Input{}
+	ar.MemberID = memberID
+	ar.ActivityID = a.ActivityID
+	ar.TypeID = a.TypeID
+	ar.Date = d.Format("2006-01-02")
+	ar.Quantity = a.Quantity
+	ar.Description = a.Description
+	return ar
+}
+
+// setTypeID sets the activity type of a recurring activity saved before the type was required, when the activity
+// has only one type. It returns an OccurrenceError if the type cannot be worked out.
+func (a *RecurringActivity) setTypeID(ds datastore.Datastore) error {
+	if a.TypeID > 0 {
+		return nil
+	}
+	xt, err := activity.Types(ds, a.ActivityID)
+	if err != nil {
+		return err
+	}
+	if len(xt) != 1 {
+		return OccurrenceError{fmt.Sprintf("recurring activity %s does not have a type id, and activity %d has %d types",
+			a.ID.Hex(), a.ActivityID, len(xt))}
+	}
+	a.TypeID = xt[0].ID
 	return nil
 }
 
+// record adds a member activity for one occurrence of the recurring activity, unless it already exists
+func (r *Recurring) record(ds datastore.Datastore, a RecurringActivity, d time.Time) OccurrenceResult {
+
+	res := OccurrenceResult{MemberID: r.MemberID, RecurringID: a.ID, Date: d.Format("2006-01-02")}
+	ar := a.input(r.MemberID, d)
+
+	res.DuplicateOf, res.Error = DuplicateOf(ds, ar)
+	if res.Error != nil || res.DuplicateOf > 0 {
+		return res
+	}
+
+	res.ID, res.Error = Add(ds, ar)
+	return res
+}
+
+// Due returns the dates of all occurrences from Next up to and including now, oldest first
+func (a RecurringActivity) Due(now time.Time) ([]time.Time, error) {
+
+	var xt []time.Time
+
+	if a.Done {
+		return xt, nil
+	}
+	if a.Next.IsZero() {
+		return xt, fmt.Errorf("recurring activity %s does not have a next date", a.ID.Hex())
+	}
+	if _, err := a.RecurrenceRule(); err != nil {
+		return xt, fmt.Errorf("recurring activity %s - %s", a.ID.Hex(), err)
+	}
+
+	for !a.Done && !a.Next.After(now) {
+		if len(xt) == maxOccurrences {
+			return nil, fmt.Errorf("recurring activity %s has more than %d occurrences due", a.ID.Hex(), maxOccurrences)
+		}
+		xt = append(xt, a.Next)
+		a.UpdateNext()
+	}
+
+	return xt, nil
+}
+
 // Skip just sets the Next scheduled time for the recurring activity, and saves to db
 func (r *Recurring) Skip(ds datastore.Datastore, oid string) error {
 
@@ -174,6 +493,10 @@ func (r *Recurring) Skip(ds datastore.Datastore, oid string) error {
 		return err
 	}
 
+	if a.Done {
+		return errors.New(".Skip() recurring activity has no more occurrences")
+	}
+
 	// Make idempotent by not allowing to skip if date is in the future
 	if a.Next.After(time.Now()) {
 		return errors.New(".Skip() cannot skip a recurring activity if .Next is in the future")
@@ -181,13 +504,13 @@ func (r *Recurring) Skip(ds datastore.Datastore, oid string) error {
 
 	// Increment next
 	a.UpdateNext()
-	r.UpdateActivity(ds, a)
-
-	return nil
+	return r.UpdateActivity(ds, a)
 }
 
-// UpdateActivity updates one RecurringActivity in the Recurring.All slice and saves it to the database
-func (r *Recurring) UpdateActivity(ds datastore.Datastore, a RecurringActivity) {
+// UpdateActivity updates one RecurringActivity in the Recurring.All slice and saves it to the database. Only the
+// matching sub doc is written, with $set on activities.$, so changes made elsewhere to the member's other recurring
+// activities are not overwritten by this copy of the doc.
+func (r *Recurring) UpdateActivity(ds datastore.Datastore, a RecurringActivity) error {
 
 	// Replace the activity with a matching id
 	var newMap []RecurringActivity
@@ -199,18 +522,84 @@ func (r *Recurring) UpdateActivity(ds datastore.Datastore, a RecurringActivity)
 	}
 	r.Activities = newMap
 
-	r.Save(ds)
+	c, err := ds.MongoDB.RecurringCol()
+	if err != nil {
+		fmt.Println("Recurring.UpdateActivity() could not get a pointer to collection -", err)
+		return err
+	}
+
+	r.UpdatedAt = time.Now()
+	s := bson.M{"memberId": r.MemberID, "activities._id": a.ID}
+	u := bson.M{"$set": bson.M{"activities.$": a, "updatedAt": r.UpdatedAt}}
+	err = c.Update(s, u)
+	if err != nil {
+		fmt.Println("Recurring.UpdateActivity() update error -", err)
+		return err
+	}
+
+	return nil
 }
 
-// UpdateNext pushed RecurringActivity.Next schedule forward
+// UpdateNext pushed RecurringActivity.Next schedule forward to the next occurrence of the recurrence rule. If
+// there are no more occurrences .Done is set. An invalid rule leaves Next unchanged.
 func (a *RecurringActivity) UpdateNext() {
 
-	switch a.Type {
-	case "daily":
-		a.Next = a.Next.AddDate(0, 0, 1)
-	case "weekly":
-		a.Next = a.Next.AddDate(0, 0, 7)
-	case "monthly":
-		a.Next = a.Next.AddDate(0, 1, 0)
+	rule, err := a.RecurrenceRule()
+	if err != nil {
+		return
+	}
+
+	start := a.Start
+	if start.IsZero() {
+		start = a.Next
 	}
+
+	next, ok := rule.Next(start, a.Next)
+	if !ok {
+		a.Done = true
+		return
+	}
+	a.Next = next
+}
+
+// RecurrenceRule returns the parsed .Rule, or the equivalent rule for the original .Type values
+func (a RecurringActivity) RecurrenceRule() (RecurrenceRule, error) {
+	if a.Rule != "" {
+		return ParseRule(a.Rule)
+	}
+	if rule, ok := legacyRules[a.Type]; ok {
+		return ParseRule(rule)
+	}
+	return RecurrenceRule{}, fmt.Errorf("recurring activity requires a rule, or a type of daily, weekly or monthly")
+}
+
+// Validate checks a new recurring activity, including that the rule is valid and the first occurrence (Next)
+// is part of the series
+func (a RecurringActivity) Validate() error {
+
+	err := validator.New().Struct(a)
+	if err != nil {
+		return err
+	}
+
+	rule, err := a.RecurrenceRule()
+	if err != nil {
+		return err
+	}
+
+	if a.Next.IsZero() {
+		return fmt.Errorf("next is required")
+	}
+	start := a.Start
+	if start.IsZero() {
+		start = a.Next
+	}
+	if a.Next.Before(start) {
+		return fmt.Errorf("next cannot be before start")
+	}
+	if first, ok := rule.Next(start, a.Next.Add(-time.Nanosecond)); !ok || !first.Equal(a.Next) {
+		return fmt.Errorf("next %s is not an occurrence of the rule %s", a.Next.Format("2006-01-02"), a.Rule)
+	}
+
+	return nil
 }
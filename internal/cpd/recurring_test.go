@@ -0,0 +1,74 @@
+package cpd_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/cardiacsociety/web-services/internal/cpd"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+func TestRecurringActivityDue(t *testing.T) {
+
+	now := time.Date(2018, 3, 1, 9, 0, 0, 0, time.UTC)
+	next := time.Date(2018, 2, 1, 9, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		typ   string
+		next  time.Time
+		count int
+		err   bool
+	}{
+		{"weekly", "weekly", next, 5, false},
+		{"monthly", "monthly", next, 2, false},
+		{"daily", "daily", next, 29, false},
+		{"not due", "weekly", now.AddDate(0, 0, 1), 0, false},
+		{"due now", "weekly", now, 1, false},
+		{"unknown type", "fortnightly", next, 0, true},
+		{"no next date", "weekly", time.Time{}, 0, true},
+		{"too many", "daily", now.AddDate(-5, 0, 0), 0, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			is := is.New(t)
+			a := cpd.RecurringActivity{ID: bson.NewObjectId(), Type: c.typ, Next: c.next}
+			xt, err := a.Due(now)
+			is.Equal(err != nil, c.err) // error
+			is.Equal(len(xt), c.count)  // occurrences
+			if len(xt) > 0 {
+				is.Equal(xt[0], c.next) // first occurrence is Next
+			}
+		})
+	}
+}
+
+// TestRecurringCatchUpInvalid checks requests are rejected before any data is written
+func TestRecurringCatchUpInvalid(t *testing.T) {
+
+	next := time.Now().AddDate(0, 0, -15)
+	a := cpd.RecurringActivity{ID: bson.NewObjectId(), Type: "weekly", Next: next}
+	r := cpd.Recurring{MemberID: 1, Activities: []cpd.RecurringActivity{a}}
+	first := next.Format("2006-01-02")
+
+	cases := []struct {
+		name   string
+		record []string
+		skip   []string
+	}{
+		{"not an occurrence", []string{next.AddDate(0, 0, 1).Format("2006-01-02")}, nil},
+		{"not yet due", []string{next.AddDate(0, 0, 21).Format("2006-01-02")}, nil},
+		{"record and skip", []string{first}, []string{first}},
+	}
+
+	for _, c := range cases {
+		_, err := r.CatchUp(datastore.Datastore{}, a.ID.Hex(), c.record, c.skip, time.Now())
+		if _, ok := err.(cpd.OccurrenceError); !ok {
+			t.Errorf("%s: CatchUp() err = %v, want an OccurrenceError", c.name, err)
+		}
+	}
+}
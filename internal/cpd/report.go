@@ -1,7 +1,7 @@
 package cpd
 
 import (
-	"fmt"
+	"time"
 
 	"github.com/cardiacsociety/web-services/internal/activity"
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
@@ -9,16 +9,24 @@ import (
 
 // MemberActivityReport represents an instance of a defined evaluation/compliance period that belongs to a Member.
 // The member's activity over the defined period is summed, and caps applied where necessary.
+// CreditObtained includes CreditCarriedOver, which is surplus credit brought forward from the previous period.
+// CreditRequired is pro-rated for members who joined, or were on leave, during the period - the unadjusted
+// requirement is CreditRequiredFull.
 type MemberActivityReport struct {
-	ID             int              `json:"id" bson:"id"`
-	MemberID       int              `json:"memberId" bson:"memberId"`
-	ReportName     string           `json:"reportName" bson:"reportName"`
-	StartDate      string           `json:"startDate" bson:"startDate"`
-	EndDate        string           `json:"endDate" bson:"endDate"`
-	Closed         bool             `json:"closed"`
-	CreditRequired int              `json:"creditRequired" bson:"creditRequired"`
-	CreditObtained float64          `json:"creditObtained" bson:"creditObtained"`
-	Activities     []activityReport `json:"activities" bson:"activities"`
+	ID                 int              `json:"id" bson:"id"`
+	MemberID           int              `json:"memberId" bson:"memberId"`
+	ReportName         string           `json:"reportName" bson:"reportName"`
+	StartDate          string           `json:"startDate" bson:"startDate"`
+	EndDate            string           `json:"endDate" bson:"endDate"`
+	Closed             bool             `json:"closed"`
+	CreditRequired     int              `json:"creditRequired" bson:"creditRequired"`
+	CreditRequiredFull int              `json:"creditRequiredFull" bson:"creditRequiredFull"`
+	ProRata            float64          `json:"proRata" bson:"proRata"`
+	CreditObtained     float64          `json:"creditObtained" bson:"creditObtained"`
+	CreditCarriedOver  float64          `json:"creditCarriedOver" bson:"creditCarriedOver"`
+	Activities         []activityReport `json:"activities" bson:"activities"`
+	Rules              []RuleResult     `json:"rules" bson:"rules"`
+	Compliance         Compliance       `json:"compliance" bson:"compliance"`
 }
 
 // activityReport represents a summary of a specific activity type
@@ -26,6 +34,7 @@ type MemberActivityReport struct {
 type activityReport struct {
 	ActivityID    int              `json:"activityId" bson:"activityId"`
 	ActivityName  string           `json:"activityName" bson:"activityName"`
+	CategoryID    int              `json:"categoryId" bson:"categoryId"`
 	ActivityUnits float64          `json:"activityUnits" bson:"activityUnits"`
 	CreditPerUnit float64          `json:"creditPerUnit" bson:"creditPerUnit"`
 	CreditTotal   float64          `json:"creditTotal" bson:"creditTotal"`
@@ -43,20 +52,56 @@ type activityRecord struct {
 	Unit        string
 }
 
-// MemberActivityReports generates evaluation period reports for a member.
+// MemberActivityReports generates evaluation period reports for a member. All of the member's activity is
+// fetched once and aggregated in memory for each evaluation period, so the number of queries does not grow
+// with the number of periods or activities.
 func MemberActivityReports(ds datastore.Datastore, memberID int) ([]MemberActivityReport, error) {
+	reports, err := membersActivityReports(ds, []int{memberID})
+	return reports[memberID], err
+}
+
+// membersActivityReports generates the evaluation period reports for each of the members, by member id. The
+// evaluation periods, activity and membership history of all of the members are each fetched with a single query,
+// so the number of queries does not grow with the number of members either.
+func membersActivityReports(ds datastore.Datastore, memberIDs []int) (map[int][]MemberActivityReport, error) {
 
-	var es []MemberActivityReport
+	reports := map[int][]MemberActivityReport{}
 
-	query := `SELECT cme.id, cme.member_id, ce.name,
-	cme.cpd_points_required, cme.start_on, cme.end_on, cme.closed
-	FROM ce_m_evaluation cme
-	LEFT JOIN ce_evaluation ce ON cme.ce_evaluation_id = ce.id
-	WHERE member_id = ?`
+	// Need empty activities on the report, could not sort with JOIN in a single query as empty activities were omitted
+	xa, err := activity.All(ds)
+	if err != nil {
+		return reports, err
+	}
 
-	rows, err := ds.MySQL.Session.Query(query, memberID)
+	xc, err := membersActivity(ds, memberIDs)
 	if err != nil {
-		return es, err
+		return reports, err
+	}
+
+	rs, err := EvaluationRules()
+	if err != nil {
+		return reports, err
+	}
+
+	mps, err := memberPeriods(ds, memberIDs)
+	if err != nil {
+		return reports, err
+	}
+	pauses := PauseStatuses()
+
+	cp, err := CarryOverPolicyFromEnv()
+	if err != nil {
+		return reports, err
+	}
+
+	clause, args, err := datastore.NewFilter().In("cme.member_id", memberIDs).
+		OrderBy("cme.member_id", false).OrderBy("cme.start_on", false).Where()
+	if err != nil {
+		return reports, err
+	}
+	rows, err := ds.MySQL.Session.Query(Queries["select-member-evaluations"]+clause, args...)
+	if err != nil {
+		return reports, err
 	}
 	defer rows.Close()
 
@@ -71,92 +116,94 @@ func MemberActivityReports(ds datastore.Datastore, memberID int) ([]MemberActivi
 			&e.EndDate,
 			&e.Closed,
 		)
+		e.proRate(mps[e.MemberID], pauses)
+		e.generateActivitySummary(xa, xc[e.MemberID], rs)
+		reports[e.MemberID] = append(reports[e.MemberID], e)
+	}
+	if err := rows.Err(); err != nil {
+		return reports, err
+	}
 
-		err := e.generateActivitySummary(ds)
-		if err != nil {
-			return es, err
+	for _, es := range reports {
+		applyCarryOver(es, cp)
+		for i := range es {
+			es[i].SetCompliance(time.Now())
 		}
-
-		es = append(es, e)
 	}
 
-	return es, nil
+	return reports, nil
 }
 
 // CurrentEvaluationPeriodReport returns a MemberActivityReport for the current evaluation period.
 func CurrentEvaluationPeriodReport(ds datastore.Datastore, memberID int) (MemberActivityReport, error) {
 
-	var me MemberActivityReport
-
 	xme, err := MemberActivityReports(ds, memberID)
 	if err != nil {
-		return me, err
+		return MemberActivityReport{}, err
 	}
 
+	return currentReport(xme), nil
+}
+
+// currentReport returns the report for the current, ie the last open, evaluation period
+func currentReport(xme []MemberActivityReport) MemberActivityReport {
+
+	var me MemberActivityReport
 	for _, v := range xme {
 		if v.Closed == false {
 			me = v
 		}
 	}
 
-	return me, nil
+	return me
 }
 
-func (e *MemberActivityReport) generateActivitySummary(ds datastore.Datastore) error {
-
-	// Need empty activities on the report, could not sort with JOIN in a single query as empty activities were omitted
-	xa, err := activity.All(ds)
-	if err != nil {
-		return err
-	}
+// generateActivitySummary summarises the member activity records (xc) that fall within the evaluation period
+// for each of the activities (xa), and then applies the evaluation rules.
+func (e *MemberActivityReport) generateActivitySummary(xa []activity.Activity, xc []CPD, rs RuleSet) {
 
 	for _, a := range xa {
 		ar := activityReport{
 			ActivityID:   a.ID,
 			ActivityName: a.Name,
+			CategoryID:   a.CategoryID,
 			MaxCredit:    a.MaxCredit,
 		}
-		ar.summary(ds, *e)
-		ar.fetchActivityRecords(ds, e.MemberID, e.StartDate, e.EndDate)
+		for _, c := range xc {
+			if c.Activity.ID != a.ID || c.Date < e.StartDate || c.Date > e.EndDate {
+				continue
+			}
+			ar.ActivityUnits += c.CreditData.Quantity
+			ar.CreditPerUnit = c.CreditData.UnitCredit
+			ar.CreditTotal += c.Credit
+			ar.Records = append(ar.Records, mapMemberActivity(c))
+		}
 		e.Activities = append(e.Activities, ar)
 	}
 
-	e.calcTotalCredit()
-
-	return nil
+	// caps and other rules are applied once all of the activity is known, and this also sets .CreditObtained
+	e.ApplyRules(rs)
 }
 
-// summary fills in the details for one activity in a report
-func (a *activityReport) summary(ds datastore.Datastore, e MemberActivityReport) error {
+// membersActivity fetches all of the active activity records for the members, most recent first, by member id
+func membersActivity(ds datastore.Datastore, memberIDs []int) (map[int][]CPD, error) {
 
-	query := Queries["select-cpd-summary-by-activity-id"]
-	rows := ds.MySQL.Session.QueryRow(query, e.StartDate, e.EndDate, e.MemberID, a.ActivityID)
-	err := rows.Scan(
-		&a.ActivityUnits,
-		&a.CreditPerUnit,
-		&a.CreditTotal,
-	)
+	clause, args, err := datastore.NewFilter().In("cma.member_id", memberIDs).Equal("cma.active", 1).
+		OrderBy("cma.activity_on", true).Where()
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	a.capCreditTotal()
-
-	return nil
-}
-
-func (a *activityReport) fetchActivityRecords(ds datastore.Datastore, memberID int, startDate, endDate string) {
-	clause := `WHERE member_id = %d AND cma.activity_on >= "%s" AND cma.activity_on <= "%s" ORDER BY cma.activity_on DESC`
-	clause = fmt.Sprintf(clause, memberID, startDate, endDate)
-	ma, err := Query(ds, clause)
+	xc, err := cpdQueryArgs(ds, clause, args...)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return nil, err
 	}
-	for _, r := range ma {
-		nr := mapMemberActivity(r)
-		a.Records = append(a.Records, nr)
+
+	m := map[int][]CPD{}
+	for _, c := range xc {
+		m[c.MemberID] = append(m[c.MemberID], c)
 	}
+
+	return m, nil
 }
 
 func (a *activityReport) capCreditTotal() {
@@ -0,0 +1,83 @@
+package cpd_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cardiacsociety/web-services/internal/activity"
+	"github.com/cardiacsociety/web-services/internal/cpd"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// BenchmarkMemberActivityReports compares the report builder with the previous approach of running two
+// queries per activity, per evaluation period. Member 1 is given five evaluation periods.
+func BenchmarkMemberActivityReports(b *testing.B) {
+
+	var teardown func()
+	ds, teardown = setup()
+	defer teardown()
+
+	for _, y := range []int{2014, 2015, 2016, 2017} {
+		_, err := ds.MySQL.Session.Exec(`INSERT INTO ce_m_evaluation
+			(member_id, ce_evaluation_id, active, closed, cpd_points_required, start_on, end_on, comment)
+			VALUES (1, 1, 1, 1, 100, ?, ?, '')`, fmt.Sprintf("%d-01-01", y), fmt.Sprintf("%d-12-31", y))
+		if err != nil {
+			b.Fatalf("insert ce_m_evaluation err = %s", err)
+		}
+	}
+
+	b.Run("aggregated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := cpd.MemberActivityReports(ds, 1)
+			if err != nil {
+				b.Fatalf("cpd.MemberActivityReports() err = %s", err)
+			}
+		}
+	})
+
+	b.Run("query-per-activity", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := queryPerActivityReports(ds, 1)
+			if err != nil {
+				b.Fatalf("queryPerActivityReports() err = %s", err)
+			}
+		}
+	})
+}
+
+// queryPerActivityReports reproduces the query pattern of the original report builder, for comparison
+func queryPerActivityReports(ds datastore.Datastore, memberID int) error {
+
+	rows, err := ds.MySQL.Session.Query(`SELECT start_on, end_on FROM ce_m_evaluation WHERE member_id = ?`, memberID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var start, end string
+		rows.Scan(&start, &end)
+
+		xa, err := activity.All(ds)
+		if err != nil {
+			return err
+		}
+		for _, a := range xa {
+			var units, unitCredit, credit float64
+			ds.MySQL.Session.QueryRow(`SELECT SUM(quantity), points_per_unit, SUM(quantity * points_per_unit)
+				FROM ce_m_activity WHERE active = 1 AND activity_on >= ? AND activity_on <= ?
+				AND member_id = ? AND ce_activity_id = ? GROUP BY ce_activity_id`,
+				start, end, memberID, a.ID).Scan(&units, &unitCredit, &credit)
+
+			f := datastore.NewFilter().Equal("member_id", memberID).Equal("cma.active", 1).
+				Equal("cma.ce_activity_id", a.ID).GreaterEq("cma.activity_on", start).LessEq("cma.activity_on", end).
+				OrderBy("cma.activity_on", true)
+			_, err := cpd.Query(ds, f)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,339 @@
+package cpd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies, as per RFC 5545
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+	FreqYearly  = "YEARLY"
+)
+
+// maxPeriods limits the number of periods (days, weeks, months or years), from the one containing the given time,
+// that are searched for the next occurrence of a rule, in case the rule parts can never be satisfied
+const maxPeriods = 5000
+
+// legacyRules maps the original RecurringActivity.Type values to an equivalent rule
+var legacyRules = map[string]string{
+	"daily":   "FREQ=DAILY",
+	"weekly":  "FREQ=WEEKLY",
+	"monthly": "FREQ=MONTHLY",
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// RecurrenceRule is a subset of an RFC 5545 RRULE, supporting the FREQ, INTERVAL, BYDAY, BYMONTHDAY, UNTIL and
+// COUNT parts, eg "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;UNTIL=20181231" is every second Tuesday until December.
+// Weeks start on Monday.
+type RecurrenceRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []RuleWeekday
+	ByMonthDay []int
+	Until      time.Time // inclusive, zero if not set
+	Count      int       // zero if not set
+}
+
+// RuleWeekday is a BYDAY value. Ordinal is only used with FREQ=MONTHLY, eg 2TU is the second Tuesday of the
+// month, and -1FR is the last Friday. An Ordinal of 0 means every such day.
+type RuleWeekday struct {
+	Ordinal int
+	Day     time.Weekday
+}
+
+// ParseRule parses an RRULE string. The "RRULE:" prefix is optional.
+func ParseRule(s string) (RecurrenceRule, error) {
+
+	r := RecurrenceRule{Interval: 1}
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return r, fmt.Errorf("recurrence rule is empty")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return r, fmt.Errorf("recurrence rule part %q should be NAME=VALUE", part)
+		}
+		name, value := strings.ToUpper(strings.TrimSpace(kv[0])), strings.ToUpper(strings.TrimSpace(kv[1]))
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = value
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err == nil && r.Interval < 1 {
+				err = fmt.Errorf("should be at least 1")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count < 1 {
+				err = fmt.Errorf("should be at least 1")
+			}
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseByMonthDay(value)
+		case "WKST":
+			if value != "MO" {
+				err = fmt.Errorf("only MO is supported")
+			}
+		default:
+			err = fmt.Errorf("not supported")
+		}
+		if err != nil {
+			return r, fmt.Errorf("recurrence rule %s=%s - %s", name, value, err)
+		}
+	}
+
+	return r, r.validate()
+}
+
+func (r RecurrenceRule) validate() error {
+
+	switch r.Freq {
+	case FreqDaily, FreqWeekly, FreqMonthly, FreqYearly:
+	case "":
+		return fmt.Errorf("recurrence rule FREQ is required")
+	default:
+		return fmt.Errorf("recurrence rule FREQ=%s is not supported", r.Freq)
+	}
+
+	if r.Count > 0 && !r.Until.IsZero() {
+		return fmt.Errorf("recurrence rule cannot have both COUNT and UNTIL")
+	}
+	if r.Freq == FreqYearly && (len(r.ByDay) > 0 || len(r.ByMonthDay) > 0) {
+		return fmt.Errorf("recurrence rule FREQ=YEARLY does not support BYDAY or BYMONTHDAY")
+	}
+	for _, wd := range r.ByDay {
+		if wd.Ordinal != 0 && r.Freq != FreqMonthly {
+			return fmt.Errorf("recurrence rule BYDAY ordinals are only supported with FREQ=MONTHLY")
+		}
+	}
+
+	return nil
+}
+
+func parseUntil(s string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			if len(s) == len("20060102") || len(s) == len("2006-01-02") {
+				t = t.Add(24*time.Hour - time.Second) // whole day is included
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("should be a date like 20181231")
+}
+
+func parseByDay(s string) ([]RuleWeekday, error) {
+	var xd []RuleWeekday
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) < 2 {
+			return nil, fmt.Errorf("%q is not a weekday", v)
+		}
+		day, ok := weekdays[v[len(v)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("%q is not a weekday", v)
+		}
+		wd := RuleWeekday{Day: day}
+		if n := v[:len(v)-2]; n != "" {
+			o, err := strconv.Atoi(n)
+			if err != nil || o == 0 || o < -5 || o > 5 {
+				return nil, fmt.Errorf("%q has an invalid ordinal", v)
+			}
+			wd.Ordinal = o
+		}
+		xd = append(xd, wd)
+	}
+	return xd, nil
+}
+
+func parseByMonthDay(s string) ([]int, error) {
+	var xd []int
+	for _, v := range strings.Split(s, ",") {
+		d, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || d == 0 || d < -31 || d > 31 {
+			return nil, fmt.Errorf("%q is not a day of the month", v)
+		}
+		xd = append(xd, d)
+	}
+	return xd, nil
+}
+
+// Next returns the first occurrence of the rule that is after t, for a series that begins at start. It returns
+// false if there are no more occurrences. The search begins at the period containing t, rather than at start, so
+// the cost does not grow with the age of the series. With COUNT, the occurrences in the periods before t are
+// counted, but only until the count is reached.
+func (r RecurrenceRule) Next(start, t time.Time) (time.Time, bool) {
+
+	first := r.period(start, t)
+
+	var count int
+	if r.Count > 0 {
+		for p := 0; p < first && count < r.Count; p++ {
+			for _, c := range r.candidates(start, p) {
+				if !c.Before(start) {
+					count++
+				}
+			}
+		}
+	}
+
+	for p := first; p < first+maxPeriods; p++ {
+		for _, c := range r.candidates(start, p) {
+			if c.Before(start) {
+				continue
+			}
+			count++
+			if r.Count > 0 && count > r.Count {
+				return time.Time{}, false
+			}
+			if !r.Until.IsZero() && c.After(r.Until) {
+				return time.Time{}, false
+			}
+			if c.After(t) {
+				return c, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// period returns the number of intervals from start to the period that contains t, or zero if t is before start.
+// Every occurrence in an earlier period is before t.
+func (r RecurrenceRule) period(start, t time.Time) int {
+
+	if !t.After(start) {
+		return 0
+	}
+
+	// whole days between the dates, ignoring the time of day and daylight saving
+	days := int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).
+		Sub(time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+
+	var n int
+	switch r.Freq {
+	case FreqDaily:
+		n = days
+	case FreqWeekly:
+		// weeks from the Monday of the week containing start
+		n = (days + (int(start.Weekday())+6)%7) / 7
+	case FreqMonthly:
+		n = (t.Year()-start.Year())*12 + int(t.Month()) - int(start.Month())
+	case FreqYearly:
+		n = t.Year() - start.Year()
+	}
+
+	return n / r.Interval
+}
+
+// candidates returns the possible occurrences, in order, in the period that is p intervals after start
+func (r RecurrenceRule) candidates(start time.Time, p int) []time.Time {
+
+	n := p * r.Interval
+	var xt []time.Time
+
+	switch r.Freq {
+
+	case FreqDaily:
+		xt = append(xt, start.AddDate(0, 0, n))
+
+	case FreqWeekly:
+		// Monday of the week containing start
+		offset := (int(start.Weekday()) + 6) % 7
+		monday := start.AddDate(0, 0, -offset+7*n)
+		for i := 0; i < 7; i++ {
+			d := monday.AddDate(0, 0, i)
+			if len(r.ByDay) > 0 || d.Weekday() == start.Weekday() {
+				xt = append(xt, d)
+			}
+		}
+
+	case FreqMonthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(n), 1,
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		days := daysIn(first)
+		for i := 0; i < days; i++ {
+			d := first.AddDate(0, 0, i)
+			if len(r.ByDay) > 0 || len(r.ByMonthDay) > 0 || d.Day() == start.Day() {
+				xt = append(xt, d)
+			}
+		}
+
+	case FreqYearly:
+		d := time.Date(start.Year()+n, start.Month(), start.Day(),
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		if d.Day() == start.Day() { // skip Feb 29 in non-leap years
+			xt = append(xt, d)
+		}
+	}
+
+	// limit by BYDAY and BYMONTHDAY
+	var xf []time.Time
+	for _, d := range xt {
+		if len(r.ByDay) > 0 && !matchWeekday(d, r.ByDay) {
+			continue
+		}
+		if len(r.ByMonthDay) > 0 && !matchMonthDay(d, r.ByMonthDay) {
+			continue
+		}
+		xf = append(xf, d)
+	}
+	sort.Slice(xf, func(i, j int) bool { return xf[i].Before(xf[j]) })
+
+	return xf
+}
+
+// daysIn returns the number of days in the month of t
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func matchMonthDay(d time.Time, xd []int) bool {
+	days := daysIn(d)
+	for _, md := range xd {
+		if md == d.Day() || (md < 0 && days+md+1 == d.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchWeekday(d time.Time, xd []RuleWeekday) bool {
+	for _, wd := range xd {
+		if d.Weekday() != wd.Day {
+			continue
+		}
+		switch {
+		case wd.Ordinal == 0:
+			return true
+		case wd.Ordinal > 0 && (d.Day()-1)/7+1 == wd.Ordinal:
+			return true
+		case wd.Ordinal < 0 && (daysIn(d)-d.Day())/7+1 == -wd.Ordinal:
+			return true
+		}
+	}
+	return false
+}
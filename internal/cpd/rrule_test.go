@@ -0,0 +1,171 @@
+package cpd_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"github.com/cardiacsociety/web-services/internal/cpd"
+)
+
+func TestParseRule(t *testing.T) {
+
+	cases := []struct {
+		rule string
+		err  bool
+	}{
+		{"FREQ=WEEKLY", false},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;UNTIL=20181231", false},
+		{"FREQ=MONTHLY;BYDAY=-1FR", false},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,15;COUNT=6", false},
+		{"", true},
+		{"INTERVAL=2", true},
+		{"FREQ=HOURLY", true},
+		{"FREQ=WEEKLY;INTERVAL=0", true},
+		{"FREQ=WEEKLY;BYDAY=XX", true},
+		{"FREQ=WEEKLY;BYDAY=2TU", true},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", true},
+		{"FREQ=DAILY;COUNT=5;UNTIL=20181231", true},
+		{"FREQ=DAILY;BYSETPOS=1", true},
+	}
+
+	for _, c := range cases {
+		_, err := cpd.ParseRule(c.rule)
+		if (err != nil) != c.err {
+			t.Errorf("ParseRule(%q) err = %v, want error %v", c.rule, err, c.err)
+		}
+	}
+}
+
+func TestRecurrenceRuleNext(t *testing.T) {
+
+	date := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+
+	cases := []struct {
+		name  string
+		rule  string
+		start string
+		want  []string // successive occurrences after start
+	}{
+		{"weekly", "FREQ=WEEKLY", "2018-01-02", []string{"2018-01-09", "2018-01-16"}},
+		{"every second tuesday until december", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;UNTIL=20181211",
+			"2018-11-06", []string{"2018-11-20", "2018-12-04"}},
+		{"monday and thursday", "FREQ=WEEKLY;BYDAY=MO,TH", "2018-01-01", []string{"2018-01-04", "2018-01-08", "2018-01-11"}},
+		{"last friday of month", "FREQ=MONTHLY;BYDAY=-1FR", "2018-01-26", []string{"2018-02-23", "2018-03-30"}},
+		{"second tuesday of month", "FREQ=MONTHLY;BYDAY=2TU", "2018-01-09", []string{"2018-02-13", "2018-03-13"}},
+		{"1st and 15th", "FREQ=MONTHLY;BYMONTHDAY=1,15", "2018-01-01", []string{"2018-01-15", "2018-02-01"}},
+		{"last day of month", "FREQ=MONTHLY;BYMONTHDAY=-1", "2018-01-31", []string{"2018-02-28", "2018-03-31"}},
+		{"monthly on 31st skips short months", "FREQ=MONTHLY", "2018-01-31", []string{"2018-03-31", "2018-05-31"}},
+		{"count", "FREQ=DAILY;INTERVAL=3;COUNT=3", "2018-01-01", []string{"2018-01-04", "2018-01-07"}},
+		{"yearly", "FREQ=YEARLY", "2018-06-30", []string{"2019-06-30"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			is := is.New(t)
+			r, err := cpd.ParseRule(c.rule)
+			is.NoErr(err)
+
+			start := date(c.start)
+			prev := start
+			for _, w := range c.want {
+				next, ok := r.Next(start, prev)
+				is.True(ok)                            // has next occurrence
+				is.Equal(next.Format("2006-01-02"), w) // next occurrence
+				prev = next
+			}
+			_, ok := r.Next(start, prev)
+			is.Equal(ok, !(r.Count > 0 || !r.Until.IsZero())) // finite rules have ended
+		})
+	}
+}
+
+// TestRecurrenceRuleNextLongSeries checks the next occurrence is found for a series that began longer ago than
+// the search limit, and that COUNT still includes the occurrences before t
+func TestRecurrenceRuleNextLongSeries(t *testing.T) {
+	is := is.New(t)
+
+	start := time.Date(1990, 1, 1, 9, 0, 0, 0, time.UTC) // a Monday
+	now := time.Date(2018, 11, 7, 12, 0, 0, 0, time.UTC)
+
+	r, err := cpd.ParseRule("FREQ=DAILY")
+	is.NoErr(err)
+	next, ok := r.Next(start, now)
+	is.True(ok)
+	is.Equal(next, time.Date(2018, 11, 8, 9, 0, 0, 0, time.UTC)) // more than 5000 days after start
+
+	r, err = cpd.ParseRule("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE")
+	is.NoErr(err)
+	next, ok = r.Next(start, now)
+	is.True(ok)
+	is.Equal(next.Format("2006-01-02"), "2018-11-12") // the week of 2018-11-05 is an odd week since start
+
+	r, err = cpd.ParseRule("FREQ=MONTHLY;BYMONTHDAY=-1")
+	is.NoErr(err)
+	next, ok = r.Next(start, now)
+	is.True(ok)
+	is.Equal(next.Format("2006-01-02"), "2018-11-30")
+
+	r, err = cpd.ParseRule("FREQ=DAILY;COUNT=10")
+	is.NoErr(err)
+	next, ok = r.Next(start, start.AddDate(0, 0, 8))
+	is.True(ok)
+	is.Equal(next, start.AddDate(0, 0, 9)) // tenth occurrence
+	_, ok = r.Next(start, start.AddDate(0, 0, 9))
+	is.True(!ok) // no eleventh occurrence
+	_, ok = r.Next(start, now)
+	is.True(!ok)
+}
+
+func TestRecurringActivityUpdateNext(t *testing.T) {
+	is := is.New(t)
+
+	start := time.Date(2018, 11, 6, 0, 0, 0, 0, time.UTC)
+	a := cpd.RecurringActivity{Rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;COUNT=2", Start: start, Next: start}
+
+	a.UpdateNext()
+	is.Equal(a.Next, start.AddDate(0, 0, 14)) // second occurrence
+	is.Equal(a.Done, false)
+
+	a.UpdateNext()
+	is.Equal(a.Done, true) // no third occurrence
+}
+
+func TestRecurringActivityValidate(t *testing.T) {
+
+	tuesday := time.Date(2018, 11, 6, 0, 0, 0, 0, time.UTC)
+	valid := cpd.RecurringActivity{ActivityID: 1, TypeID: 2, Quantity: 1, Description: "Journal club"}
+
+	cases := []struct {
+		name string
+		rule string
+		typ  string
+		next time.Time
+		err  bool
+	}{
+		{"rule", "FREQ=WEEKLY;BYDAY=TU", "", tuesday, false},
+		{"legacy type", "", "monthly", tuesday, false},
+		{"unknown type", "", "fortnightly", tuesday, true},
+		{"invalid rule", "FREQ=SOMETIMES", "", tuesday, true},
+		{"next not an occurrence", "FREQ=WEEKLY;BYDAY=MO", "", tuesday, true},
+		{"no next", "FREQ=WEEKLY", "", time.Time{}, true},
+	}
+
+	for _, c := range cases {
+		a := valid
+		a.Rule, a.Type, a.Next = c.rule, c.typ, c.next
+		err := a.Validate()
+		if (err != nil) != c.err {
+			t.Errorf("%s: Validate() err = %v, want error %v", c.name, err, c.err)
+		}
+	}
+	a := valid
+	a.Rule, a.Next, a.TypeID = "FREQ=WEEKLY;BYDAY=TU", tuesday, 0
+	if a.Validate() == nil {
+		t.Errorf("no type id: Validate() err = nil, want an error")
+	}
+}
@@ -0,0 +1,277 @@
+package cpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Rule types. Rules are evaluated in the order listed here, regardless of the order in which they
+// are declared, so that caps are applied before percentages and minimums are checked last.
+const (
+	RuleActivityMax        = "activity-max"
+	RulePerYearMax         = "per-year-max"
+	RuleCategoryMax        = "category-max"
+	RuleCategoryMaxPercent = "category-max-percent"
+	RuleCategoryMin        = "category-min"
+)
+
+// rulesEnv is the env var that holds a JSON array of evaluation rules
+const rulesEnv = "MAPPCPD_CPD_RULES"
+
+var ruleOrder = map[string]int{
+	RuleActivityMax:        1,
+	RulePerYearMax:         2,
+	RuleCategoryMax:        3,
+	RuleCategoryMaxPercent: 4,
+	RuleCategoryMin:        5,
+}
+
+// Rule is a declarative constraint on how credit is awarded within an evaluation period. ActivityID and
+// CategoryID narrow the scope of the rule - if neither is set the rule applies to all activity. Value is
+// either a number of credit points or, for RuleCategoryMaxPercent, a percentage of the credit required.
+type Rule struct {
+	Name       string  `json:"name" bson:"name"`
+	Type       string  `json:"type" bson:"type"`
+	ActivityID int     `json:"activityId" bson:"activityId"`
+	CategoryID int     `json:"categoryId" bson:"categoryId"`
+	Value      float64 `json:"value" bson:"value"`
+}
+
+// RuleSet is a list of rules applied to an evaluation period report
+type RuleSet []Rule
+
+// RuleResult records the outcome of applying a single rule to a report. Reduction is the amount of credit
+// removed by the rule, and Met is false when a minimum requirement was not satisfied.
+type RuleResult struct {
+	Rule        string  `json:"rule" bson:"rule"`
+	Type        string  `json:"type" bson:"type"`
+	Applied     bool    `json:"applied" bson:"applied"`
+	Met         bool    `json:"met" bson:"met"`
+	Reduction   float64 `json:"reduction" bson:"reduction"`
+	Explanation string  `json:"explanation" bson:"explanation"`
+}
+
+// EvaluationRules returns the rules configured by the MAPPCPD_CPD_RULES env var. The per-activity caps
+// from activity.MaxCredit are always applied and do not need to be declared.
+func EvaluationRules() (RuleSet, error) {
+	var rs RuleSet
+	v := os.Getenv(rulesEnv)
+	if v == "" {
+		return rs, nil
+	}
+	err := json.Unmarshal([]byte(v), &rs)
+	if err != nil {
+		return rs, fmt.Errorf("EvaluationRules() err = %s", err)
+	}
+	return rs, rs.Validate()
+}
+
+// Validate checks that each rule has a known type and a sensible value
+func (rs RuleSet) Validate() error {
+	for i, r := range rs {
+		if _, ok := ruleOrder[r.Type]; !ok {
+			return fmt.Errorf("rule %d (%s) has unknown type %q", i, r.Name, r.Type)
+		}
+		if r.Value < 0 {
+			return fmt.Errorf("rule %d (%s) value cannot be negative", i, r.Name)
+		}
+		if r.Type == RuleCategoryMaxPercent && r.Value > 100 {
+			return fmt.Errorf("rule %d (%s) percentage cannot exceed 100", i, r.Name)
+		}
+	}
+	return nil
+}
+
+// ApplyRules applies the per-activity caps, followed by the rules in rs, to the report activities. It sets
+// CreditAwarded for each activity, records an explanation for each rule in .Rules and re-calculates
+// .CreditObtained.
+func (e *MemberActivityReport) ApplyRules(rs RuleSet) {
+
+	e.Rules = nil
+	for i := range e.Activities {
+		e.Activities[i].CreditAwarded = e.Activities[i].CreditTotal
+	}
+
+	// The built-in activity caps come first, but only generate an explanation when they reduce credit
+	for i := range e.Activities {
+		a := &e.Activities[i]
+		before := a.CreditAwarded
+		a.capCreditTotal()
+		if a.CreditAwarded < before {
+			e.Rules = append(e.Rules, RuleResult{
+				Rule:        a.ActivityName,
+				Type:        RuleActivityMax,
+				Applied:     true,
+				Met:         true,
+				Reduction:   before - a.CreditAwarded,
+				Explanation: fmt.Sprintf("%s is capped at %.2f credit, %.2f was recorded", a.ActivityName, a.MaxCredit, before),
+			})
+		}
+	}
+
+	sorted := make(RuleSet, len(rs))
+	copy(sorted, rs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return ruleOrder[sorted[i].Type] < ruleOrder[sorted[j].Type]
+	})
+
+	for _, r := range sorted {
+		e.Rules = append(e.Rules, e.applyRule(r))
+	}
+
+	e.CreditObtained = 0
+	e.calcTotalCredit()
+}
+
+// RulesMet returns false if any minimum requirement rule was not satisfied
+func (e MemberActivityReport) RulesMet() bool {
+	for _, r := range e.Rules {
+		if !r.Met {
+			return false
+		}
+	}
+	return true
+}
+
+// applyRule applies a single rule to the activities within its scope
+func (e *MemberActivityReport) applyRule(r Rule) RuleResult {
+
+	res := RuleResult{Rule: r.Name, Type: r.Type, Met: true}
+	xa := e.scope(r)
+	awarded := sumAwarded(xa)
+
+	switch r.Type {
+
+	case RuleActivityMax, RuleCategoryMax:
+		res.Reduction = reduceCredit(xa, awarded-r.Value)
+		res.Explanation = fmt.Sprintf("%s credit is capped at %.2f, %.2f was awarded", r.scopeName(), r.Value, awarded)
+
+	case RuleCategoryMaxPercent:
+		max := float64(e.CreditRequired) * r.Value / 100
+		res.Reduction = reduceCredit(xa, awarded-max)
+		res.Explanation = fmt.Sprintf("%s credit is capped at %.0f%% of %d required (%.2f), %.2f was awarded",
+			r.scopeName(), r.Value, e.CreditRequired, max, awarded)
+
+	case RulePerYearMax:
+		var excess float64
+		for _, y := range e.periodYears() {
+			credit := sumAwardedBetween(xa, y[0], y[1])
+			if credit > r.Value {
+				excess += credit - r.Value
+			}
+		}
+		res.Reduction = reduceCredit(xa, excess)
+		res.Explanation = fmt.Sprintf("%s credit is capped at %.2f in each year of the period, %.2f exceeded the yearly caps",
+			r.scopeName(), r.Value, excess)
+
+	case RuleCategoryMin:
+		res.Met = awarded >= r.Value
+		res.Explanation = fmt.Sprintf("%s requires at least %.2f credit, %.2f was awarded", r.scopeName(), r.Value, awarded)
+	}
+
+	res.Applied = res.Reduction > 0
+	return res
+}
+
+// scope returns the activities that a rule applies to
+func (e *MemberActivityReport) scope(r Rule) []*activityReport {
+	var xa []*activityReport
+	for i := range e.Activities {
+		a := &e.Activities[i]
+		if r.ActivityID > 0 && a.ActivityID != r.ActivityID {
+			continue
+		}
+		if r.CategoryID > 0 && a.CategoryID != r.CategoryID {
+			continue
+		}
+		xa = append(xa, a)
+	}
+	return xa
+}
+
+// periodYears splits the evaluation period into consecutive one year windows, returned as
+// [start, end) date pairs. The last window is truncated at the end of the period.
+func (e *MemberActivityReport) periodYears() [][2]time.Time {
+	var years [][2]time.Time
+	start, err := time.Parse("2006-01-02", e.StartDate)
+	if err != nil {
+		return years
+	}
+	end, err := time.Parse("2006-01-02", e.EndDate)
+	if err != nil {
+		return years
+	}
+	end = end.AddDate(0, 0, 1)
+	for s := start; s.Before(end); s = s.AddDate(1, 0, 0) {
+		n := s.AddDate(1, 0, 0)
+		if n.After(end) {
+			n = end
+		}
+		years = append(years, [2]time.Time{s, n})
+	}
+	return years
+}
+
+// scopeName describes the scope of a rule for explanations
+func (r Rule) scopeName() string {
+	switch {
+	case r.Name != "":
+		return r.Name
+	case r.ActivityID > 0:
+		return fmt.Sprintf("Activity %d", r.ActivityID)
+	case r.CategoryID > 0:
+		return fmt.Sprintf("Category %d", r.CategoryID)
+	}
+	return "All activity"
+}
+
+// reduceCredit removes up to amount from the credit awarded to the activities, in proportion to the credit
+// each one was awarded, and returns the amount actually removed.
+func reduceCredit(xa []*activityReport, amount float64) float64 {
+	awarded := sumAwarded(xa)
+	if amount <= 0 || awarded <= 0 {
+		return 0
+	}
+	if amount > awarded {
+		amount = awarded
+	}
+	for _, a := range xa {
+		a.CreditAwarded -= amount * a.CreditAwarded / awarded
+	}
+	return amount
+}
+
+func sumAwarded(xa []*activityReport) float64 {
+	var total float64
+	for _, a := range xa {
+		total += a.CreditAwarded
+	}
+	return total
+}
+
+// sumAwardedBetween adds up the credit awarded for records dated on or after start, and before end. The credit
+// awarded to an activity, after any caps already applied, is shared between its records in proportion to the
+// credit recorded for each one, so that credit removed by an earlier cap is not counted again.
+func sumAwardedBetween(xa []*activityReport, start, end time.Time) float64 {
+	var total float64
+	for _, a := range xa {
+		var recorded, between float64
+		for _, r := range a.Records {
+			recorded += r.Credit
+			d, err := time.Parse("2006-01-02", r.Date)
+			if err != nil {
+				continue
+			}
+			if !d.Before(start) && d.Before(end) {
+				between += r.Credit
+			}
+		}
+		if recorded > 0 {
+			total += a.CreditAwarded * between / recorded
+		}
+	}
+	return total
+}
@@ -0,0 +1,62 @@
+package cpd_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cardiacsociety/web-services/internal/cpd"
+	"github.com/matryer/is"
+)
+
+func TestRuleSetValidate(t *testing.T) {
+	is := is.New(t)
+
+	rs := cpd.RuleSet{
+		{Name: "Category cap", Type: cpd.RuleCategoryMaxPercent, CategoryID: 1, Value: 50},
+		{Name: "Audit minimum", Type: cpd.RuleCategoryMin, CategoryID: 2, Value: 10},
+	}
+	is.NoErr(rs.Validate()) // valid rule set
+
+	rs = cpd.RuleSet{{Name: "Unknown", Type: "no-such-rule", Value: 1}}
+	is.True(rs.Validate() != nil) // unknown rule type
+
+	rs = cpd.RuleSet{{Name: "Too much", Type: cpd.RuleCategoryMaxPercent, Value: 150}}
+	is.True(rs.Validate() != nil) // percentage over 100
+}
+
+func TestRulesMet(t *testing.T) {
+	is := is.New(t)
+
+	r := cpd.MemberActivityReport{
+		Rules: []cpd.RuleResult{
+			{Rule: "Category cap", Type: cpd.RuleCategoryMax, Applied: true, Met: true, Reduction: 5},
+		},
+	}
+	is.True(r.RulesMet()) // caps do not affect whether rules are met
+
+	r.Rules = append(r.Rules, cpd.RuleResult{Rule: "Audit minimum", Type: cpd.RuleCategoryMin, Met: false})
+	is.True(!r.RulesMet()) // minimum not met
+}
+
+// TestPerYearMaxAfterActivityCap checks the yearly cap counts the credit awarded after the activity cap, rather
+// than the credit recorded, so credit is not removed twice
+func TestPerYearMaxAfterActivityCap(t *testing.T) {
+	is := is.New(t)
+
+	var r cpd.MemberActivityReport
+	err := json.Unmarshal([]byte(`{
+		"startDate": "2018-01-01",
+		"endDate": "2020-12-31",
+		"activities": [{
+			"activityId": 23,
+			"creditTotal": 6,
+			"maxCredit": 3,
+			"records": [{"date": "2018-03-01", "credit": 3}, {"date": "2018-06-01", "credit": 3}]
+		}]
+	}`), &r)
+	is.NoErr(err)
+
+	r.ApplyRules(cpd.RuleSet{{Name: "Yearly cap", Type: cpd.RulePerYearMax, ActivityID: 23, Value: 2}})
+	is.Equal(r.CreditObtained, 2.0)     // capped at 3 for the activity, then at 2 for 2018
+	is.Equal(r.Rules[1].Reduction, 1.0) // only the credit awarded over the yearly cap is removed
+}
@@ -6,20 +6,30 @@ import (
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
 )
 
-// GetIDs returns a list of primary keys (id) from any table. Takes the table name and an sql
-// clause.
-func GetIDs(ds datastore.Datastore, table string, clause string) ([]int, error) {
-	return GetIntCol(ds, table, "id", clause)
+// GetIDs returns a list of primary keys (id) from any table. Takes the table name and an optional
+// filter, which can be nil.
+func GetIDs(ds datastore.Datastore, table string, f *datastore.Filter) ([]int, error) {
+	return GetIntCol(ds, table, "id", f)
 }
 
 // GetIntCol will return integer values from a table, from the specified column.
-// It is used for fetching ids or fk ids based on the sql clause.
-func GetIntCol(ds datastore.Datastore, table, column, clause string, ) ([]int, error) {
+// It is used for fetching ids or fk ids based on the filter.
+func GetIntCol(ds datastore.Datastore, table, column string, f *datastore.Filter) ([]int, error) {
 
 	var ids []int
 
-	sql := fmt.Sprintf("SELECT %s FROM %s %s", column, table, clause)
-	rows, err := ds.MySQL.Session.Query(sql)
+	for _, s := range []string{table, column} {
+		if err := datastore.CheckIdentifier(s); err != nil {
+			return ids, err
+		}
+	}
+	clause, args, err := f.Where()
+	if err != nil {
+		return ids, err
+	}
+
+	sql := fmt.Sprintf("SELECT %s FROM %s%s", column, table, clause)
+	rows, err := ds.MySQL.Session.Query(sql, args...)
 	if err != nil {
 		return ids, err
 	}
@@ -34,7 +44,6 @@ func GetIntCol(ds datastore.Datastore, table, column, clause string, ) ([]int, e
 	return ids, nil
 }
 
-
 // GetRows runs any query and returns a map slice where each slice is a row
 func GetRows(ds datastore.Datastore, sql string) ([]map[string]string, error) {
 
@@ -3,7 +3,6 @@ package invoice
 import (
 	"database/sql"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/cardiacsociety/web-services/internal/member"
@@ -30,8 +29,7 @@ type Invoice struct {
 // ByID fetches an invoice by invoice ID
 func ByID(ds datastore.Datastore, invoiceID int) (Invoice, error) {
 	var i Invoice
-	q := fmt.Sprintf(queries["select-invoice-by-id"], invoiceID)
-	xi, err := execute(ds, q)
+	xi, err := execute(ds, queries["select-invoice-by-id"], invoiceID)
 	if err != nil {
 		return i, err
 	}
@@ -60,9 +58,11 @@ func ByIDs(ds datastore.Datastore, invoiceIDs []int) ([]Invoice, error) {
 
 	var xi []Invoice
 
-	idList := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(invoiceIDs)), ","), "[]")
-	q := queries["select-invoices"] + fmt.Sprintf(" AND i.id IN (%s)", idList)
-	xi, err := execute(ds, q)
+	clause, args, err := datastore.NewFilter().In("i.id", invoiceIDs).And()
+	if err != nil {
+		return nil, err
+	}
+	xi, err = execute(ds, queries["select-invoices"]+clause, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -74,11 +74,11 @@ func ByIDs(ds datastore.Datastore, invoiceIDs []int) ([]Invoice, error) {
 	return xi, err
 }
 
-func execute(ds datastore.Datastore, query string) ([]Invoice, error) {
+func execute(ds datastore.Datastore, query string, args ...interface{}) ([]Invoice, error) {
 
 	var xi []Invoice
 
-	rows, err := ds.MySQL.Session.Query(query)
+	rows, err := ds.MySQL.Session.Query(query, args...)
 	if err != nil {
 		return xi, fmt.Errorf("Query() err = %s", err)
 	}
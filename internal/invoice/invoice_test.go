@@ -3,6 +3,7 @@ package invoice_test
 import (
 	"log"
 	"testing"
+	"time"
 
 	"github.com/cardiacsociety/web-services/internal/invoice"
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
@@ -22,6 +23,7 @@ func TestAll(t *testing.T) {
 		t.Run("testByID", testByID)
 		t.Run("testByIDs", testByIDs)
 		t.Run("testExcelReport", testExcelReport)
+		t.Run("testRaise", testRaise)
 	})
 }
 
@@ -100,6 +102,22 @@ func testByIDs(t *testing.T) {
 }
 
 // fetch some test data and ensure excel report is not returning an error
+func testRaise(t *testing.T) {
+	issued := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	due := issued.AddDate(0, 0, 30)
+	i, err := invoice.Raise(ds, 1, 1, issued, due)
+	if err != nil {
+		t.Fatalf("invoice.Raise() err = %s", err)
+	}
+	want := 330.00 // 300.00 plus 10% GST
+	if i.Amount != want {
+		t.Errorf("invoice.Raise() Amount = %v, want %v", i.Amount, want)
+	}
+	if i.MemberID != 1 {
+		t.Errorf("invoice.Raise() MemberID = %d, want 1", i.MemberID)
+	}
+}
+
 func testExcelReport(t *testing.T) {
 
 	ids := []int{1, 2} // invoice records
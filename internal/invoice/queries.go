@@ -3,6 +3,12 @@ package invoice
 var queries = map[string]string{
 	"select-invoices":      selectActiveInvoices,
 	"select-invoice-by-id": selectInvoiceByID,
+
+	"select-subscription-months": selectSubscriptionMonths,
+	"select-subscription-items":  selectSubscriptionItems,
+	"select-member-tax":          selectMemberTax,
+	"insert-invoice":             insertInvoice,
+	"insert-invoice-item":        insertInvoiceItem,
 }
 
 const selectInvoices = `
@@ -28,4 +34,58 @@ WHERE 1
 
 const selectActiveInvoices = selectInvoices + ` AND i.active = 1 `
 
-const selectInvoiceByID = selectActiveInvoices + ` AND i.id = %v `
+const selectInvoiceByID = selectActiveInvoices + ` AND i.id = ? `
+
+const selectSubscriptionMonths = `SELECT recurrence_months FROM fn_subscription WHERE active = 1 AND id = ?`
+
+const selectSubscriptionItems = `
+SELECT 
+    si.fn_inventory_id,
+    si.description,
+    si.quantity,
+    inv.unit_charge,
+    inv.tax
+FROM
+    fn_subscription_inventory si
+        INNER JOIN
+    fn_inventory inv ON si.fn_inventory_id = inv.id
+WHERE
+    si.active = 1 AND si.fn_subscription_id = ?
+ORDER BY si.id`
+
+// tax for the member's country, or none
+const selectMemberTax = `
+SELECT 
+    COALESCE(MAX(t.name), ''),
+    COALESCE(MAX(t.rate), 0)
+FROM
+    member m
+        LEFT JOIN
+    fn_tax t ON t.country_id = m.country_id AND t.active = 1
+WHERE
+    m.id = ?`
+
+const insertInvoice = `
+INSERT INTO fn_m_invoice (
+    member_id,
+    fn_subscription_id,
+    updated_at,
+    completed_at,
+    invoiced_on,
+    due_on,
+    start_on,
+    end_on,
+    invoice_total
+) VALUES (?, ?, NOW(), NOW(), ?, ?, ?, ?, ?)`
+
+const insertInvoiceItem = `
+INSERT INTO fn_invoice_inventory (
+    fn_m_invoice_id,
+    fn_inventory_id,
+    updated_at,
+    description,
+    quantity,
+    unit_charge,
+    tax_rate,
+    tax_name
+) VALUES (?, ?, NOW(), ?, ?, ?, ?, ?)`
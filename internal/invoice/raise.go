@@ -0,0 +1,153 @@
+package invoice
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// lineItem is an invoice line item taken from a subscription template
+type lineItem struct {
+	InventoryID int
+	Description string
+	Quantity    float64
+	UnitCharge  float64
+	Tax         bool
+}
+
+// Raise issues an invoice to a member for the subscription template subscriptionID, with the line items of the
+// template. The billing period starts on the issue date and runs for the recurrence period of the template. Tax
+// is charged at the rate for the member's country.
+func Raise(ds datastore.Datastore, memberID, subscriptionID int, issueDate, dueDate time.Time) (Invoice, error) {
+
+	tx, err := ds.MySQL.Session.Begin()
+	if err != nil {
+		return Invoice{}, err
+	}
+	defer tx.Rollback()
+
+	i, err := RaiseTx(tx, memberID, subscriptionID, issueDate, dueDate)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	return ByID(ds, i.ID)
+}
+
+// RaiseTx issues an invoice, as for Raise, as part of a transaction. The returned invoice has the fields that were
+// written, as the invoice cannot be read back until the transaction is committed.
+func RaiseTx(tx *sql.Tx, memberID, subscriptionID int, issueDate, dueDate time.Time) (Invoice, error) {
+
+	var months int
+	err := tx.QueryRow(queries["select-subscription-months"], subscriptionID).Scan(&months)
+	if err != nil {
+		return Invoice{}, errors.Wrap(err, "select-subscription-months query error")
+	}
+
+	var taxName string
+	var taxRate float64
+	err = tx.QueryRow(queries["select-member-tax"], memberID).Scan(&taxName, &taxRate)
+	if err != nil {
+		return Invoice{}, errors.Wrap(err, "select-member-tax query error")
+	}
+
+	items, err := subscriptionItems(tx, subscriptionID)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if len(items) == 0 {
+		return Invoice{}, errors.Errorf("subscription id %d has no line items", subscriptionID)
+	}
+
+	var total float64
+	for _, li := range items {
+		total += li.total(taxRate)
+	}
+
+	endDate := issueDate.AddDate(0, months, -1)
+	res, err := tx.Exec(queries["insert-invoice"],
+		memberID,
+		subscriptionID,
+		issueDate.Format("2006-01-02"),
+		dueDate.Format("2006-01-02"),
+		issueDate.Format("2006-01-02"),
+		endDate.Format("2006-01-02"),
+		round(total),
+	)
+	if err != nil {
+		return Invoice{}, errors.Wrap(err, "insert-invoice query error")
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	for _, li := range items {
+		rate, name := 0.0, ""
+		if li.Tax {
+			rate, name = taxRate, taxName
+		}
+		_, err := tx.Exec(queries["insert-invoice-item"], id, li.InventoryID, li.Description, li.Quantity,
+			li.UnitCharge, rate, name)
+		if err != nil {
+			return Invoice{}, errors.Wrap(err, "insert-invoice-item query error")
+		}
+	}
+
+	return Invoice{
+		ID:             int(id),
+		MemberID:       memberID,
+		IssueDate:      issueDate,
+		DueDate:        dueDate,
+		SubscriptionID: subscriptionID,
+		Amount:         round(total),
+	}, nil
+}
+
+// subscriptionItems returns the line items for a subscription template
+func subscriptionItems(tx *sql.Tx, subscriptionID int) ([]lineItem, error) {
+
+	var items []lineItem
+
+	rows, err := tx.Query(queries["select-subscription-items"], subscriptionID)
+	if err != nil {
+		return nil, errors.Wrap(err, "select-subscription-items query error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var li lineItem
+		var tax int
+		err := rows.Scan(&li.InventoryID, &li.Description, &li.Quantity, &li.UnitCharge, &tax)
+		if err != nil {
+			return nil, errors.Wrap(err, "select-subscription-items scan error")
+		}
+		li.Tax = tax == 1
+		items = append(items, li)
+	}
+
+	return items, rows.Err()
+}
+
+// total returns the line item total including tax
+func (li lineItem) total(taxRate float64) float64 {
+	t := li.Quantity * li.UnitCharge
+	if li.Tax {
+		t += t * taxRate / 100
+	}
+	return t
+}
+
+// round to the nearest cent
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -2,8 +2,8 @@
 package issue
 
 import (
+	"database/sql"
 	"errors"
-	"fmt"
 
 	"github.com/cardiacsociety/web-services/internal/note"
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
@@ -59,6 +59,16 @@ type Category struct {
 
 // InsertRow creates a new issue row with fields from Issue
 func (i *Issue) InsertRow(ds datastore.Datastore) error {
+	return i.insertRow(ds.MySQL.Session)
+}
+
+// InsertRowTx creates a new issue row, as for InsertRow, as part of a transaction
+func (i *Issue) InsertRowTx(tx *sql.Tx) error {
+	return i.insertRow(tx)
+}
+
+// insertRow creates a new issue row, and its association, using e
+func (i *Issue) insertRow(e datastore.Execer) error {
 	switch {
 	case i.ID > 0:
 		return errors.New(ErrorIDNotNil)
@@ -67,8 +77,7 @@ func (i *Issue) InsertRow(ds datastore.Datastore) error {
 	case i.Description == "":
 		return errors.New(ErrorNoDescription)
 	}
-	q := fmt.Sprintf(queries["insert-issue"], i.Type.ID, i.Description, i.Action)
-	res, err := ds.MySQL.Session.Exec(q)
+	res, err := e.Exec(queries["insert-issue"], i.Type.ID, i.Description, i.Action)
 	if err != nil {
 		return err
 	}
@@ -84,8 +93,7 @@ func (i *Issue) InsertRow(ds datastore.Datastore) error {
 		if err != nil {
 			return err
 		}
-		q := fmt.Sprintf(queries["insert-issue-association"], i.ID, i.MemberID, i.AssociationID, i.Association)
-		_, err = ds.MySQL.Session.Exec(q)
+		_, err = e.Exec(queries["insert-issue-association"], i.ID, i.MemberID, i.AssociationID, i.Association)
 		if err != nil {
 			return err
 		}
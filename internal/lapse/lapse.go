@@ -0,0 +1,194 @@
+// Package lapse identifies members whose membership should lapse because of unpaid invoices, and lapses them
+// once the list has been reviewed.
+package lapse
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cardiacsociety/web-services/internal/member"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// Criteria for selecting lapse candidates. An invoice is overdue if it is still unpaid GraceDays after its due
+// date, as at the AsAt date, format "2006-01-02", which defaults to today.
+type Criteria struct {
+	AsAt      string `json:"asAt"`
+	GraceDays int    `json:"graceDays"`
+}
+
+// Candidate is a member with one or more overdue invoices
+type Candidate struct {
+	MemberID    int       `json:"memberId"`
+	Member      string    `json:"member"`
+	Email       string    `json:"email"`
+	Status      string    `json:"status"`
+	Outstanding float64   `json:"outstanding"`
+	DaysOverdue int       `json:"daysOverdue"` // for the oldest invoice
+	Invoices    []Invoice `json:"invoices"`
+}
+
+// Invoice is an overdue invoice. Allocated is the total of the payments allocated to the invoice.
+type Invoice struct {
+	ID          int     `json:"id"`
+	IssueDate   string  `json:"issueDate"`
+	DueDate     string  `json:"dueDate"`
+	Amount      float64 `json:"amount"`
+	Allocated   float64 `json:"allocated"`
+	Outstanding float64 `json:"outstanding"`
+}
+
+// Result is the outcome of confirming the lapse of a candidate
+type Result struct {
+	Candidate
+	Lapsed bool   `json:"lapsed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Validate checks the criteria, and returns the as at date
+func (c Criteria) Validate(now time.Time) (time.Time, error) {
+
+	if c.GraceDays < 0 {
+		return time.Time{}, fmt.Errorf("grace days cannot be negative")
+	}
+	if c.AsAt == "" {
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	asAt, err := time.Parse("2006-01-02", c.AsAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("as at date %q should be formatted as YYYY-MM-DD", c.AsAt)
+	}
+	return asAt, nil
+}
+
+// Candidates returns the members that have an invoice overdue past the grace period, do not have an active
+// subscription, whose status can change to lapsed, and who are not financial - ie they do not have a paid invoice
+// for a billing period that includes the as at date. An invoice is unpaid if it is not flagged as paid, and the
+// payments allocated to it are less than the invoice total.
+func Candidates(ds datastore.Datastore, c Criteria) ([]Candidate, error) {
+
+	asAt, err := c.Validate(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	cutOff := asAt.AddDate(0, 0, -c.GraceDays).Format("2006-01-02")
+
+	rows, err := ds.MySQL.Session.Query(queries["select-overdue-invoices"], cutOff)
+	if err != nil {
+		return nil, errors.Wrap(err, "select-overdue-invoices query error")
+	}
+	defer rows.Close()
+
+	var xc []Candidate
+	index := map[int]int{}
+	for rows.Next() {
+		var memberID int
+		var name, email string
+		var i Invoice
+		err := rows.Scan(&i.ID, &memberID, &name, &email, &i.IssueDate, &i.DueDate, &i.Amount, &i.Allocated)
+		if err != nil {
+			return nil, errors.Wrap(err, "select-overdue-invoices scan error")
+		}
+		i.Outstanding = i.Amount - i.Allocated
+
+		n, ok := index[memberID]
+		if !ok {
+			n = len(xc)
+			index[memberID] = n
+			xc = append(xc, Candidate{MemberID: memberID, Member: name, Email: email})
+		}
+		xc[n].add(i, asAt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var candidates []Candidate
+	for _, x := range xc {
+		ok, err := x.eligible(ds, asAt)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			candidates = append(candidates, x)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].DaysOverdue > candidates[j].DaysOverdue })
+
+	return candidates, nil
+}
+
+// add an overdue invoice to the candidate
+func (c *Candidate) add(i Invoice, asAt time.Time) {
+	c.Invoices = append(c.Invoices, i)
+	c.Outstanding += i.Outstanding
+	if due, err := time.Parse("2006-01-02", i.DueDate); err == nil {
+		if days := int(asAt.Sub(due).Hours() / 24); days > c.DaysOverdue {
+			c.DaysOverdue = days
+		}
+	}
+}
+
+// eligible checks that the candidate is not financial, and has a status managed by the lifecycle that can change to
+// lapsed, and sets the candidate's current status
+func (c *Candidate) eligible(ds datastore.Datastore, asAt time.Time) (bool, error) {
+
+	var financial int
+	d := asAt.Format("2006-01-02")
+	err := ds.MySQL.Session.QueryRow(queries["select-member-financial"], c.MemberID, d, d).Scan(&financial)
+	if err != nil {
+		return false, errors.Wrap(err, "select-member-financial query error")
+	}
+	if financial > 0 {
+		return false, nil
+	}
+
+	m := member.Member{ID: c.MemberID}
+	c.Status, err = m.CurrentStatus(ds)
+	if err != nil {
+		return false, err
+	}
+	if c.Status == member.StatusUnmanaged {
+		return false, nil // not managed by the lifecycle, so leave it alone
+	}
+
+	return member.CanTransition(c.Status, member.StatusLapsed) == nil, nil
+}
+
+// Confirm lapses the members in memberIDs, usually the reviewed list of candidates. The candidates are selected
+// again with the same criteria so that a member who has paid, or whose status has changed, since the review is not
+// lapsed.
+func Confirm(ds datastore.Datastore, c Criteria, memberIDs []int) ([]Result, error) {
+
+	xc, err := Candidates(ds, c)
+	if err != nil {
+		return nil, err
+	}
+	candidates := map[int]Candidate{}
+	for _, x := range xc {
+		candidates[x.MemberID] = x
+	}
+
+	var xr []Result
+	for _, id := range memberIDs {
+		x, ok := candidates[id]
+		if !ok {
+			xr = append(xr, Result{Candidate: Candidate{MemberID: id}, Error: "not a lapse candidate"})
+			continue
+		}
+		r := Result{Candidate: x}
+		m := member.Member{ID: id}
+		if err := m.Lapse(ds); err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Lapsed = true
+			r.Status = member.StatusLapsed
+		}
+		xr = append(xr, r)
+	}
+
+	return xr, nil
+}
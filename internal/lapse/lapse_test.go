@@ -0,0 +1,173 @@
+package lapse_test
+
+import (
+	"log"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"github.com/cardiacsociety/web-services/internal/lapse"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+	"github.com/cardiacsociety/web-services/testdata"
+)
+
+var ds datastore.Datastore
+
+func TestLapse(t *testing.T) {
+
+	var teardown func()
+	ds, teardown = setup()
+	defer teardown()
+
+	t.Run("lapse", func(t *testing.T) {
+		t.Run("testPingDatabase", testPingDatabase)
+		t.Run("testCandidatesActiveSubscription", testCandidatesActiveSubscription)
+		t.Run("testCandidates", testCandidates)
+		t.Run("testCandidatesGracePeriod", testCandidatesGracePeriod)
+		t.Run("testExcelReport", testExcelReport)
+		t.Run("testConfirm", testConfirm)
+		t.Run("testReinstate", testReinstate)
+		t.Run("testReinstateNotLapsed", testReinstateNotLapsed)
+	})
+}
+
+func setup() (datastore.Datastore, func()) {
+	var db = testdata.NewDataStore()
+	err := db.SetupMySQL()
+	if err != nil {
+		log.Fatalf("db.SetupMySQL() err = %s", err)
+	}
+	return db.Store, func() {
+		err := db.TearDownMySQL()
+		if err != nil {
+			log.Fatalf("db.TearDownMySQL() err = %s", err)
+		}
+	}
+}
+
+func testPingDatabase(t *testing.T) {
+	err := ds.MySQL.Session.Ping()
+	if err != nil {
+		t.Fatalf("Ping() err = %s", err)
+	}
+}
+
+// member 1 has overdue invoices but also an active subscription, so is not a candidate until the subscription is
+// de-activated
+func testCandidatesActiveSubscription(t *testing.T) {
+	is := is.New(t)
+	xc, err := lapse.Candidates(ds, lapse.Criteria{AsAt: "2019-03-01", GraceDays: 30})
+	is.NoErr(err)
+	is.Equal(len(xc), 0)
+
+	_, err = ds.MySQL.Session.Exec("UPDATE fn_m_subscription SET active = 0 WHERE member_id = 1")
+	is.NoErr(err)
+}
+
+// member 1 has two unpaid invoices, due 2018-01-15 with $1.16 outstanding, and due 2019-01-15 for $220.22
+func testCandidates(t *testing.T) {
+	is := is.New(t)
+	xc, err := lapse.Candidates(ds, lapse.Criteria{AsAt: "2019-03-01", GraceDays: 30})
+	is.NoErr(err)
+	is.Equal(len(xc), 1)
+	is.Equal(xc[0].MemberID, 1)
+	is.Equal(xc[0].Status, "active")
+	is.Equal(len(xc[0].Invoices), 2)
+	is.True(math.Abs(xc[0].Outstanding-221.38) < 0.001)
+}
+
+func testCandidatesGracePeriod(t *testing.T) {
+	is := is.New(t)
+	xc, err := lapse.Candidates(ds, lapse.Criteria{AsAt: "2019-03-01", GraceDays: 60})
+	is.NoErr(err)
+	is.Equal(len(xc), 1)
+	is.Equal(len(xc[0].Invoices), 1) // 2019 invoice is within the grace period
+	is.Equal(xc[0].Invoices[0].ID, 1)
+}
+
+func testExcelReport(t *testing.T) {
+	is := is.New(t)
+	xc, err := lapse.Candidates(ds, lapse.Criteria{AsAt: "2019-03-01", GraceDays: 30})
+	is.NoErr(err)
+	f, err := lapse.ExcelReport(xc)
+	is.NoErr(err)
+	rows := f.GetRows("Sheet1")
+	is.Equal(len(rows), 3) // heading and one row per invoice
+}
+
+func testConfirm(t *testing.T) {
+	is := is.New(t)
+	c := lapse.Criteria{AsAt: "2019-03-01", GraceDays: 30}
+	xr, err := lapse.Confirm(ds, c, []int{1, 2})
+	is.NoErr(err)
+	is.Equal(len(xr), 2)
+	is.True(xr[0].Lapsed)
+	is.Equal(xr[0].Status, "lapsed")
+	is.True(!xr[1].Lapsed) // not a candidate
+	is.True(xr[1].Error != "")
+
+	xc, err := lapse.Candidates(ds, c)
+	is.NoErr(err)
+	is.Equal(len(xc), 0) // lapsed member cannot lapse again
+}
+
+func testReinstate(t *testing.T) {
+	is := is.New(t)
+	r := lapse.Reinstatement{MemberID: 1, SubscriptionID: 1, Invoice: true, Reason: "Paid outstanding fees"}
+	rd, err := lapse.Reinstate(ds, r)
+	is.NoErr(err)
+	is.Equal(rd.StatusFrom, "lapsed")
+	is.Equal(rd.StatusTo, "reinstated")
+	is.Equal(rd.Subscription, "Associate Membership")
+	is.True(rd.InvoiceID > 0)
+	is.Equal(rd.InvoiceAmount, 330.00) // 300.00 plus GST
+	is.True(rd.IssueID > 0)
+	is.Equal(len(rd.Changes), 4) // status, subscription, invoice and issue
+}
+
+func testReinstateNotLapsed(t *testing.T) {
+	is := is.New(t)
+	r := lapse.Reinstatement{MemberID: 1, SubscriptionID: 1}
+	rd, err := lapse.Reinstate(ds, r)
+	is.True(err != nil) // already reinstated
+	is.Equal(len(rd.Changes), 0)
+}
+
+func TestCriteriaValidate(t *testing.T) {
+	is := is.New(t)
+	now := time.Date(2019, 3, 1, 15, 4, 5, 0, time.UTC)
+
+	d, err := lapse.Criteria{}.Validate(now)
+	is.NoErr(err)
+	is.Equal(d.Format("2006-01-02 15:04"), "2019-03-01 00:00") // defaults to today
+
+	_, err = lapse.Criteria{GraceDays: -1}.Validate(now)
+	is.True(err != nil)
+	_, err = lapse.Criteria{AsAt: "1/3/2019"}.Validate(now)
+	is.True(err != nil)
+}
+
+func TestNoticeEmail(t *testing.T) {
+	is := is.New(t)
+	c := lapse.Candidate{
+		Member:      "Michael Donnici",
+		Email:       "michael@test.com",
+		Outstanding: 221.38,
+		Invoices: []lapse.Invoice{
+			{ID: 1, DueDate: "2018-01-15", Outstanding: 1.16},
+			{ID: 2, DueDate: "2019-01-15", Outstanding: 220.22},
+		},
+	}
+	em := c.NoticeEmail(lapse.Sender{Name: "Membership", Email: "members@test.com"})
+	is.Equal(em.ToEmail, "michael@test.com")
+	is.Equal(em.FromEmail, "members@test.com")
+	is.True(strings.Contains(em.PlainContent, "Invoice 2 due 2019-01-15: $220.22"))
+	is.True(strings.Contains(em.HTMLContent, "$221.38"))
+
+	c.Member = "<b>Michael</b>"
+	em = c.NoticeEmail(lapse.Sender{})
+	is.True(strings.Contains(em.HTMLContent, "&lt;b&gt;Michael&lt;/b&gt;"))
+}
@@ -0,0 +1,41 @@
+package lapse
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/cardiacsociety/web-services/internal/notification"
+)
+
+// Sender is the name and email address that lapse notices are sent from
+type Sender struct {
+	Name  string `json:"senderName"`
+	Email string `json:"senderEmail"`
+}
+
+// NoticeEmail returns the notice that tells a member their membership has lapsed, and lists the unpaid invoices
+func (c Candidate) NoticeEmail(s Sender) notification.Email {
+
+	var plain, body strings.Builder
+	fmt.Fprintf(&plain, "Dear %s,\n\nYour membership has lapsed as the following invoices remain unpaid:\n\n", c.Member)
+	fmt.Fprintf(&body, "<p>Dear %s,</p><p>Your membership has lapsed as the following invoices remain unpaid:</p><ul>",
+		html.EscapeString(c.Member))
+	for _, i := range c.Invoices {
+		fmt.Fprintf(&plain, "- Invoice %d due %s: $%.2f outstanding\n", i.ID, i.DueDate, i.Outstanding)
+		fmt.Fprintf(&body, "<li>Invoice %d due %s: $%.2f outstanding</li>", i.ID, i.DueDate, i.Outstanding)
+	}
+	body.WriteString("</ul>")
+	fmt.Fprintf(&plain, "\nTo reinstate your membership please pay the outstanding amount of $%.2f.\n", c.Outstanding)
+	fmt.Fprintf(&body, "<p>To reinstate your membership please pay the outstanding amount of $%.2f.</p>", c.Outstanding)
+
+	return notification.Email{
+		FromName:     s.Name,
+		FromEmail:    s.Email,
+		ToName:       c.Member,
+		ToEmail:      c.Email,
+		Subject:      "Your membership has lapsed",
+		PlainContent: plain.String(),
+		HTMLContent:  body.String(),
+	}
+}
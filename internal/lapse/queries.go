@@ -0,0 +1,63 @@
+package lapse
+
+var queries = map[string]string{
+	"select-overdue-invoices": selectOverdueInvoices,
+	"select-member-financial": selectMemberFinancial,
+
+	"select-member-subscription":        selectMemberSubscription,
+	"update-member-subscription-active": updateMemberSubscriptionActive,
+}
+
+// unpaid invoices due before a cut-off date, for members without an active subscription, with the total of the
+// payments allocated to each
+const selectOverdueInvoices = `
+SELECT
+    i.id,
+    i.member_id,
+    CONCAT(m.first_name, ' ', m.last_name),
+    COALESCE(m.primary_email, ''),
+    COALESCE(i.invoiced_on, ''),
+    i.due_on,
+    i.invoice_total,
+    COALESCE(SUM(ip.amount), 0) AS allocated
+FROM
+    fn_m_invoice i
+        INNER JOIN
+    member m ON i.member_id = m.id
+        LEFT JOIN
+    fn_invoice_payment ip ON ip.fn_m_invoice_id = i.id AND ip.active = 1
+WHERE
+    i.active = 1 AND i.paid = 0 AND i.due_on < ?
+    AND NOT EXISTS (
+        SELECT 1 FROM fn_m_subscription ms WHERE ms.member_id = i.member_id AND ms.active = 1)
+GROUP BY i.id
+HAVING allocated < i.invoice_total
+ORDER BY i.member_id, i.due_on`
+
+// count of paid invoices for a billing period that includes a date
+const selectMemberFinancial = `
+SELECT
+    COUNT(*)
+FROM
+    fn_m_invoice i
+WHERE
+    i.active = 1 AND i.member_id = ? AND i.start_on <= ? AND i.end_on >= ?
+    AND (i.paid = 1 OR i.invoice_total <= (
+        SELECT COALESCE(SUM(ip.amount), 0) FROM fn_invoice_payment ip
+        WHERE ip.active = 1 AND ip.fn_m_invoice_id = i.id))`
+
+// a member subscription, with the subscription template id and name
+const selectMemberSubscription = `
+SELECT
+    s.id,
+    s.name,
+    ms.active
+FROM
+    fn_m_subscription ms
+        INNER JOIN
+    fn_subscription s ON ms.fn_subscription_id = s.id
+WHERE
+    ms.id = ? AND ms.member_id = ?`
+
+const updateMemberSubscriptionActive = `
+UPDATE fn_m_subscription SET active = 1, updated_at = NOW() WHERE id = ? AND member_id = ?`
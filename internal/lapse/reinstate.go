@@ -0,0 +1,147 @@
+package lapse
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cardiacsociety/web-services/internal/invoice"
+	"github.com/cardiacsociety/web-services/internal/issue"
+	"github.com/cardiacsociety/web-services/internal/member"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// issueTypeGeneralAdmin is the wf_issue_type used to follow up a reinstatement
+const issueTypeGeneralAdmin = 10000
+
+// defaultDueDays is the number of days after the issue date that a reinstatement invoice is due
+const defaultDueDays = 30
+
+// Reinstatement is a request to reverse the lapse (or resignation) of a member. SubscriptionID is the member
+// subscription (fn_m_subscription.id) to restore. If Invoice is set an invoice is raised for the restored
+// subscription, due DueDays after today.
+type Reinstatement struct {
+	MemberID       int    `json:"memberId"`
+	SubscriptionID int    `json:"subscriptionId"`
+	Invoice        bool   `json:"invoice"`
+	DueDays        int    `json:"dueDays"`
+	Reason         string `json:"reason"`
+}
+
+// Reinstated reports what was changed by a reinstatement. Changes is only set once all of the changes have been
+// made, as they are made in a single transaction.
+type Reinstated struct {
+	MemberID       int      `json:"memberId"`
+	StatusFrom     string   `json:"statusFrom"`
+	StatusTo       string   `json:"statusTo"`
+	SubscriptionID int      `json:"subscriptionId"`
+	Subscription   string   `json:"subscription"`
+	InvoiceID      int      `json:"invoiceId"`
+	InvoiceAmount  float64  `json:"invoiceAmount"`
+	IssueID        int      `json:"issueId"`
+	Changes        []string `json:"changes"`
+}
+
+// Reinstate reinstates a member. It sets a new current status of reinstated, restores the chosen subscription,
+// optionally raises an invoice for it, and raises an issue so the reinstatement is followed up. If any step fails
+// none of the changes are made.
+func Reinstate(ds datastore.Datastore, r Reinstatement) (Reinstated, error) {
+
+	rd := Reinstated{MemberID: r.MemberID, SubscriptionID: r.SubscriptionID}
+
+	if r.DueDays < 0 {
+		return rd, fmt.Errorf("due days cannot be negative")
+	}
+
+	tx, err := ds.MySQL.Session.Begin()
+	if err != nil {
+		return rd, err
+	}
+	defer tx.Rollback()
+
+	// check the subscription before changing anything
+	var templateID, active int
+	err = tx.QueryRow(queries["select-member-subscription"], r.SubscriptionID, r.MemberID).Scan(
+		&templateID, &rd.Subscription, &active)
+	if err == sql.ErrNoRows {
+		return rd, fmt.Errorf("member id %d does not have a subscription with id %d", r.MemberID, r.SubscriptionID)
+	}
+	if err != nil {
+		return rd, errors.Wrap(err, "select-member-subscription query error")
+	}
+
+	var changes []string
+
+	m := member.Member{ID: r.MemberID}
+	rd.StatusFrom, err = m.CurrentStatusTx(tx)
+	if err != nil {
+		return rd, err
+	}
+	err = m.ChangeStatusTx(tx, member.StatusChange{Status: member.StatusReinstated, Reason: r.Reason})
+	if err != nil {
+		return rd, err
+	}
+	rd.StatusTo = member.StatusReinstated
+	changes = append(changes, fmt.Sprintf("Status changed from %s to %s", rd.StatusFrom, rd.StatusTo))
+
+	if active == 0 {
+		_, err = tx.Exec(queries["update-member-subscription-active"], r.SubscriptionID, r.MemberID)
+		if err != nil {
+			return rd, errors.Wrap(err, "update-member-subscription-active query error")
+		}
+		changes = append(changes, fmt.Sprintf("Subscription %q (id %d) restored", rd.Subscription, r.SubscriptionID))
+	}
+
+	if r.Invoice {
+		days := r.DueDays
+		if days == 0 {
+			days = defaultDueDays
+		}
+		now := time.Now()
+		i, err := invoice.RaiseTx(tx, r.MemberID, templateID, now, now.AddDate(0, 0, days))
+		if err != nil {
+			return rd, errors.Wrap(err, "raise invoice")
+		}
+		rd.InvoiceID, rd.InvoiceAmount = i.ID, i.Amount
+		changes = append(changes, fmt.Sprintf("Invoice id %d raised for $%.2f, due %s",
+			i.ID, i.Amount, i.DueDate.Format("2006-01-02")))
+	}
+
+	iss := issue.Issue{
+		Type:        issue.Type{ID: issueTypeGeneralAdmin},
+		MemberID:    r.MemberID,
+		Description: reinstatedDescription(rd, r.Reason),
+		Action:      "Check the member's subscription, invoices and contact details are up to date.",
+	}
+	if rd.InvoiceID > 0 {
+		iss.Association, iss.AssociationID = "invoice", rd.InvoiceID
+	}
+	err = iss.InsertRowTx(tx)
+	if err != nil {
+		return rd, errors.Wrap(err, "raise issue")
+	}
+	changes = append(changes, fmt.Sprintf("Issue id %d raised for follow up", iss.ID))
+
+	err = tx.Commit()
+	if err != nil {
+		return rd, err
+	}
+	rd.IssueID = iss.ID
+	rd.Changes = changes
+
+	return rd, nil
+}
+
+// reinstatedDescription describes a reinstatement for the follow up issue
+func reinstatedDescription(rd Reinstated, reason string) string {
+	s := fmt.Sprintf("Member reinstated from %s, with subscription %q restored", rd.StatusFrom, rd.Subscription)
+	if rd.InvoiceID > 0 {
+		s += fmt.Sprintf(" and invoice id %d raised", rd.InvoiceID)
+	}
+	if reason != "" {
+		s += " - " + reason
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+package lapse
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+
+	"github.com/cardiacsociety/web-services/internal/platform/excel"
+)
+
+// ExcelReport returns an excel File for reviewing lapse candidates, with one row per overdue invoice
+func ExcelReport(candidates []Candidate) (*excelize.File, error) {
+
+	f := excel.New([]string{
+		"Member",
+		"Email",
+		"Status",
+		"Days overdue",
+		"Total outstanding",
+		"Invoice ID",
+		"Invoice date",
+		"Due date",
+		"Amount",
+		"Allocated",
+		"Outstanding",
+	})
+
+	for _, c := range candidates {
+
+		member := c.Member + " [" + strconv.Itoa(c.MemberID) + "]"
+
+		for _, i := range c.Invoices {
+			data := []interface{}{
+				member,
+				c.Email,
+				c.Status,
+				c.DaysOverdue,
+				c.Outstanding,
+				i.ID,
+				excelDate(i.IssueDate),
+				excelDate(i.DueDate),
+				i.Amount,
+				i.Allocated,
+				i.Outstanding,
+			}
+			err := f.AddRow(data)
+			if err != nil {
+				msg := fmt.Sprintf("AddRow() err = %s", err)
+				log.Printf(msg)
+				f.AddError(c.MemberID, msg)
+			}
+		}
+	}
+
+	// style
+	f.SetColWidthByHeading("Member", 30)
+	f.SetColWidthByHeading("Email", 30)
+	f.SetColStyleByHeading("Total outstanding", excel.CurrencyStyle)
+	f.SetColWidthByHeading("Total outstanding", 18)
+	f.SetColStyleByHeading("Invoice date", excel.DateStyle)
+	f.SetColWidthByHeading("Invoice date", 14)
+	f.SetColStyleByHeading("Due date", excel.DateStyle)
+	f.SetColWidthByHeading("Due date", 14)
+	f.SetColStyleByHeading("Amount", excel.CurrencyStyle)
+	f.SetColStyleByHeading("Allocated", excel.CurrencyStyle)
+	f.SetColStyleByHeading("Outstanding", excel.CurrencyStyle)
+
+	return f.XLSX, nil
+}
+
+// excelDate returns the date value for a cell, or an empty string if the date is bung
+func excelDate(s string) interface{} {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return ""
+	}
+	return d
+}
@@ -0,0 +1,370 @@
+package member
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+	"github.com/pkg/errors"
+)
+
+// Change set status values
+const (
+	ChangesPending  = "pending"
+	ChangesApproved = "approved"
+	ChangesRejected = "rejected"
+)
+
+// Changes are the profile changes submitted by a member. A nil field is left unchanged. Contacts replace the
+// member's contact location of the same type, while positions, qualifications and specialities replace the full
+// list, so a pointer to an empty list removes them all.
+type Changes struct {
+	Contacts       []ContactRow        `json:"contacts,omitempty" bson:"contacts,omitempty"`
+	Positions      *[]PositionRow      `json:"positions,omitempty" bson:"positions,omitempty"`
+	Qualifications *[]QualificationRow `json:"qualifications,omitempty" bson:"qualifications,omitempty"`
+	Specialities   *[]SpecialityRow    `json:"specialities,omitempty" bson:"specialities,omitempty"`
+	Directory      *bool               `json:"directory,omitempty" bson:"directory,omitempty"`
+	Consent        *bool               `json:"consent,omitempty" bson:"consent,omitempty"`
+}
+
+// ChangeSet is a set of profile changes awaiting review, or the record of a review, stored in MongoDB
+type ChangeSet struct {
+	OID        bson.ObjectId `json:"_id" bson:"_id"`
+	MemberID   int           `json:"memberId" bson:"memberId"`
+	CreatedAt  time.Time     `json:"createdAt" bson:"createdAt"`
+	Status     string        `json:"status" bson:"status"`
+	Changes    Changes       `json:"changes" bson:"changes"`
+	ReviewedAt time.Time     `json:"reviewedAt,omitempty" bson:"reviewedAt,omitempty"`
+	ReviewerID int           `json:"reviewerId,omitempty" bson:"reviewerId,omitempty"`
+	Comment    string        `json:"comment,omitempty" bson:"comment,omitempty"`
+}
+
+// Validate checks that there is at least one change, and that each row refers to a record
+func (c Changes) Validate() error {
+
+	if c.Contacts == nil && c.Positions == nil && c.Qualifications == nil && c.Specialities == nil &&
+		c.Directory == nil && c.Consent == nil {
+		return errors.New("no changes")
+	}
+
+	types := map[int]bool{}
+	for _, cr := range c.Contacts {
+		if cr.TypeID == 0 {
+			return errors.New("contact type id is required")
+		}
+		if types[cr.TypeID] {
+			return fmt.Errorf("more than one contact with type id %d", cr.TypeID)
+		}
+		types[cr.TypeID] = true
+	}
+	if c.Positions != nil {
+		for _, pr := range *c.Positions {
+			if pr.PositionID == 0 {
+				return errors.New("position id is required")
+			}
+		}
+	}
+	if c.Qualifications != nil {
+		for _, qr := range *c.Qualifications {
+			if qr.QualificationID == 0 {
+				return errors.New("qualification id is required")
+			}
+		}
+	}
+	if c.Specialities != nil {
+		for _, sr := range *c.Specialities {
+			if sr.SpecialityID == 0 {
+				return errors.New("speciality id is required")
+			}
+		}
+	}
+
+	return nil
+}
+
+// SubmitChanges validates the changes and saves them as a pending change set for the member
+func SubmitChanges(ds datastore.Datastore, memberID int, c Changes) (ChangeSet, error) {
+
+	cs := ChangeSet{
+		OID:       bson.NewObjectId(),
+		MemberID:  memberID,
+		CreatedAt: time.Now(),
+		Status:    ChangesPending,
+		Changes:   c,
+	}
+	if err := c.Validate(); err != nil {
+		return cs, err
+	}
+
+	col, err := ds.MongoDB.ChangesCol()
+	if err != nil {
+		return cs, errors.Wrap(err, "SubmitChanges could not get changes collection")
+	}
+	err = col.Insert(cs)
+	if err != nil {
+		return cs, errors.Wrap(err, "SubmitChanges insert error")
+	}
+
+	return cs, nil
+}
+
+// ApplyChanges validates the changes and applies them to the member record straight away, then records them as a
+// change set approved by the reviewer. The change set is only saved once the changes have been applied, so a
+// failed update does not leave a pending change set in the review queue.
+func ApplyChanges(ds datastore.Datastore, memberID int, c Changes, reviewerID int, comment string) (ChangeSet, error) {
+
+	now := time.Now()
+	cs := ChangeSet{
+		OID:        bson.NewObjectId(),
+		MemberID:   memberID,
+		CreatedAt:  now,
+		Status:     ChangesApproved,
+		Changes:    c,
+		ReviewedAt: now,
+		ReviewerID: reviewerID,
+		Comment:    comment,
+	}
+	if err := c.Validate(); err != nil {
+		return cs, err
+	}
+
+	err := c.apply(ds, memberID)
+	if err != nil {
+		return cs, errors.Wrap(err, "apply changes")
+	}
+
+	col, err := ds.MongoDB.ChangesCol()
+	if err != nil {
+		return cs, errors.Wrap(err, "ApplyChanges could not get changes collection")
+	}
+	err = col.Insert(cs)
+	if err != nil {
+		return cs, errors.Wrap(err, "ApplyChanges insert error")
+	}
+
+	m, err := ByID(ds, memberID)
+	if err != nil {
+		return cs, errors.Wrap(err, "fetch updated member")
+	}
+	err = m.SyncUpdated(ds)
+	if err != nil {
+		return cs, errors.Wrap(err, "sync updated member")
+	}
+
+	return cs, nil
+}
+
+// ChangeSetByID fetches a change set by its object id, in hex
+func ChangeSetByID(ds datastore.Datastore, oid string) (ChangeSet, error) {
+
+	var cs ChangeSet
+	if !bson.IsObjectIdHex(oid) {
+		return cs, fmt.Errorf("%q is not a valid change set id", oid)
+	}
+
+	col, err := ds.MongoDB.ChangesCol()
+	if err != nil {
+		return cs, errors.Wrap(err, "ChangeSetByID could not get changes collection")
+	}
+	err = col.FindId(bson.ObjectIdHex(oid)).One(&cs)
+	if err == mgo.ErrNotFound {
+		return cs, err
+	}
+	if err != nil {
+		return cs, errors.Wrap(err, "ChangeSetByID query error")
+	}
+
+	return cs, nil
+}
+
+// ChangeSets fetches change sets, oldest first, that match a query - eg bson.M{"status": "pending"}
+func ChangeSets(ds datastore.Datastore, query bson.M) ([]ChangeSet, error) {
+
+	var xcs []ChangeSet
+
+	col, err := ds.MongoDB.ChangesCol()
+	if err != nil {
+		return xcs, errors.Wrap(err, "ChangeSets could not get changes collection")
+	}
+	err = col.Find(query).Sort("createdAt").All(&xcs)
+	if err != nil {
+		return xcs, errors.Wrap(err, "ChangeSets query error")
+	}
+
+	return xcs, nil
+}
+
+// Approve applies a pending change set to the member record, syncs the member doc to MongoDB and records the
+// review. The change set is marked approved before the member record is changed, so that it cannot be applied
+// twice by concurrent approvals, and is returned to pending if the changes cannot be applied.
+func (cs *ChangeSet) Approve(ds datastore.Datastore, reviewerID int, comment string) error {
+
+	err := cs.review(ds, ChangesApproved, reviewerID, comment)
+	if err != nil {
+		return err
+	}
+
+	err = cs.Changes.apply(ds, cs.MemberID)
+	if err != nil {
+		if rerr := cs.unreview(ds); rerr != nil {
+			return errors.Wrapf(err, "apply changes (%s)", rerr)
+		}
+		return errors.Wrap(err, "apply changes")
+	}
+
+	m, err := ByID(ds, cs.MemberID)
+	if err != nil {
+		return errors.Wrap(err, "fetch updated member")
+	}
+	err = m.SyncUpdated(ds)
+	if err != nil {
+		return errors.Wrap(err, "sync updated member")
+	}
+
+	return nil
+}
+
+// Reject records the rejection of a pending change set, without changing the member record
+func (cs *ChangeSet) Reject(ds datastore.Datastore, reviewerID int, comment string) error {
+	return cs.review(ds, ChangesRejected, reviewerID, comment)
+}
+
+// review sets the outcome of the review, if the change set is still pending. The status is checked and updated in
+// a single operation so only one review can succeed.
+func (cs *ChangeSet) review(ds datastore.Datastore, status string, reviewerID int, comment string) error {
+
+	col, err := ds.MongoDB.ChangesCol()
+	if err != nil {
+		return errors.Wrap(err, "review could not get changes collection")
+	}
+
+	var xcs ChangeSet
+	_, err = col.Find(bson.M{"_id": cs.OID, "status": ChangesPending}).Apply(mgo.Change{
+		Update: bson.M{"$set": bson.M{
+			"status":     status,
+			"reviewedAt": time.Now(),
+			"reviewerId": reviewerID,
+			"comment":    comment,
+		}},
+		ReturnNew: true,
+	}, &xcs)
+	if err == mgo.ErrNotFound {
+		if err := col.FindId(cs.OID).One(&xcs); err != nil {
+			return errors.Wrap(err, "review find error")
+		}
+		return fmt.Errorf("change set is %s, only pending changes can be %s", xcs.Status, status)
+	}
+	if err != nil {
+		return errors.Wrap(err, "review update error")
+	}
+
+	*cs = xcs
+	return nil
+}
+
+// unreview returns a reviewed change set to pending
+func (cs *ChangeSet) unreview(ds datastore.Datastore) error {
+
+	col, err := ds.MongoDB.ChangesCol()
+	if err != nil {
+		return errors.Wrap(err, "unreview could not get changes collection")
+	}
+	err = col.UpdateId(cs.OID, bson.M{
+		"$set":   bson.M{"status": ChangesPending},
+		"$unset": bson.M{"reviewedAt": "", "reviewerId": "", "comment": ""},
+	})
+	if err != nil {
+		return errors.Wrap(err, "unreview update error")
+	}
+
+	cs.Status = ChangesPending
+	cs.ReviewedAt, cs.ReviewerID, cs.Comment = time.Time{}, 0, ""
+	return nil
+}
+
+// apply writes the changes to the member record in MySQL, and updates the member's updated_at so the change is
+// picked up by SyncUpdated. The changes are made in a single transaction, so a list is never left part replaced.
+func (c Changes) apply(ds datastore.Datastore, memberID int) error {
+
+	tx, err := ds.MySQL.Session.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = c.applyTx(tx, memberID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// applyTx writes the changes to the member record as part of a transaction
+func (c Changes) applyTx(tx *sql.Tx, memberID int) error {
+
+	for _, cr := range c.Contacts {
+		_, err := tx.Exec(queries["delete-member-contact-type"], memberID, cr.TypeID)
+		if err != nil {
+			return errors.Wrap(err, "delete-member-contact-type query error")
+		}
+		err = cr.insert(tx, memberID)
+		if err != nil {
+			return fmt.Errorf("insert contact err = %s", err)
+		}
+	}
+
+	if c.Positions != nil {
+		_, err := tx.Exec(queries["delete-member-positions"], memberID)
+		if err != nil {
+			return errors.Wrap(err, "delete-member-positions query error")
+		}
+		for _, pr := range *c.Positions {
+			if err := pr.insert(tx, memberID); err != nil {
+				return fmt.Errorf("insert position err = %s", err)
+			}
+		}
+	}
+
+	if c.Qualifications != nil {
+		_, err := tx.Exec(queries["delete-member-qualifications"], memberID)
+		if err != nil {
+			return errors.Wrap(err, "delete-member-qualifications query error")
+		}
+		for _, qr := range *c.Qualifications {
+			if err := qr.insert(tx, memberID); err != nil {
+				return fmt.Errorf("insert qualification err = %s", err)
+			}
+		}
+	}
+
+	if c.Specialities != nil {
+		_, err := tx.Exec(queries["delete-member-specialities"], memberID)
+		if err != nil {
+			return errors.Wrap(err, "delete-member-specialities query error")
+		}
+		for _, sr := range *c.Specialities {
+			if err := sr.insert(tx, memberID); err != nil {
+				return fmt.Errorf("insert speciality err = %s", err)
+			}
+		}
+	}
+
+	if c.Directory != nil || c.Consent != nil {
+		_, err := tx.Exec(queries["update-member-consent"], c.Directory, c.Consent, memberID)
+		if err != nil {
+			return errors.Wrap(err, "update-member-consent query error")
+		}
+	}
+
+	_, err := tx.Exec(queries["update-member-updated-at"], memberID)
+	if err != nil {
+		return errors.Wrap(err, "update-member-updated-at query error")
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package member_test
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+
+	"github.com/cardiacsociety/web-services/internal/member"
+)
+
+func TestChangesValidate(t *testing.T) {
+	consent := true
+	cases := []struct {
+		changes member.Changes
+		ok      bool
+	}{
+		{member.Changes{}, false},
+		{member.Changes{Consent: &consent}, true},
+		{member.Changes{Positions: &[]member.PositionRow{}}, true}, // remove all positions
+		{member.Changes{Contacts: []member.ContactRow{{TypeID: 1}, {TypeID: 2}}}, true},
+		{member.Changes{Contacts: []member.ContactRow{{TypeID: 1}, {TypeID: 1}}}, false},
+		{member.Changes{Contacts: []member.ContactRow{{Locality: "Sydney"}}}, false},
+		{member.Changes{Qualifications: &[]member.QualificationRow{{YearObtained: 1999}}}, false},
+		{member.Changes{Specialities: &[]member.SpecialityRow{{SpecialityID: 3}}}, true},
+	}
+	for _, c := range cases {
+		is := is.New(t)
+		err := c.changes.Validate()
+		is.Equal(err == nil, c.ok)
+	}
+}
@@ -757,22 +757,6 @@ func SearchDocDB(ds datastore.Datastore, query bson.M) ([]Member, error) {
 
 // Lapse will lapse a member by setting their status to 'lapsed' and
 // soft-deleting their subcription(s)
-func (m *Member)Lapse(ds datastore.Datastore) error {
-
-	// This creates new status of lapsed, and sets others to current = 0
-	sr := StatusRow{
-		StatusID: lapsedStatusID,
-		Current: true, 
-	}
-	if err := sr.insert(ds, m.ID); err != nil {
-		return err
-	}
-
-	// De-activate all financial subscriptions
-	_, err := ds.MySQL.Session.Exec(queries["update-member-deactivate-subscriptions"], m.ID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
\ No newline at end of file
+func (m *Member) Lapse(ds datastore.Datastore) error {
+	return m.ChangeStatus(ds, StatusChange{Status: StatusLapsed})
+}
@@ -1,10 +1,13 @@
 package member
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/cardiacsociety/web-services/internal/auth"
 	"github.com/cardiacsociety/web-services/internal/issue"
 	"github.com/cardiacsociety/web-services/internal/note"
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
@@ -124,19 +127,133 @@ type ContactRow struct {
 	CountryID int    `json:"countryId"`
 }
 
-// StatusRow represents a member's status record
+// StatusRow represents a member's status record. Effective is the date the status takes effect, format
+// "2006-01-02", and is stored as the created_at date of the record. It defaults to now.
 type StatusRow struct {
-	ID       int
-	MemberID int
-	StatusID int
-	Current  bool
-	Comment  string
+	ID        int
+	MemberID  int
+	StatusID  int
+	Current   bool
+	Comment   string
+	Effective string
 }
 
-// Insert inserts a member row into the database. If successful it will set the
-// member id.
+// ValidationError identifies the section of a Row that failed validation, eg "member", "qualifications" or
+// "contacts".
+type ValidationError struct {
+	Section string `json:"section"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Section, e.Message)
+}
+
+// Validate checks each section of the Row before anything is written to the database, and returns a
+// ValidationError for the first section that is not valid.
+func (r *Row) Validate() error {
+
+	switch {
+	case strings.TrimSpace(r.FirstName) == "":
+		return ValidationError{"member", "first name is required"}
+	case strings.TrimSpace(r.LastName) == "":
+		return ValidationError{"member", "last name is required"}
+	case strings.TrimSpace(r.Gender) == "":
+		return ValidationError{"member", "gender is required"}
+	case !strings.Contains(r.PrimaryEmail, "@"):
+		return ValidationError{"member", fmt.Sprintf("primary email %q is not valid", r.PrimaryEmail)}
+	case !validDate(r.DateOfBirth):
+		return ValidationError{"member", fmt.Sprintf("date of birth %q should be formatted as YYYY-MM-DD", r.DateOfBirth)}
+	}
+
+	for _, q := range r.Qualifications {
+		if q.QualificationID == 0 {
+			return ValidationError{"qualifications", "qualification id is required"}
+		}
+	}
+	for _, p := range r.Positions {
+		if p.PositionID == 0 {
+			return ValidationError{"positions", "position id is required"}
+		}
+		if !validDate(p.StartDate) || !validDate(p.EndDate) {
+			return ValidationError{"positions", "start and end dates should be formatted as YYYY-MM-DD"}
+		}
+	}
+	for _, s := range r.Specialities {
+		if s.SpecialityID == 0 {
+			return ValidationError{"interests", "speciality id is required"}
+		}
+	}
+	for _, a := range r.Accreditations {
+		if a.AccreditationID == 0 {
+			return ValidationError{"accreditations", "accreditation id is required"}
+		}
+		if !validDate(a.StartDate) || !validDate(a.EndDate) {
+			return ValidationError{"accreditations", "start and end dates should be formatted as YYYY-MM-DD"}
+		}
+	}
+	for _, t := range r.Tags {
+		if t.TagID == 0 {
+			return ValidationError{"tags", "tag id is required"}
+		}
+	}
+	for _, c := range r.Contacts {
+		if c.TypeID == 0 {
+			return ValidationError{"contacts", "contact type id is required"}
+		}
+	}
+
+	return nil
+}
+
+// validDate returns true if s is empty or a date formatted as YYYY-MM-DD
+func validDate(s string) bool {
+	if s == "" {
+		return true
+	}
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+// Insert validates the Row and inserts a member row, and the related rows, into the database in a single
+// transaction. If successful it will set the member id, otherwise nothing is written and the ids are not set.
 func (r *Row) Insert(ds datastore.Datastore) error {
 
+	err := r.Validate()
+	if err != nil {
+		return err
+	}
+
+	// get default description and action for the new application issue
+	issType, err := issue.TypeByID(ds, newApplicationIssueTypeID)
+	if err != nil {
+		return fmt.Errorf("issue.TypeByID() err = %s", err)
+	}
+
+	tx, err := ds.MySQL.Session.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = r.insert(tx, issType)
+	if err != nil {
+		r.ID, r.Application.ID, r.Application.FileNoteID = 0, 0, 0
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		r.ID, r.Application.ID, r.Application.FileNoteID = 0, 0, 0
+		return fmt.Errorf("Commit() err = %s", err)
+	}
+
+	return nil
+}
+
+// insert writes the member row and each section of related rows
+func (r *Row) insert(tx *sql.Tx, issType issue.Type) error {
+
 	// convert bools to 0/1
 	var consentDirectory, consentContact int
 	if r.ConsentDirectory {
@@ -149,7 +266,17 @@ func (r *Row) Insert(ds datastore.Datastore) error {
 	// gender stored as 'M' or 'F', so capitalise first letter of gender string
 	r.Gender = strings.ToUpper(string(strings.TrimSpace(r.Gender)[0]))
 
-	res, err := ds.MySQL.Session.Exec(queries["insert-member-row"],
+	// the initial password is random and not known to anyone, so the member must set their own
+	p, err := auth.RandomPassword()
+	if err != nil {
+		return fmt.Errorf("RandomPassword() err = %s", err)
+	}
+	hash, err := auth.HashPassword(p)
+	if err != nil {
+		return fmt.Errorf("HashPassword() err = %s", err)
+	}
+
+	res, err := tx.Exec(queries["insert-member-row"],
 		r.RoleID,
 		r.NamePrefixID,
 		r.CountryID,
@@ -162,7 +289,8 @@ func (r *Row) Insert(ds datastore.Datastore) error {
 		r.LastName,
 		r.PostNominal,
 		r.Mobile,
-		r.PrimaryEmail)
+		r.PrimaryEmail,
+		hash)
 	if err != nil {
 		return err
 	}
@@ -172,47 +300,47 @@ func (r *Row) Insert(ds datastore.Datastore) error {
 	}
 	r.ID = int(id) // from int64
 
-	err = r.insertQualifications(ds)
+	err = r.insertQualifications(tx)
 	if err != nil {
 		return fmt.Errorf("insertQualifications() err = %s", err)
 	}
 
-	err = r.insertPositions(ds)
+	err = r.insertPositions(tx)
 	if err != nil {
 		return fmt.Errorf("insertPositions() err = %s", err)
 	}
 
-	err = r.insertSpecialities(ds)
+	err = r.insertSpecialities(tx)
 	if err != nil {
 		return fmt.Errorf("insertSpecialities() err = %s", err)
 	}
 
-	err = r.insertAccreditations(ds)
+	err = r.insertAccreditations(tx)
 	if err != nil {
 		return fmt.Errorf("insertAccreditations() err = %s", err)
 	}
 
-	err = r.insertTags(ds)
+	err = r.insertTags(tx)
 	if err != nil {
 		return fmt.Errorf("insertTags() err = %s", err)
 	}
 
-	err = r.insertContacts(ds)
+	err = r.insertContacts(tx)
 	if err != nil {
 		return fmt.Errorf("insertContacts() err = %s", err)
 	}
 
-	err = r.insertApplication(ds)
+	err = r.insertApplication(tx)
 	if err != nil {
 		return fmt.Errorf("insertApplication() err = %s", err)
 	}
 
-	err = r.insertFileNote(ds)
+	err = r.insertFileNote(tx)
 	if err != nil {
 		return fmt.Errorf("insertFileNote() err = %s", err)
 	}
 
-	err = r.insertIssue(ds)
+	err = r.insertIssue(tx, issType)
 	if err != nil {
 		return fmt.Errorf("insertIssue() err = %s", err)
 	}
@@ -221,9 +349,9 @@ func (r *Row) Insert(ds datastore.Datastore) error {
 }
 
 // insertQualifications inserts the member qualifications present in the Row value
-func (r *Row) insertQualifications(ds datastore.Datastore) error {
+func (r *Row) insertQualifications(tx *sql.Tx) error {
 	for _, q := range r.Qualifications {
-		err := q.insert(ds, r.ID)
+		err := q.insert(tx, r.ID)
 		if err != nil {
 			return err
 		}
@@ -232,9 +360,9 @@ func (r *Row) insertQualifications(ds datastore.Datastore) error {
 }
 
 // insertPositions inserts the member positions present in the Row value
-func (r *Row) insertPositions(ds datastore.Datastore) error {
+func (r *Row) insertPositions(tx *sql.Tx) error {
 	for _, p := range r.Positions {
-		err := p.insert(ds, r.ID)
+		err := p.insert(tx, r.ID)
 		if err != nil {
 			return err
 		}
@@ -243,9 +371,9 @@ func (r *Row) insertPositions(ds datastore.Datastore) error {
 }
 
 // insertSpecialities inserts the member specialities present in the Row value
-func (r *Row) insertSpecialities(ds datastore.Datastore) error {
+func (r *Row) insertSpecialities(tx *sql.Tx) error {
 	for _, s := range r.Specialities {
-		err := s.insert(ds, r.ID)
+		err := s.insert(tx, r.ID)
 		if err != nil {
 			return err
 		}
@@ -254,9 +382,9 @@ func (r *Row) insertSpecialities(ds datastore.Datastore) error {
 }
 
 // insertAccreditations inserts the member accreditations present in the Row value
-func (r *Row) insertAccreditations(ds datastore.Datastore) error {
+func (r *Row) insertAccreditations(tx *sql.Tx) error {
 	for _, a := range r.Accreditations {
-		err := a.insert(ds, r.ID)
+		err := a.insert(tx, r.ID)
 		if err != nil {
 			return err
 		}
@@ -265,9 +393,9 @@ func (r *Row) insertAccreditations(ds datastore.Datastore) error {
 }
 
 // insertTags inserts the member tags present in the Row value
-func (r *Row) insertTags(ds datastore.Datastore) error {
+func (r *Row) insertTags(tx *sql.Tx) error {
 	for _, t := range r.Tags {
-		err := t.insert(ds, r.ID)
+		err := t.insert(tx, r.ID)
 		if err != nil {
 			return err
 		}
@@ -277,8 +405,8 @@ func (r *Row) insertTags(ds datastore.Datastore) error {
 
 // insertApplication creates an application record for the member and sets the
 // Application ID on success.
-func (r *Row) insertApplication(ds datastore.Datastore) error {
-	id, err := r.Application.insert(ds, r.ID)
+func (r *Row) insertApplication(tx *sql.Tx) error {
+	id, err := r.Application.insert(tx, r.ID)
 	if err != nil {
 		return err
 	}
@@ -287,9 +415,9 @@ func (r *Row) insertApplication(ds datastore.Datastore) error {
 }
 
 // insertContacts inserts the member contact rows
-func (r *Row) insertContacts(ds datastore.Datastore) error {
+func (r *Row) insertContacts(tx *sql.Tx) error {
 	for _, c := range r.Contacts {
-		err := c.insert(ds, r.ID)
+		err := c.insert(tx, r.ID)
 		if err != nil {
 			return err
 		}
@@ -299,7 +427,7 @@ func (r *Row) insertContacts(ds datastore.Datastore) error {
 
 // insertFileNote creates a note record associated with this member id and sets
 // the Application.FileNoteID on success.
-func (r *Row) insertFileNote(ds datastore.Datastore) error {
+func (r *Row) insertFileNote(tx *sql.Tx) error {
 
 	// Empty note content will return an error, so ensure it has a value
 	if r.Application.FileNote == "" {
@@ -313,7 +441,7 @@ func (r *Row) insertFileNote(ds datastore.Datastore) error {
 	}
 
 	// noteInsertRow will set note.ID
-	err := n.InsertRow(ds)
+	err := n.InsertRowTx(tx)
 	if err != nil {
 		return err
 	}
@@ -323,26 +451,19 @@ func (r *Row) insertFileNote(ds datastore.Datastore) error {
 
 // insertIssue raises an issue, of the appropriate type, relating to the new
 // application
-func (r *Row) insertIssue(ds datastore.Datastore) error {
-
-	// get default deescription and action for the issue type
-	issType, err := issue.TypeByID(ds, newApplicationIssueTypeID)
-	if err != nil {
-		return err
-	}
-
+func (r *Row) insertIssue(tx *sql.Tx, issType issue.Type) error {
 	i := issue.Issue{
 		Type:        issue.Type{ID: newApplicationIssueTypeID},
 		MemberID:    r.ID,
 		Description: issType.Description,
 		Action:      issType.Action,
 	}
-	return i.InsertRow(ds)
+	return i.InsertRowTx(tx)
 }
 
 // insert a member qualification row in the junction table
-func (qr QualificationRow) insert(ds datastore.Datastore, memberID int) error {
-	_, err := ds.MySQL.Session.Exec(queries["insert-member-qualification-row"],
+func (qr QualificationRow) insert(e datastore.Execer, memberID int) error {
+	_, err := e.Exec(queries["insert-member-qualification-row"],
 		memberID,
 		qr.QualificationID,
 		qr.OrganisationID,
@@ -353,8 +474,8 @@ func (qr QualificationRow) insert(ds datastore.Datastore, memberID int) error {
 }
 
 // insert a member position row in the junction table
-func (pr PositionRow) insert(ds datastore.Datastore, memberID int) error {
-	_, err := ds.MySQL.Session.Exec(queries["insert-member-position-row"],
+func (pr PositionRow) insert(e datastore.Execer, memberID int) error {
+	_, err := e.Exec(queries["insert-member-position-row"],
 		memberID,
 		pr.PositionID,
 		pr.OrganisationID,
@@ -363,8 +484,8 @@ func (pr PositionRow) insert(ds datastore.Datastore, memberID int) error {
 }
 
 // insert a member speciality row in the junction table
-func (sr SpecialityRow) insert(ds datastore.Datastore, memberID int) error {
-	_, err := ds.MySQL.Session.Exec(queries["insert-member-speciality-row"],
+func (sr SpecialityRow) insert(e datastore.Execer, memberID int) error {
+	_, err := e.Exec(queries["insert-member-speciality-row"],
 		memberID,
 		sr.SpecialityID,
 		sr.Preference,
@@ -373,8 +494,8 @@ func (sr SpecialityRow) insert(ds datastore.Datastore, memberID int) error {
 }
 
 // insert a member accreditation row in the junction table
-func (ar AccreditationRow) insert(ds datastore.Datastore, memberID int) error {
-	_, err := ds.MySQL.Session.Exec(queries["insert-member-accreditation-row"],
+func (ar AccreditationRow) insert(e datastore.Execer, memberID int) error {
+	_, err := e.Exec(queries["insert-member-accreditation-row"],
 		memberID,
 		ar.AccreditationID,
 		ar.StartDate,
@@ -384,16 +505,16 @@ func (ar AccreditationRow) insert(ds datastore.Datastore, memberID int) error {
 }
 
 // insert a member tag row in the junction table
-func (tr TagRow) insert(ds datastore.Datastore, memberID int) error {
-	_, err := ds.MySQL.Session.Exec(queries["insert-member-tag-row"],
+func (tr TagRow) insert(e datastore.Execer, memberID int) error {
+	_, err := e.Exec(queries["insert-member-tag-row"],
 		memberID,
 		tr.TagID)
 	return err
 }
 
 // insert methods creates a new application record, returns id on success
-func (ar ApplicationRow) insert(ds datastore.Datastore, memberID int) (int, error) {
-	res, err := ds.MySQL.Session.Exec(queries["insert-member-application-row"],
+func (ar ApplicationRow) insert(e datastore.Execer, memberID int) (int, error) {
+	res, err := e.Exec(queries["insert-member-application-row"],
 		memberID,
 		ar.NominatorID,
 		ar.SeconderID,
@@ -406,8 +527,8 @@ func (ar ApplicationRow) insert(ds datastore.Datastore, memberID int) (int, erro
 	return int(id), err
 }
 
-func (cr ContactRow) insert(ds datastore.Datastore, memberID int) error {
-	_, err := ds.MySQL.Session.Exec(queries["insert-member-contact-row"],
+func (cr ContactRow) insert(e datastore.Execer, memberID int) error {
+	_, err := e.Exec(queries["insert-member-contact-row"],
 		memberID,
 		cr.TypeID,
 		cr.CountryID,
@@ -427,7 +548,7 @@ func (cr ContactRow) insert(ds datastore.Datastore, memberID int) error {
 
 // insert a member status row and, if it is set to current, ensure it is the
 // only record with current = 1
-func (sr StatusRow) insert(ds datastore.Datastore, memberID int) error {
+func (sr StatusRow) insert(e datastore.Execer, memberID int) error {
 
 	sr.MemberID = memberID
 
@@ -436,10 +557,11 @@ func (sr StatusRow) insert(ds datastore.Datastore, memberID int) error {
 	if sr.Current {
 		current = 1
 	}
-	res, err := ds.MySQL.Session.Exec(queries["insert-member-status-row"],
+	res, err := e.Exec(queries["insert-member-status-row"],
 		memberID,
 		sr.StatusID,
 		current,
+		sr.Effective,
 		sr.Comment,
 	)
 	if err != nil {
@@ -455,7 +577,7 @@ func (sr StatusRow) insert(ds datastore.Datastore, memberID int) error {
 	// If true also need to set current = 0 for all other status
 	// records for the member - can only have one status at a time.
 	if sr.Current {
-		_, err := ds.MySQL.Session.Exec(queries["update-member-current-status"], sr.ID, memberID)
+		_, err := e.Exec(queries["update-member-current-status"], sr.ID, memberID)
 		if err != nil {
 			return err
 		}
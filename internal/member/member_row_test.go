@@ -24,6 +24,7 @@ func TestMemberRow(t *testing.T) {
 	t.Run("member_row", func(t *testing.T) {
 		t.Run("testInsertRow", testInsertRow)
 		t.Run("testInsertRowJSON", testInsertRowJSON)
+		t.Run("testInsertRowInvalid", testInsertRowInvalid)
 	})
 }
 
@@ -375,3 +376,59 @@ func testInsertRowJSON(t *testing.T) {
 		t.Errorf("note.ByMemberID() count = %d, want %d", got, want)
 	}
 }
+
+// testInsertRowInvalid tests that nothing is written when a section fails validation
+func testInsertRowInvalid(t *testing.T) {
+	m := member.Row{
+		Gender:       "F",
+		FirstName:    "Jane",
+		LastName:     "Citizen",
+		PrimaryEmail: "jane@citizen.com",
+		Contacts:     []member.ContactRow{{Locality: "Sydney"}},
+	}
+	err := m.Insert(ds2)
+	ve, ok := err.(member.ValidationError)
+	if !ok {
+		t.Fatalf("member.Row.Insert() err = %v, want ValidationError", err)
+	}
+	if ve.Section != "contacts" {
+		t.Errorf("ValidationError.Section = %q, want %q", ve.Section, "contacts")
+	}
+	if m.ID != 0 {
+		t.Errorf("member.Row.ID = %d, want 0", m.ID)
+	}
+}
+
+func TestRowValidate(t *testing.T) {
+	valid := func() member.Row {
+		return member.Row{Gender: "Male", FirstName: "Mike", LastName: "Donnici", PrimaryEmail: "mike@here.com"}
+	}
+	cases := []struct {
+		change  func(r *member.Row)
+		section string // empty if valid
+	}{
+		{func(r *member.Row) {}, ""},
+		{func(r *member.Row) { r.Gender = "" }, "member"},
+		{func(r *member.Row) { r.PrimaryEmail = "mike" }, "member"},
+		{func(r *member.Row) { r.DateOfBirth = "03/11/1970" }, "member"},
+		{func(r *member.Row) { r.Qualifications = []member.QualificationRow{{YearObtained: 1992}} }, "qualifications"},
+		{func(r *member.Row) { r.Positions = []member.PositionRow{{PositionID: 1, StartDate: "2019"}} }, "positions"},
+		{func(r *member.Row) { r.Specialities = []member.SpecialityRow{{Preference: 1}} }, "interests"},
+		{func(r *member.Row) { r.Tags = []member.TagRow{{}} }, "tags"},
+		{func(r *member.Row) { r.Contacts = []member.ContactRow{{TypeID: 1}} }, ""},
+	}
+	for i, c := range cases {
+		r := valid()
+		c.change(&r)
+		err := r.Validate()
+		var got string
+		if ve, ok := err.(member.ValidationError); ok {
+			got = ve.Section
+		} else if err != nil {
+			t.Errorf("case %d: Row.Validate() err = %v, want ValidationError", i, err)
+		}
+		if got != c.section {
+			t.Errorf("case %d: Row.Validate() section = %q, want %q", i, got, c.section)
+		}
+	}
+}
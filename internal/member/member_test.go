@@ -1,12 +1,14 @@
 package member_test
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"testing"
 	"time"
 
+	"github.com/cardiacsociety/web-services/internal/auth"
 	"github.com/cardiacsociety/web-services/internal/member"
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
 	"github.com/cardiacsociety/web-services/testdata"
@@ -37,6 +39,11 @@ func TestMember(t *testing.T) {
 		t.Run("testExcelReport", testExcelReport)
 		t.Run("testExcelReportJournal", testExcelReportJournal)
 		t.Run("testLapse", testLapse)
+		t.Run("testChangeStatus", testChangeStatus)
+		t.Run("testChangeSetApprove", testChangeSetApprove)
+		t.Run("testChangeSetReject", testChangeSetReject)
+		t.Run("testApplyChanges", testApplyChanges)
+		t.Run("testDuplicatesMerge", testDuplicatesMerge)
 	})
 }
 
@@ -209,6 +216,173 @@ func testLapse(t *testing.T) {
 	}
 }
 
+// member 1 was lapsed by testLapse
+func testChangeStatus(t *testing.T) {
+	is := is.New(t)
+	m, err := member.ByID(ds, 1)
+	is.NoErr(err)
+
+	s, err := m.CurrentStatus(ds)
+	is.NoErr(err)
+	is.Equal(s, member.StatusLapsed)
+
+	err = m.ChangeStatus(ds, member.StatusChange{Status: member.StatusActive})
+	is.True(err != nil) // lapsed member must be reinstated
+
+	// back-date the lapse, so a reinstatement can be back-dated, but not to before the lapse
+	_, err = ds.MySQL.Session.Exec(`UPDATE ms_m_status SET created_at = '2019-01-01' WHERE member_id = 1 AND current = 1`)
+	is.NoErr(err)
+	err = m.ChangeStatus(ds, member.StatusChange{Status: member.StatusReinstated, Effective: "2018-12-31", Reason: "Paid"})
+	is.True(err != nil) // effective before the current status
+
+	err = m.ChangeStatus(ds, member.StatusChange{Status: member.StatusReinstated, Effective: "2019-01-15", Reason: "Paid"})
+	is.NoErr(err)
+	s, err = m.CurrentStatus(ds)
+	is.NoErr(err)
+	is.Equal(s, member.StatusReinstated)
+
+	// the backdated status is recorded from the effective date, as that is used to pro-rate CPD
+	var d string
+	err = ds.MySQL.Session.QueryRow(`SELECT DATE_FORMAT(created_at, '%Y-%m-%d') FROM ms_m_status
+		WHERE member_id = 1 AND current = 1`).Scan(&d)
+	is.NoErr(err)
+	is.Equal(d, "2019-01-15")
+}
+
+func testChangeSetApprove(t *testing.T) {
+	is := is.New(t)
+	directory := false
+	c := member.Changes{
+		Contacts:       []member.ContactRow{{TypeID: 2, Locality: "Wollongong", State: "NSW", Postcode: "2500", CountryID: 14}},
+		Qualifications: &[]member.QualificationRow{{QualificationID: 2, YearObtained: 1995}},
+		Directory:      &directory,
+	}
+	cs, err := member.SubmitChanges(ds, 1, c)
+	is.NoErr(err)
+	is.Equal(cs.Status, member.ChangesPending)
+
+	xcs, err := member.ChangeSets(ds, bson.M{"memberId": 1, "status": member.ChangesPending})
+	is.NoErr(err)
+	is.Equal(len(xcs), 1)
+
+	err = xcs[0].Approve(ds, 2, "Checked")
+	is.NoErr(err)
+	is.Equal(xcs[0].Status, member.ChangesApproved)
+
+	m, err := member.ByID(ds, 1)
+	is.NoErr(err)
+	is.Equal(len(m.Qualifications), 1)
+	is.Equal(m.Qualifications[0].Code, "MBBS")
+	is.Equal(m.Contact.Directory, false)
+	l, err := m.ContactLocationByDesc("Directory")
+	is.NoErr(err)
+	is.Equal(l.City, "Wollongong")
+
+	err = xcs[0].Approve(ds, 2, "")
+	is.True(err != nil) // already approved
+
+	err = cs.Approve(ds, 2, "")
+	is.True(err != nil) // a stale copy that is still pending in memory cannot be approved again
+}
+
+func testChangeSetReject(t *testing.T) {
+	is := is.New(t)
+	c := member.Changes{Specialities: &[]member.SpecialityRow{}}
+	cs, err := member.SubmitChanges(ds, 1, c)
+	is.NoErr(err)
+
+	err = cs.Reject(ds, 2, "Specialities are required")
+	is.NoErr(err)
+
+	cs, err = member.ChangeSetByID(ds, cs.OID.Hex())
+	is.NoErr(err)
+	is.Equal(cs.Status, member.ChangesRejected)
+	is.Equal(cs.Comment, "Specialities are required")
+
+	m, err := member.ByID(ds, 1)
+	is.NoErr(err)
+	is.Equal(len(m.Specialities), 2) // unchanged
+}
+
+func testApplyChanges(t *testing.T) {
+	is := is.New(t)
+	consent := true
+	cs, err := member.ApplyChanges(ds, 1, member.Changes{Consent: &consent}, 2, "Updated by admin")
+	is.NoErr(err)
+	is.Equal(cs.Status, member.ChangesApproved)
+
+	cs, err = member.ChangeSetByID(ds, cs.OID.Hex())
+	is.NoErr(err)
+	is.Equal(cs.Status, member.ChangesApproved)
+	is.Equal(cs.ReviewerID, 2)
+
+	xcs, err := member.ChangeSets(ds, bson.M{"memberId": 1, "status": member.ChangesPending})
+	is.NoErr(err)
+	_, err = member.ApplyChanges(ds, 1, member.Changes{Positions: &[]member.PositionRow{{}}}, 2, "")
+	is.True(err != nil) // position id is required
+	xcs2, err := member.ChangeSets(ds, bson.M{"memberId": 1, "status": member.ChangesPending})
+	is.NoErr(err)
+	is.Equal(len(xcs2), len(xcs)) // no pending change set left behind
+}
+
+func testDuplicatesMerge(t *testing.T) {
+	is := is.New(t)
+	r := member.Row{
+		RoleID:       2,
+		CountryID:    14,
+		DateOfBirth:  "1970-11-03",
+		Gender:       "M",
+		FirstName:    "michael",
+		LastName:     "Donnici",
+		PrimaryEmail: "mike@example.com",
+		Qualifications: []member.QualificationRow{
+			{QualificationID: 2, YearObtained: 1995}, // survivor already has this one
+			{QualificationID: 5, YearObtained: 2001},
+		},
+	}
+	err := r.Insert(ds)
+	is.NoErr(err)
+
+	xd, err := member.Duplicates(ds, r.ID)
+	is.NoErr(err)
+	is.Equal(len(xd), 1)
+	is.Equal(xd[0].MemberID, 1)
+	is.Equal(xd[0].DuplicateID, r.ID)
+	is.Equal(xd[0].Match, "name and date of birth")
+
+	// the duplicate can log in until it is merged
+	hash, err := auth.HashPassword("duplicatePassword")
+	is.NoErr(err)
+	_, err = ds.MySQL.Session.Exec("UPDATE member SET password = ? WHERE id = ?", hash, r.ID)
+	is.NoErr(err)
+	_, _, err = auth.AuthMember(ds, "mike@example.com", "duplicatePassword")
+	is.NoErr(err)
+	_, rt, err := auth.NewRefresh(ds, r.ID, "michael Donnici", "member", time.Hour)
+	is.NoErr(err)
+
+	mr, err := member.Merge(ds, 1, r.ID)
+	is.NoErr(err)
+	is.Equal(mr.Qualifications, int64(1))
+	is.True(mr.Notes > 0)  // application file note
+	is.True(mr.Issues > 0) // new application issue
+
+	m, err := member.ByID(ds, 1)
+	is.NoErr(err)
+	is.Equal(len(m.Qualifications), 2)
+
+	xd, err = member.Duplicates(ds, r.ID)
+	is.NoErr(err)
+	is.Equal(len(xd), 0) // duplicate is no longer active
+
+	_, _, err = auth.AuthMember(ds, "mike@example.com", "duplicatePassword")
+	is.Equal(err, sql.ErrNoRows) // merged duplicate cannot log in
+	_, _, err = auth.RotateRefresh(ds, rt)
+	is.Equal(err, auth.ErrInvalidRefresh)
+
+	_, err = member.Merge(ds, 1, r.ID)
+	is.True(err != nil) // already merged
+}
+
 func printJSON(m member.Member) {
 	xb, _ := json.MarshalIndent(m, "", "  ")
 	fmt.Println("-------------------------------------------------------------------")
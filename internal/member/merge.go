@@ -0,0 +1,179 @@
+package member
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+
+	"github.com/cardiacsociety/web-services/internal/auth"
+	"github.com/cardiacsociety/web-services/internal/note"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// Duplicate is a pair of active member records that appear to be the same person. Match is the reason, either
+// "email" or "name and date of birth".
+type Duplicate struct {
+	MemberID       int    `json:"memberId"`
+	Member         string `json:"member"`
+	Email          string `json:"email"`
+	DuplicateID    int    `json:"duplicateId"`
+	Duplicate      string `json:"duplicate"`
+	DuplicateEmail string `json:"duplicateEmail"`
+	Match          string `json:"match"`
+}
+
+// Merged reports the number of records moved from the duplicate to the survivor by a merge
+type Merged struct {
+	SurvivorID     int   `json:"survivorId"`
+	DuplicateID    int   `json:"duplicateId"`
+	Activities     int64 `json:"activities"`
+	Notes          int64 `json:"notes"`
+	Issues         int64 `json:"issues"`
+	Invoices       int64 `json:"invoices"`
+	Payments       int64 `json:"payments"`
+	Positions      int64 `json:"positions"`
+	Qualifications int64 `json:"qualifications"`
+}
+
+// Duplicates returns pairs of active members that share an email address, or have the same name and date of
+// birth. If memberID is not 0 only the pairs that include that member are returned.
+func Duplicates(ds datastore.Datastore, memberID int) ([]Duplicate, error) {
+
+	var xd []Duplicate
+
+	rows, err := ds.MySQL.Session.Query(queries["select-member-duplicates"], memberID, memberID)
+	if err != nil {
+		return nil, errors.Wrap(err, "select-member-duplicates query error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Duplicate
+		err := rows.Scan(&d.MemberID, &d.Member, &d.Email, &d.DuplicateID, &d.Duplicate, &d.DuplicateEmail, &d.Match)
+		if err != nil {
+			return nil, errors.Wrap(err, "select-member-duplicates scan error")
+		}
+		xd = append(xd, d)
+	}
+
+	return xd, rows.Err()
+}
+
+// Merge moves the CPD activities, notes, issues, invoices, payments, positions and qualifications of the duplicate
+// member to the survivor, in a single transaction, and soft-deletes the duplicate. Positions and qualifications
+// that the survivor already has are not moved. A note is added to the survivor, the survivor doc is re-synced and
+// the duplicate doc is removed from MongoDB.
+func Merge(ds datastore.Datastore, survivorID, duplicateID int) (Merged, error) {
+
+	mr := Merged{SurvivorID: survivorID, DuplicateID: duplicateID}
+
+	if survivorID == duplicateID {
+		return mr, errors.New("cannot merge a member with themselves")
+	}
+	// counts are only reported once the transaction is committed. The survivor id is passed again to the positions
+	// and qualifications queries to exclude the ones they already have.
+	moved := mr
+	ids := []interface{}{survivorID, duplicateID}
+	moves := []struct {
+		query string
+		args  []interface{}
+		n     *int64
+	}{
+		{"merge-member-activities", ids, &moved.Activities},
+		{"merge-member-notes", ids, &moved.Notes},
+		{"merge-member-issues", ids, &moved.Issues},
+		{"merge-member-invoices", ids, &moved.Invoices},
+		{"merge-member-payments", ids, &moved.Payments},
+		{"merge-member-positions", append(ids, survivorID), &moved.Positions},
+		{"merge-member-qualifications", append(ids, survivorID), &moved.Qualifications},
+	}
+
+	tx, err := ds.MySQL.Session.Begin()
+	if err != nil {
+		return mr, err
+	}
+	defer tx.Rollback()
+
+	// both member rows are locked, lowest id first, so neither can be merged or deactivated by another request
+	// before this one commits
+	lock := []int{survivorID, duplicateID}
+	if duplicateID < survivorID {
+		lock = []int{duplicateID, survivorID}
+	}
+	for _, id := range lock {
+		var active bool
+		err := tx.QueryRow(queries["select-member-active"], id).Scan(&active)
+		if err == sql.ErrNoRows {
+			return mr, fmt.Errorf("member id %d not found", id)
+		}
+		if err != nil {
+			return mr, errors.Wrap(err, "select-member-active query error")
+		}
+		if !active {
+			return mr, fmt.Errorf("member id %d is not active", id)
+		}
+	}
+
+	for _, mv := range moves {
+		res, err := tx.Exec(queries[mv.query], mv.args...)
+		if err != nil {
+			return mr, errors.Wrap(err, mv.query+" query error")
+		}
+		*mv.n, err = res.RowsAffected()
+		if err != nil {
+			return mr, err
+		}
+	}
+	if _, err := tx.Exec(queries["update-member-merged"], duplicateID); err != nil {
+		return mr, errors.Wrap(err, "update-member-merged query error")
+	}
+	if _, err := tx.Exec(queries["update-member-updated-at"], survivorID); err != nil {
+		return mr, errors.Wrap(err, "update-member-updated-at query error")
+	}
+	if err := tx.Commit(); err != nil {
+		return mr, errors.Wrap(err, "merge commit")
+	}
+	mr = moved
+
+	// the duplicate can no longer log in, so also revoke any tokens it was issued
+	if err := auth.RevokeUser(ds, duplicateID, "member"); err != nil {
+		return mr, errors.Wrap(err, "revoke duplicate tokens")
+	}
+
+	n := note.Note{
+		MemberID: survivorID,
+		TypeID:   noteTypeHistory,
+		Content:  mergeNoteContent(mr),
+	}
+	if err := n.InsertRow(ds); err != nil {
+		return mr, errors.Wrap(err, "merge note")
+	}
+
+	m, err := ByID(ds, survivorID)
+	if err != nil {
+		return mr, errors.Wrap(err, "fetch survivor")
+	}
+	if err := m.SyncUpdated(ds); err != nil {
+		return mr, errors.Wrap(err, "sync survivor")
+	}
+
+	mc, err := ds.MongoDB.MembersCollection()
+	if err != nil {
+		return mr, errors.Wrap(err, "Merge could not get member collection")
+	}
+	err = mc.Remove(map[string]int{"id": duplicateID})
+	if err != nil && err != mgo.ErrNotFound {
+		return mr, errors.Wrap(err, "remove duplicate doc")
+	}
+
+	return mr, nil
+}
+
+// mergeNoteContent describes a merge for the survivor's member note
+func mergeNoteContent(mr Merged) string {
+	return fmt.Sprintf("Duplicate member id %d merged into this record - moved %d activities, %d notes, %d issues, "+
+		"%d invoices, %d payments, %d positions and %d qualifications", mr.DuplicateID, mr.Activities, mr.Notes,
+		mr.Issues, mr.Invoices, mr.Payments, mr.Positions, mr.Qualifications)
+}
@@ -18,6 +18,8 @@ var queries = map[string]string{
 	"select-membership-title-history":        selectMembershipTitleHistory,
 	"select-membership-status":               selectMembershipStatus,
 	"select-membership-status-history":       selectMembershipStatusHistory,
+	"select-member-current-status-id":        selectMemberCurrentStatusID,
+	"select-member-current-status-date":      selectMemberCurrentStatusDate,
 	"select-member-qualifications":           selectMemberQualifications,
 	"select-member-accreditations":           selectMemberAccreditations,
 	"select-member-positions":                selectMemberPositions,
@@ -25,6 +27,22 @@ var queries = map[string]string{
 	"select-member-tags":                     selectMemberTags,
 	"update-member-current-status":           updateMemberCurrentStatus,
 	"update-member-deactivate-subscriptions": updateMemberDeactivateSubscriptions,
+	"update-member-consent":                  updateMemberConsent,
+	"update-member-updated-at":               updateMemberUpdatedAt,
+	"delete-member-contact-type":             deleteMemberContactType,
+	"delete-member-positions":                deleteMemberPositions,
+	"delete-member-qualifications":           deleteMemberQualifications,
+	"delete-member-specialities":             deleteMemberSpecialities,
+	"select-member-duplicates":               selectMemberDuplicates,
+	"select-member-active":                   selectMemberActive,
+	"merge-member-activities":                mergeMemberActivities,
+	"merge-member-notes":                     mergeMemberNotes,
+	"merge-member-issues":                    mergeMemberIssues,
+	"merge-member-invoices":                  mergeMemberInvoices,
+	"merge-member-payments":                  mergeMemberPayments,
+	"merge-member-positions":                 mergeMemberPositions,
+	"merge-member-qualifications":            mergeMemberQualifications,
+	"update-member-merged":                   updateMemberMerged,
 }
 
 const insertMemberRow = `
@@ -48,7 +66,7 @@ INSERT INTO member (
 ) VALUES (
     ?, ?, ?, ?, ?, 
     NOW(), NOW(), 
-    ?, ?, ?, ?, ?, ?, ?, ?, MD5("a-not-so-random-string")
+    ?, ?, ?, ?, ?, ?, ?, ?, ?
 )`
 
 const insertMemberQualificationRow = `
@@ -141,10 +159,11 @@ INSERT INTO ms_m_status(
     member_id, 
     ms_status_id, 
     current, 
+    created_at,
     updated_at,
     comment
 ) 
-VALUES (?, ?, ?, NOW(), ?)`
+VALUES (?, ?, ?, COALESCE(NULLIF(?, ''), NOW()), NOW(), ?)`
 
 const selectMember = `SELECT 
 	active,
@@ -251,6 +270,24 @@ WHERE
     mms.member_id = ?
 ORDER BY mms.id DESC`
 
+const selectMemberCurrentStatusID = `SELECT
+    ms_status_id
+FROM
+    ms_m_status
+WHERE
+    current = 1 AND active = 1 AND member_id = ?
+ORDER BY id DESC
+LIMIT 1`
+
+const selectMemberCurrentStatusDate = `SELECT
+    DATE_FORMAT(created_at, '%Y-%m-%d')
+FROM
+    ms_m_status
+WHERE
+    current = 1 AND active = 1 AND member_id = ?
+ORDER BY id DESC
+LIMIT 1`
+
 const selectMemberQualifications = `SELECT 
     COALESCE(mq.short_name, ''),
     COALESCE(mq.name, ''),
@@ -323,3 +360,72 @@ WHERE id != ? AND member_id = ?`
 
 // de-activate all subscriptions for a member
 const updateMemberDeactivateSubscriptions = `UPDATE fn_m_subscription SET active = 0 WHERE member_id = ?`
+
+// a NULL value leaves the consent flag unchanged
+const updateMemberConsent = `
+UPDATE member SET
+    consent_directory = COALESCE(?, consent_directory),
+    consent_contact = COALESCE(?, consent_contact)
+WHERE id = ?`
+
+const updateMemberUpdatedAt = `UPDATE member SET updated_at = NOW() WHERE id = ?`
+
+const deleteMemberContactType = `DELETE FROM mp_m_contact WHERE member_id = ? AND mp_contact_type_id = ?`
+
+const deleteMemberPositions = `DELETE FROM mp_m_position WHERE member_id = ?`
+
+const deleteMemberQualifications = `DELETE FROM mp_m_qualification WHERE member_id = ?`
+
+const deleteMemberSpecialities = `DELETE FROM mp_m_speciality WHERE member_id = ?`
+
+// pairs of active members that share an email address, or have the same name and date of birth. A member id of 0
+// selects all pairs, otherwise the pairs that include the member.
+const selectMemberDuplicates = `
+SELECT
+    a.id,
+    CONCAT(a.first_name, ' ', a.last_name),
+    COALESCE(a.primary_email, ''),
+    b.id,
+    CONCAT(b.first_name, ' ', b.last_name),
+    COALESCE(b.primary_email, ''),
+    IF(LOWER(a.primary_email) IN (LOWER(b.primary_email), LOWER(b.secondary_email))
+        OR LOWER(a.secondary_email) IN (LOWER(b.primary_email), LOWER(b.secondary_email)),
+        'email', 'name and date of birth')
+FROM
+    member a
+        INNER JOIN
+    member b ON a.id < b.id
+WHERE
+    a.active = 1 AND b.active = 1
+    AND (? = 0 OR ? IN (a.id, b.id))
+    AND (LOWER(a.primary_email) IN (LOWER(b.primary_email), LOWER(b.secondary_email))
+        OR LOWER(a.secondary_email) IN (LOWER(b.primary_email), LOWER(b.secondary_email))
+        OR (LOWER(a.first_name) = LOWER(b.first_name) AND LOWER(a.last_name) = LOWER(b.last_name)
+            AND a.date_of_birth = b.date_of_birth))
+ORDER BY a.id, b.id`
+
+const selectMemberActive = `SELECT active FROM member WHERE id = ? FOR UPDATE`
+
+const mergeMemberActivities = `UPDATE ce_m_activity SET member_id = ?, updated_at = NOW() WHERE member_id = ?`
+
+const mergeMemberNotes = `UPDATE wf_note_association SET member_id = ?, updated_at = NOW() WHERE member_id = ?`
+
+const mergeMemberIssues = `UPDATE wf_issue_association SET member_id = ?, updated_at = NOW() WHERE member_id = ?`
+
+const mergeMemberInvoices = `UPDATE fn_m_invoice SET member_id = ?, updated_at = NOW() WHERE member_id = ?`
+
+const mergeMemberPayments = `UPDATE fn_payment SET member_id = ?, updated_at = NOW() WHERE member_id = ?`
+
+// positions and qualifications the survivor already has are left with the duplicate
+const mergeMemberPositions = `
+UPDATE mp_m_position SET member_id = ?, updated_at = NOW()
+WHERE member_id = ? AND mp_position_id NOT IN (
+    SELECT x.mp_position_id FROM (SELECT mp_position_id FROM mp_m_position WHERE member_id = ?) x)`
+
+const mergeMemberQualifications = `
+UPDATE mp_m_qualification SET member_id = ?, updated_at = NOW()
+WHERE member_id = ? AND mp_qualification_id NOT IN (
+    SELECT x.mp_qualification_id FROM (SELECT mp_qualification_id FROM mp_m_qualification WHERE member_id = ?) x)`
+
+// soft-delete a merged member and prevent them from logging in
+const updateMemberMerged = `UPDATE member SET active = 0, login = 0, updated_at = NOW() WHERE id = ?`
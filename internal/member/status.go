@@ -0,0 +1,274 @@
+package member
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cardiacsociety/web-services/internal/note"
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+// Membership status values managed by the status lifecycle
+const (
+	StatusApplicant  = "applicant"
+	StatusActive     = "active"
+	StatusSuspended  = "suspended"
+	StatusLeave      = "leave of absence"
+	StatusLapsed     = "lapsed"
+	StatusResigned   = "resigned"
+	StatusDeceased   = "deceased"
+	StatusReinstated = "reinstated"
+	StatusInactive   = "inactive"
+)
+
+// StatusUnmanaged is returned by CurrentStatus for a member whose current ms_status row is not one of the statuses
+// above. A member can be moved from it into the status lifecycle, but not back to it.
+const StatusUnmanaged = "unmanaged"
+
+// Note type ids used to record a status change against the member
+const (
+	noteTypeDeceased = 10004
+	noteTypeHistory  = 10007
+	noteTypeLapsed   = 10008
+)
+
+// statusIDs maps each status to its ms_status.id. The applicant status is named 'Pending' in ms_status, and the
+// leave of absence and reinstated statuses require the ms_status rows 10009 and 10010 - see the README.
+var statusIDs = map[string]int{
+	StatusActive:     1,
+	StatusApplicant:  10003,
+	StatusLapsed:     lapsedStatusID,
+	StatusSuspended:  10005,
+	StatusResigned:   10007,
+	StatusDeceased:   10008,
+	StatusLeave:      10009,
+	StatusReinstated: 10010,
+	StatusInactive:   10006,
+}
+
+// transitions lists the statuses that can follow each status. Deceased is final. A member without any status
+// record can only become an applicant or be made active. Inactive and unmanaged statuses are not set by the
+// lifecycle, but a member can be moved from them.
+var transitions = map[string][]string{
+	"":               {StatusApplicant, StatusActive},
+	StatusApplicant:  {StatusActive, StatusResigned, StatusDeceased},
+	StatusActive:     {StatusSuspended, StatusLeave, StatusLapsed, StatusResigned, StatusDeceased},
+	StatusSuspended:  {StatusActive, StatusLapsed, StatusResigned, StatusDeceased},
+	StatusLeave:      {StatusActive, StatusLapsed, StatusResigned, StatusDeceased},
+	StatusLapsed:     {StatusReinstated, StatusResigned, StatusDeceased},
+	StatusResigned:   {StatusReinstated, StatusDeceased},
+	StatusDeceased:   {},
+	StatusReinstated: {StatusActive, StatusSuspended, StatusLeave, StatusLapsed, StatusResigned, StatusDeceased},
+	StatusInactive:   {StatusActive, StatusReinstated, StatusLapsed, StatusResigned, StatusDeceased},
+	StatusUnmanaged:  {StatusActive, StatusSuspended, StatusLeave, StatusLapsed, StatusResigned, StatusDeceased},
+}
+
+// endsSubscriptions are the statuses that de-activate a member's financial subscriptions
+var endsSubscriptions = map[string]bool{
+	StatusLapsed:   true,
+	StatusResigned: true,
+	StatusDeceased: true,
+}
+
+// StatusChange is a request to move a member to a new membership status. Effective is the date the change
+// takes effect, format "2006-01-02", and defaults to today. Reason is recorded in a note against the member.
+type StatusChange struct {
+	Status    string `json:"status"`
+	Effective string `json:"effective"`
+	Reason    string `json:"reason"`
+}
+
+// StatusID returns the ms_status.id for a status
+func StatusID(status string) (int, error) {
+	id, ok := statusIDs[status]
+	if !ok {
+		return 0, fmt.Errorf("unknown membership status %q", status)
+	}
+	return id, nil
+}
+
+// CanTransition returns an error if a member cannot move from one status to another. An empty from value means
+// the member has no status.
+func CanTransition(from, to string) error {
+
+	if _, err := StatusID(to); err != nil {
+		return err
+	}
+	next, ok := transitions[from]
+	if !ok {
+		return fmt.Errorf("unknown membership status %q", from)
+	}
+	for _, s := range next {
+		if s == to {
+			return nil
+		}
+	}
+	if from == "" {
+		return fmt.Errorf("a member with no status cannot be made %s", to)
+	}
+	return fmt.Errorf("membership status cannot change from %s to %s", from, to)
+}
+
+// Validate checks the status and effective date of a status change. The effective date cannot be in the
+// future as the change is applied immediately.
+func (sc StatusChange) Validate(now time.Time) error {
+
+	if _, err := StatusID(sc.Status); err != nil {
+		return err
+	}
+	if sc.Effective == "" {
+		return nil
+	}
+	d, err := time.Parse("2006-01-02", sc.Effective)
+	if err != nil {
+		return fmt.Errorf("effective date %q should be formatted as YYYY-MM-DD", sc.Effective)
+	}
+	if d.After(now) {
+		return fmt.Errorf("effective date %s cannot be in the future", sc.Effective)
+	}
+	return nil
+}
+
+// CurrentStatus returns the member's current membership status, or an empty string if they have none. A status
+// that is not managed by the lifecycle is returned as StatusUnmanaged.
+func (m *Member) CurrentStatus(ds datastore.Datastore) (string, error) {
+	return currentStatus(ds.MySQL.Session.QueryRow(queries["select-member-current-status-id"], m.ID))
+}
+
+// CurrentStatusTx returns the member's current membership status, as for CurrentStatus, as part of a transaction
+func (m *Member) CurrentStatusTx(tx *sql.Tx) (string, error) {
+	return currentStatus(tx.QueryRow(queries["select-member-current-status-id"], m.ID))
+}
+
+// currentStatus returns the status for the result of the select-member-current-status-id query
+func currentStatus(row *sql.Row) (string, error) {
+
+	var id int
+	err := row.Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "CurrentStatus query error")
+	}
+
+	for s, sid := range statusIDs {
+		if sid == id {
+			return s, nil
+		}
+	}
+	return StatusUnmanaged, nil
+}
+
+// ChangeStatus moves the member to a new membership status, if the transition from the current status is
+// allowed. It records the new status from the effective date, which cannot be before that of the current status,
+// adds a note with the reason and effective date and, for lapsed, resigned and deceased, de-activates the member's
+// financial subscriptions. The changes are made in a single transaction.
+func (m *Member) ChangeStatus(ds datastore.Datastore, sc StatusChange) error {
+
+	tx, err := ds.MySQL.Session.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.ChangeStatusTx(tx, sc)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ChangeStatusTx moves the member to a new membership status, as for ChangeStatus, as part of a transaction
+func (m *Member) ChangeStatusTx(tx *sql.Tx, sc StatusChange) error {
+
+	now := time.Now()
+	err := sc.Validate(now)
+	if err != nil {
+		return err
+	}
+
+	// a status effective today is recorded at the current time, an earlier one from the start of that day
+	sr := StatusRow{
+		StatusID: statusIDs[sc.Status],
+		Current:  true,
+		Comment:  sc.Reason,
+	}
+	today := now.Format("2006-01-02")
+	if sc.Effective == "" {
+		sc.Effective = today
+	}
+	if sc.Effective != today {
+		sr.Effective = sc.Effective
+	}
+
+	from, err := m.CurrentStatusTx(tx)
+	if err != nil {
+		return err
+	}
+	err = CanTransition(from, sc.Status)
+	if err != nil {
+		return err
+	}
+
+	// the status history is ordered by date, so a change cannot take effect before the current status
+	var since string
+	err = tx.QueryRow(queries["select-member-current-status-date"], m.ID).Scan(&since)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "select-member-current-status-date query error")
+	}
+	if sc.Effective < since {
+		return fmt.Errorf("effective date %s cannot be before the current status, which is effective from %s", sc.Effective, since)
+	}
+
+	// This creates the new status, and sets others to current = 0
+	if err := sr.insert(tx, m.ID); err != nil {
+		return errors.Wrap(err, "status insert")
+	}
+
+	n := note.Note{
+		MemberID:      m.ID,
+		TypeID:        statusNoteType(sc.Status),
+		DateEffective: sc.Effective,
+		Content:       statusNoteContent(from, sc),
+	}
+	if err := n.InsertRowTx(tx); err != nil {
+		return errors.Wrap(err, "status note")
+	}
+
+	if endsSubscriptions[sc.Status] {
+		_, err := tx.Exec(queries["update-member-deactivate-subscriptions"], m.ID)
+		if err != nil {
+			return errors.Wrap(err, "deactivate subscriptions")
+		}
+	}
+
+	return nil
+}
+
+// statusNoteType returns the note type used to record a change to status
+func statusNoteType(status string) int {
+	switch status {
+	case StatusLapsed:
+		return noteTypeLapsed
+	case StatusDeceased:
+		return noteTypeDeceased
+	}
+	return noteTypeHistory
+}
+
+// statusNoteContent describes a status change for the member note
+func statusNoteContent(from string, sc StatusChange) string {
+	if from == "" {
+		from = "none"
+	}
+	s := fmt.Sprintf("Membership status changed from %s to %s, effective %s", from, sc.Status, sc.Effective)
+	if sc.Reason != "" {
+		s += " - " + sc.Reason
+	}
+	return s
+}
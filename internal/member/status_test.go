@@ -0,0 +1,50 @@
+package member_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"github.com/cardiacsociety/web-services/internal/member"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"", member.StatusApplicant, true},
+		{"", member.StatusLapsed, false},
+		{member.StatusApplicant, member.StatusActive, true},
+		{member.StatusActive, member.StatusLeave, true},
+		{member.StatusLeave, member.StatusActive, true},
+		{member.StatusActive, member.StatusReinstated, false},
+		{member.StatusLapsed, member.StatusActive, false},
+		{member.StatusLapsed, member.StatusReinstated, true},
+		{member.StatusResigned, member.StatusReinstated, true},
+		{member.StatusDeceased, member.StatusActive, false},
+		{member.StatusActive, "retired", false},
+		{member.StatusInactive, member.StatusLapsed, true},
+		{member.StatusInactive, member.StatusReinstated, true},
+		{member.StatusUnmanaged, member.StatusActive, true},
+		{member.StatusActive, member.StatusUnmanaged, false},
+	}
+	for _, c := range cases {
+		err := member.CanTransition(c.from, c.to)
+		if (err == nil) != c.ok {
+			t.Errorf("CanTransition(%q, %q) err = %v, want ok = %v", c.from, c.to, err, c.ok)
+		}
+	}
+}
+
+func TestStatusChangeValidate(t *testing.T) {
+	is := is.New(t)
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	is.NoErr(member.StatusChange{Status: member.StatusLapsed}.Validate(now))
+	is.NoErr(member.StatusChange{Status: member.StatusLapsed, Effective: "2019-03-01"}.Validate(now))
+	is.True(member.StatusChange{Status: member.StatusLapsed, Effective: "2019-03-02"}.Validate(now) != nil) // future
+	is.True(member.StatusChange{Status: member.StatusLapsed, Effective: "01/03/2019"}.Validate(now) != nil) // format
+	is.True(member.StatusChange{Status: "retired"}.Validate(now) != nil)                                    // unknown status
+}
@@ -42,8 +42,18 @@ type Attachment struct {
 	URL  string `json:"url" bson:"url"`
 }
 
-// InsertRow creates a new note row with fields from Note
+// InsertRow creates a new note row with fields from Note. DateEffective defaults to now if not set.
 func (n *Note) InsertRow(ds datastore.Datastore) error {
+	return n.insertRow(ds.MySQL.Session)
+}
+
+// InsertRowTx creates a new note row, as for InsertRow, as part of a transaction
+func (n *Note) InsertRowTx(tx *sql.Tx) error {
+	return n.insertRow(tx)
+}
+
+// insertRow creates a new note row, and its association, using e
+func (n *Note) insertRow(e datastore.Execer) error {
 	switch {
 	case n.ID > 0:
 		return errors.New(ErrorIDNotNil)
@@ -54,7 +64,7 @@ func (n *Note) InsertRow(ds datastore.Datastore) error {
 	case n.Content == "":
 		return errors.New(ErrorNoContent)
 	}
-	res, err := ds.MySQL.Session.Exec(queries["insert-note"], n.TypeID, n.Content)
+	res, err := e.Exec(queries["insert-note"], n.TypeID, n.DateEffective, n.Content)
 	if err != nil {
 		return err
 	}
@@ -71,7 +81,7 @@ func (n *Note) InsertRow(ds datastore.Datastore) error {
 	if err != nil {
 		return err
 	}
-	_, err = ds.MySQL.Session.Exec(queries["insert-note-association"],
+	_, err = e.Exec(queries["insert-note-association"],
 		n.ID,
 		n.MemberID,
 		NullInt(n.AssociationID),
@@ -47,7 +47,7 @@ INSERT INTO wf_note (
 	updated_at, 
 	effective_on, 
 	note 
-) VALUES (?, NOW(), NOW(), ?)`
+) VALUES (?, NOW(), COALESCE(NULLIF(?, ''), NOW()), ?)`
 
 const insertNoteAssociation = `
 INSERT INTO wf_note_association (
@@ -4,7 +4,6 @@ package payment
 import (
 	"database/sql"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
@@ -38,8 +37,7 @@ type InvoicePayment struct {
 // ByID returns the Payment identified by paymentID, or an error if not found.
 func ByID(ds datastore.Datastore, paymentID int) (Payment, error) {
 	var p Payment
-	q := fmt.Sprintf(queries["select-payment-by-id"], paymentID)
-	xp, err := execute(ds, q)
+	xp, err := execute(ds, queries["select-payment-by-id"], paymentID)
 	if err != nil {
 		return p, err
 	}
@@ -52,15 +50,17 @@ func ByID(ds datastore.Datastore, paymentID int) (Payment, error) {
 
 // ByIDs returns multiple Payment values identified by paymentIDs
 func ByIDs(ds datastore.Datastore, paymentIDs []int) ([]Payment, error) {
-	idList := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(paymentIDs)), ","), "[]")
-	q := queries["select-payments"] + fmt.Sprintf(" AND p.id IN (%s)", idList)
-	return execute(ds, q)
+	clause, args, err := datastore.NewFilter().In("p.id", paymentIDs).And()
+	if err != nil {
+		return nil, err
+	}
+	return execute(ds, queries["select-payments"]+clause, args...)
 }
 
-func execute(ds datastore.Datastore, query string) ([]Payment, error) {
+func execute(ds datastore.Datastore, query string, args ...interface{}) ([]Payment, error) {
 	var xp []Payment
 
-	rows, err := ds.MySQL.Session.Query(query)
+	rows, err := ds.MySQL.Session.Query(query, args...)
 	if err != nil {
 		return xp, fmt.Errorf("Query() err = %s", err)
 	}
@@ -137,8 +137,7 @@ func paymentAllocations(ds datastore.Datastore, paymentID int) ([]InvoicePayment
 
 	var result []InvoicePayment
 
-	q := fmt.Sprintf(queries["select-payment-allocations"], paymentID)
-	rows, err := ds.MySQL.Session.Query(q)
+	rows, err := ds.MySQL.Session.Query(queries["select-payment-allocations"], paymentID)
 	if err != nil {
 		return result, fmt.Errorf("Query() err = %s", err)
 	}
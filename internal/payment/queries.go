@@ -32,7 +32,7 @@ WHERE 1
 
 const selectActivePayments = selectPayments + ` AND p.active = 1 `
 
-const selectPaymentByID = selectActivePayments + ` AND p.id = %v `
+const selectPaymentByID = selectActivePayments + ` AND p.id = ? `
 
 const selectPaymentAllocations = `
 SELECT 
@@ -42,5 +42,5 @@ SELECT
 FROM
 	fn_invoice_payment p
 WHERE
-  active = 1 AND p.fn_payment_id = %v
+  active = 1 AND p.fn_payment_id = ?
 `
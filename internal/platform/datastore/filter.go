@@ -0,0 +1,132 @@
+package datastore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// identifier matches a table or column name, optionally qualified with a table alias, eg "id" or "cma.member_id"
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Filter builds the conditions of an SQL WHERE clause, with placeholders for the values. Column names cannot be
+// placeholders so they are checked when the filter is built, and any invalid name is returned as an error by
+// Where or And. A nil *Filter has no conditions.
+//
+//  f := datastore.NewFilter().Equal("cma.member_id", 1).GreaterEq("cma.activity_on", "2018-01-01")
+//  clause, args, err := f.Where() // "WHERE cma.member_id = ? AND cma.activity_on >= ?", [1 "2018-01-01"]
+type Filter struct {
+	conditions []string
+	args       []interface{}
+	order      []string
+	err        error
+}
+
+// NewFilter returns an empty filter
+func NewFilter() *Filter {
+	return &Filter{}
+}
+
+// Equal adds the condition column = value
+func (f *Filter) Equal(column string, value interface{}) *Filter {
+	return f.add(column, "= ?", value)
+}
+
+// NotEqual adds the condition column != value
+func (f *Filter) NotEqual(column string, value interface{}) *Filter {
+	return f.add(column, "!= ?", value)
+}
+
+// GreaterEq adds the condition column >= value
+func (f *Filter) GreaterEq(column string, value interface{}) *Filter {
+	return f.add(column, ">= ?", value)
+}
+
+// LessEq adds the condition column <= value
+func (f *Filter) LessEq(column string, value interface{}) *Filter {
+	return f.add(column, "<= ?", value)
+}
+
+// Like adds the condition column LIKE pattern, where pattern can include the % and _ wildcards
+func (f *Filter) Like(column, pattern string) *Filter {
+	return f.add(column, "LIKE ?", pattern)
+}
+
+// In adds the condition column IN (ids...). An empty list of ids matches nothing.
+func (f *Filter) In(column string, ids []int) *Filter {
+	if len(ids) == 0 {
+		f.conditions = append(f.conditions, "1 = 0")
+		return f.check(column)
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	return f.add(column, "IN ("+marks+")", args...)
+}
+
+// OrderBy adds a column to the ORDER BY clause, descending if desc is true
+func (f *Filter) OrderBy(column string, desc bool) *Filter {
+	o := column
+	if desc {
+		o += " DESC"
+	}
+	f.order = append(f.order, o)
+	return f.check(column)
+}
+
+// Where returns the filter as a clause starting with WHERE, and the args for the placeholders. If there are no
+// conditions the clause only contains the ORDER BY, if any.
+func (f *Filter) Where() (string, []interface{}, error) {
+	return f.clause("WHERE ")
+}
+
+// And returns the filter as a clause starting with AND, to extend a query that already has a WHERE clause, and
+// the args for the placeholders.
+func (f *Filter) And() (string, []interface{}, error) {
+	return f.clause("AND ")
+}
+
+// clause joins the conditions and order, with prefix in front of the conditions
+func (f *Filter) clause(prefix string) (string, []interface{}, error) {
+
+	if f == nil {
+		return "", nil, nil
+	}
+	if f.err != nil {
+		return "", nil, f.err
+	}
+
+	var s string
+	if len(f.conditions) > 0 {
+		s = " " + prefix + strings.Join(f.conditions, " AND ")
+	}
+	if len(f.order) > 0 {
+		s += " ORDER BY " + strings.Join(f.order, ", ")
+	}
+	return s, f.args, nil
+}
+
+// add a condition on a column, with args for the placeholders in the condition
+func (f *Filter) add(column, condition string, args ...interface{}) *Filter {
+	f.conditions = append(f.conditions, column+" "+condition)
+	f.args = append(f.args, args...)
+	return f.check(column)
+}
+
+// check records an error for an invalid column name
+func (f *Filter) check(column string) *Filter {
+	if f.err == nil {
+		f.err = CheckIdentifier(column)
+	}
+	return f
+}
+
+// CheckIdentifier returns an error if s is not a valid table or column name, so that it can be used in a query
+func CheckIdentifier(s string) error {
+	if !identifier.MatchString(s) {
+		return fmt.Errorf("%q is not a valid table or column name", s)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package datastore_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cardiacsociety/web-services/internal/platform/datastore"
+)
+
+func TestFilter(t *testing.T) {
+
+	cases := []struct {
+		filter *datastore.Filter
+		clause string
+		args   []interface{}
+	}{
+		{nil, "", nil},
+		{datastore.NewFilter(), "", nil},
+		{datastore.NewFilter().Equal("member_id", 1), " WHERE member_id = ?", []interface{}{1}},
+		{datastore.NewFilter().Equal("cma.member_id", 1).GreaterEq("cma.activity_on", "2018-01-01"),
+			" WHERE cma.member_id = ? AND cma.activity_on >= ?", []interface{}{1, "2018-01-01"}},
+		{datastore.NewFilter().NotEqual("active", 0).LessEq("updated_at", "2019-01-01"),
+			" WHERE active != ? AND updated_at <= ?", []interface{}{0, "2019-01-01"}},
+		{datastore.NewFilter().Like("name", "%Bruno%"), " WHERE name LIKE ?", []interface{}{"%Bruno%"}},
+		{datastore.NewFilter().In("id", []int{1, 2, 3}), " WHERE id IN (?, ?, ?)", []interface{}{1, 2, 3}},
+		{datastore.NewFilter().In("id", nil), " WHERE 1 = 0", nil},
+		{datastore.NewFilter().OrderBy("id", true), " ORDER BY id DESC", nil},
+		{datastore.NewFilter().Equal("active", 1).OrderBy("name", false).OrderBy("id", true),
+			" WHERE active = ? ORDER BY name, id DESC", []interface{}{1}},
+	}
+
+	for i, c := range cases {
+		clause, args, err := c.filter.Where()
+		if err != nil {
+			t.Errorf("case %d Where() err = %s", i, err)
+			continue
+		}
+		if clause != c.clause {
+			t.Errorf("case %d Where() clause = %q, want %q", i, clause, c.clause)
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("case %d Where() args = %v, want %v", i, args, c.args)
+		}
+	}
+}
+
+func TestFilterAnd(t *testing.T) {
+	clause, _, err := datastore.NewFilter().Equal("a", 1).Equal("b", 2).And()
+	if err != nil {
+		t.Fatalf("And() err = %s", err)
+	}
+	want := " AND a = ? AND b = ?"
+	if clause != want {
+		t.Errorf("And() clause = %q, want %q", clause, want)
+	}
+}
+
+func TestFilterInvalidColumn(t *testing.T) {
+	cases := []*datastore.Filter{
+		datastore.NewFilter().Equal("id = 1 OR 1", 1),
+		datastore.NewFilter().Equal("id", 1).Like("name; DROP TABLE member", "x"),
+		datastore.NewFilter().In("id)", []int{1}),
+		datastore.NewFilter().OrderBy("id DESC", false),
+		datastore.NewFilter().GreaterEq("a.b.c", 1),
+	}
+	for i, f := range cases {
+		if _, _, err := f.Where(); err == nil {
+			t.Errorf("case %d Where() err = nil, want an error", i)
+		}
+	}
+}
+
+func TestCheckIdentifier(t *testing.T) {
+	cases := []struct {
+		arg  string
+		want bool
+	}{
+		{"member", true},
+		{"ol_resource", true},
+		{"cma.member_id", true},
+		{"", false},
+		{"1member", false},
+		{"member WHERE 1", false},
+		{"`member`", false},
+		{"member;", false},
+	}
+	for _, c := range cases {
+		got := datastore.CheckIdentifier(c.arg) == nil
+		if got != c.want {
+			t.Errorf("CheckIdentifier(%q) valid = %v, want %v", c.arg, got, c.want)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package datastore
 
 import (
+	"time"
+
 	"github.com/pkg/errors"
 	"gopkg.in/mgo.v2"
 )
@@ -83,6 +85,49 @@ func (m *MongoDBConnection) RecurringCol() (*mgo.Collection, error) {
 	return m.Session.DB(m.DBName).C("Recurring"), nil
 }
 
+// ChangesCol returns a pointer to the Changes collection
+func (m *MongoDBConnection) ChangesCol() (*mgo.Collection, error) {
+
+	return m.Session.DB(m.DBName).C("Changes"), nil
+}
+
+// ResetsCol returns a pointer to the Resets collection
+func (m *MongoDBConnection) ResetsCol() (*mgo.Collection, error) {
+
+	return m.Session.DB(m.DBName).C("Resets"), nil
+}
+
+// ResetLimitsCol returns a pointer to the ResetLimits collection
+func (m *MongoDBConnection) ResetLimitsCol() (*mgo.Collection, error) {
+
+	return m.Session.DB(m.DBName).C("ResetLimits"), nil
+}
+
+// RefreshCol returns a pointer to the Refresh collection, with expired docs removed by a TTL index
+func (m *MongoDBConnection) RefreshCol() (*mgo.Collection, error) {
+
+	return m.expiringCol("Refresh")
+}
+
+// RevokedCol returns a pointer to the Revoked collection, with expired docs removed by a TTL index
+func (m *MongoDBConnection) RevokedCol() (*mgo.Collection, error) {
+
+	return m.expiringCol("Revoked")
+}
+
+// expiringCol returns a pointer to a collection after ensuring a TTL index on expiresAt, so MongoDB removes each
+// doc once it has expired. Docs without expiresAt are kept. The index is cached by the session, so it is only
+// created on the first call.
+func (m *MongoDBConnection) expiringCol(name string) (*mgo.Collection, error) {
+
+	c := m.Session.DB(m.DBName).C(name)
+	err := c.EnsureIndex(mgo.Index{Key: []string{"expiresAt"}, ExpireAfter: time.Second})
+	if err != nil {
+		return c, errors.Wrapf(err, "could not ensure TTL index on %s", name)
+	}
+	return c, nil
+}
+
 // Close terminates the Session
 func (m *MongoDBConnection) Close() {
 	m.Session.Close()
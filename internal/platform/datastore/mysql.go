@@ -7,6 +7,11 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Execer executes a statement, and is satisfied by both *sql.DB and *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 type MySQLConnection struct {
 	DSN     string // Data Desc Name - connection string
 	Desc    string
@@ -1,6 +1,8 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"strings"
 	"time"
 
@@ -10,7 +12,7 @@ import (
 
 type Token struct {
 	signingKey []byte
-	ttlHours   int
+	ttl        time.Duration
 	Encoded    string      `json:"token"`
 	IssuedAt   time.Time   `json:"issuedAt"`
 	ExpiresAt  time.Time   `json:"expiresAt"`
@@ -24,16 +26,23 @@ type TokenClaims struct {
 	jwt.StandardClaims
 }
 
-// New returns a pointer to a Token
+// New returns a pointer to a Token that expires ttlHours after it is issued
 func New(issuer, signingKey string, ttlHours int) *Token {
+	return NewTTL(issuer, signingKey, time.Duration(ttlHours)*time.Hour)
+}
+
+// NewTTL returns a pointer to a Token that expires ttl after it is issued. Each token has a random id (jti claim)
+// so that it can be revoked.
+func NewTTL(issuer, signingKey string, ttl time.Duration) *Token {
 
 	var t Token
 
 	t.signingKey = []byte(signingKey)
-	t.ttlHours = ttlHours
+	t.ttl = ttl
 
 	// Initialise standard claims
 	t.Claims.StandardClaims = jwt.StandardClaims{
+		Id:     newID(),
 		Issuer: issuer,
 	}
 
@@ -47,7 +56,7 @@ func New(issuer, signingKey string, ttlHours int) *Token {
 func (t *Token) SetTimes(iat time.Time) *Token {
 
 	t.Claims.StandardClaims.IssuedAt = iat.Unix()
-	t.Claims.StandardClaims.ExpiresAt = iat.Add(time.Hour * time.Duration(t.ttlHours)).Unix()
+	t.Claims.StandardClaims.ExpiresAt = iat.Add(t.ttl).Unix()
 
 	// Set Unix dates at root of struct for convenience (??)
 	t.IssuedAt = time.Unix(int64(t.Claims.StandardClaims.IssuedAt), 0)
@@ -65,8 +74,8 @@ func (t *Token) Encode() (Token, error) {
 	if len(t.signingKey) < 1 {
 		return *t, errors.New("Signing key cannot be blank")
 	}
-	if t.ttlHours < 1 {
-		return *t, errors.New("TTL hours must be a positive integer")
+	if t.ttl < time.Second {
+		return *t, errors.New("TTL must be at least one second")
 	}
 
 	var err error
@@ -140,9 +149,10 @@ func Decode(token, signingKey string) (Token, error) {
 		t.Claims.ExpiresAt = int64(claims["exp"].(float64))
 		t.Claims.IssuedAt = int64(claims["iat"].(float64))
 		t.Claims.Issuer = claims["iss"].(string)
+		t.Claims.Id, _ = claims["jti"].(string) // not set in older tokens
 
-		// reverse engineer ttlHours from iat and exp
-		t.ttlHours = (int(t.Claims.ExpiresAt) - int(t.Claims.IssuedAt)) / 3600
+		// reverse engineer ttl from iat and exp
+		t.ttl = time.Duration(t.Claims.ExpiresAt-t.Claims.IssuedAt) * time.Second
 
 		// Set the friendly dates
 		issueTime := time.Unix(t.Claims.IssuedAt, 0)
@@ -187,3 +197,10 @@ func FromHeader(a string) (string, error) {
 
 	return strings.TrimSpace(t[1]), nil
 }
+
+// newID returns a random token id
+func newID() string {
+	xb := make([]byte, 16)
+	rand.Read(xb)
+	return hex.EncodeToString(xb)
+}
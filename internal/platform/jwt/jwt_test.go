@@ -124,3 +124,25 @@ func TestTokenWithFutureDate(t *testing.T) {
 	expireTime := int(tk.Claims.ExpiresAt/3600) - int(time.Now().Unix()/3600)
 	is.True(expectExpireTime == expireTime) // Incorrect expire time
 }
+
+func TestNewTTL(t *testing.T) {
+	is := is.New(t)
+	tk, err := jwt.NewTTL(issuer, signingKey, 15*time.Minute).Encode()
+	is.NoErr(err)                                                  // Error creating token
+	is.Equal(tk.Claims.ExpiresAt-tk.Claims.IssuedAt, int64(15*60)) // Incorrect TTL seconds
+}
+
+func TestTokenID(t *testing.T) {
+	is := is.New(t)
+
+	tk1, err := jwt.New(issuer, signingKey, ttlHours).Encode()
+	is.NoErr(err) // Error creating token
+	tk2, err := jwt.New(issuer, signingKey, ttlHours).Encode()
+	is.NoErr(err)                           // Error creating token
+	is.True(tk1.Claims.Id != "")            // Token should have an id
+	is.True(tk1.Claims.Id != tk2.Claims.Id) // Token ids should be unique
+
+	tk3, err := jwt.Decode(tk1.Encoded, signingKey)
+	is.NoErr(err)                          // Error decoding token
+	is.Equal(tk3.Claims.Id, tk1.Claims.Id) // Decoded token should have the same id
+}
@@ -5,7 +5,6 @@ package position
 import (
 	"database/sql"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/cardiacsociety/web-services/internal/platform/datastore"
@@ -33,8 +32,7 @@ type Position struct {
 // ByID fetches a Position by member-position ID
 func ByID(ds datastore.Datastore, memberPositionID int) (Position, error) {
 	var p Position
-	q := fmt.Sprintf(queries["select-position-by-id"], memberPositionID)
-	xp, err := execute(ds, q)
+	xp, err := execute(ds, queries["select-position-by-id"], memberPositionID)
 	if err != nil {
 		return p, err
 	}
@@ -47,16 +45,18 @@ func ByID(ds datastore.Datastore, memberPositionID int) (Position, error) {
 
 // ByIDs returns multiple Position values identified by memberPositionIDs
 func ByIDs(ds datastore.Datastore, memberPositionIDs []int) ([]Position, error) {
-	idList := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(memberPositionIDs)), ","), "[]")
-	q := queries["select-positions"] + fmt.Sprintf(" AND mp.id IN (%s)", idList)
-	return execute(ds, q)
+	clause, args, err := datastore.NewFilter().In("mp.id", memberPositionIDs).And()
+	if err != nil {
+		return nil, err
+	}
+	return execute(ds, queries["select-positions"]+clause, args...)
 }
 
-func execute(ds datastore.Datastore, query string) ([]Position, error) {
+func execute(ds datastore.Datastore, query string, args ...interface{}) ([]Position, error) {
 
 	var xp []Position
 
-	rows, err := ds.MySQL.Session.Query(query)
+	rows, err := ds.MySQL.Session.Query(query, args...)
 	if err != nil {
 		return xp, fmt.Errorf("Query() err = %s", err)
 	}
@@ -32,4 +32,4 @@ WHERE 1 `
 
 const selectActivePositions = selectPositions + ` AND mp.active = 1 `
 
-const selectPositionByID = selectActivePositions + ` AND mp.id = %v `
+const selectPositionByID = selectActivePositions + ` AND mp.id = ? `
@@ -154,7 +154,8 @@ INSERT INTO `%s`.`ce_m_evaluation` VALUES
   (3, 504, 1, 1, 1, '2015-09-28 03:56:53', '2017-01-02 09:05:50', 100, '2015-01-01', '2016-01-01', ''),
   (4, 505, 1, 1, 1, '2015-10-26 05:52:37', '2017-01-02 09:05:50', 100, '2015-01-01', '2015-12-01', ''),
   (5, 35, 1, 1, 1, '2015-10-29 03:57:18', '2017-01-02 09:05:35', 100, '2015-01-01', '2015-12-01', ''),
-  (6, 506, 1, 1, 1, '2016-02-24 02:33:29', '2017-01-02 09:05:51', 100, '2016-01-01', '2017-01-01', '');
+  (6, 506, 1, 1, 1, '2016-02-24 02:33:29', '2017-01-02 09:05:51', 100, '2016-01-01', '2017-01-01', ''),
+  (7, 1, 2, 1, 0, '2018-01-01 00:00:00', '2018-01-01 00:00:00', 250, '2018-01-01', '2020-12-31', '');
 
 -- insert-data-cm_email_log
 
@@ -456,7 +457,9 @@ INSERT INTO `%s`.`ms_status` VALUES
   (10005, 1, 0, '2013-01-29 11:41:53', '2013-06-18 15:11:50', 0, 0, 0, 0, 0, 'Suspended', ''),
   (10006, 1, 0, '2013-01-29 11:42:12', '2013-06-18 15:11:57', 0, 0, 0, 0, 0, 'Inactive', ''),
   (10007, 1, 0, '2013-05-15 20:12:00', '2013-06-18 15:12:04', 0, 0, 0, 0, 0, 'Resigned', ''),
-  (10008, 1, 0, NOW(), '2013-06-18 15:12:11', 0, 0, 0, 0, 0, 'Deceased', '');
+  (10008, 1, 0, NOW(), '2013-06-18 15:12:11', 0, 0, 0, 0, 0, 'Deceased', ''),
+  (10009, 1, 0, NOW(), NOW(), 1, 1, 0, 0, 0, 'Leave of Absence', ''),
+  (10010, 1, 0, NOW(), NOW(), 1, 1, 1, 1, 1, 'Reinstated', '');
 
 -- name: insert-data-ms_title
 INSERT INTO `%s`.`ms_title` VALUES
@@ -7,7 +7,7 @@ CREATE TABLE IF NOT EXISTS `%s`.`ad_user` (
   `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT 'Record created',
   `updated_at` TIMESTAMP NULL DEFAULT NULL COMMENT 'Record last updated',
   `username` VARCHAR(45) NOT NULL COMMENT 'admin user\'s username',
-  `password` VARCHAR(45) NOT NULL COMMENT 'Admin user\'s password',
+  `password` VARCHAR(100) NOT NULL COMMENT 'Admin user\'s password, stored as a bcrypt hash or a legacy MD5 hash.',
   `name` VARCHAR(100) NOT NULL COMMENT 'Admin user full name',
   `short_name` VARCHAR(16) NOT NULL COMMENT 'Short name is for display in lists, e.g. can use initials, first or nick name.',
   `email` VARCHAR(100) NULL COMMENT 'Contact email for admin - not used for anything at present but may be used for alerts etc.',
@@ -94,7 +94,7 @@ CREATE TABLE IF NOT EXISTS `%s`.`member` (
   `mobile_phone` VARCHAR(45) NULL COMMENT 'Mobile phone number.',
   `primary_email` VARCHAR(100) NULL COMMENT 'Primary email address, also used for authentication to the member system.',
   `secondary_email` VARCHAR(100) NULL COMMENT 'Secondary email is used in case the primary email become inactive or gets forgotten. The user can also login with this email.',
-  `password` VARCHAR(100) NOT NULL COMMENT 'Password is stored as an MD5 hash.',
+  `password` VARCHAR(100) NOT NULL COMMENT 'Password is stored as a bcrypt hash, or an MD5 hash for legacy rows that are upgraded at the next login.',
   `token` VARCHAR(45) NULL COMMENT 'A temporary authentication token used to log the user in via a link so they can reset their password. This token should be cleared immediately as part of the login process.',
   `journal_number` VARCHAR(45) NULL COMMENT 'Journal number is given to the member as a reference for their subscription to a primary journal publication. (This should move to an external table later)',
   `bpay_number` VARCHAR(45) NULL COMMENT 'BPay number is generated by admin and allocated for Australian members only - for direct deposit of funds. (This should move to an external table later)',